@@ -41,7 +41,7 @@ const BiographicalPage = () => {
 
         setAbout(aboutResponse.data.about);
         setBirthday(birthdayResponse.data.birthday);
-        setAge(calculateAge(birthdayResponse.data.birthday)); // Assuming birthday is a date string
+        setAge(birthdayResponse.data.age);
 
         setError("");
       } catch (err) {
@@ -13,6 +13,7 @@ const RegisterPage = () => {
     firstName: '',
     middleName: '',
     lastName: '',
+    birthdate: '',
     password: '',
     confirmPassword: '',
     city: '',
@@ -52,6 +53,7 @@ const RegisterPage = () => {
       firstName,
       middleName,
       lastName,
+      birthdate,
       password,
       confirmPassword,
       city,
@@ -71,6 +73,7 @@ const RegisterPage = () => {
         first_name: firstName,
         middle_name: middleName,
         last_name: lastName,
+        birthdate,
         password,
         user_city: city,
         latitude: parseFloat(latitude),
@@ -163,6 +166,17 @@ const RegisterPage = () => {
             required
           />
         </div>
+        <div className="inputGroup">
+          <label>Date of Birth:</label>
+          <input
+            type="date"
+            name="birthdate"
+            value={formData.birthdate}
+            onChange={handleChange}
+            className="input"
+            required
+          />
+        </div>
         <div className="inputGroup">
           <label>Password:</label>
           <input
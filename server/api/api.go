@@ -0,0 +1,9 @@
+// Package api holds the OpenAPI document describing the HTTP API. It is
+// kept next to the code and checked against the handlers by the contract
+// tests, so a change to a route or a payload has to update it too.
+package api
+
+import _ "embed"
+
+//go:embed openapi.json
+var Spec []byte
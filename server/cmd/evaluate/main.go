@@ -0,0 +1,98 @@
+// Command evaluate compares the scoring strategies of the matching package
+// offline. It can export a snapshot of the database and replay a snapshot
+// against every strategy, reporting how well each one ranks the users that
+// connection requests were sent to and accepted by.
+//
+//	go run ./cmd/evaluate -export snapshot.json
+//	go run ./cmd/evaluate -snapshot snapshot.json -k 10
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	"os"
+	"text/tabwriter"
+)
+
+func main() {
+	exportPath := flag.String("export", "", "write a snapshot of the database to this file")
+	snapshotPath := flag.String("snapshot", "", "replay the snapshot in this file")
+	k := flag.Int("k", 10, "number of top ranked candidates to judge")
+	asJSON := flag.Bool("json", false, "print the metrics as JSON")
+	flag.Parse()
+
+	if *exportPath == "" && *snapshotPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *exportPath != "" {
+		if err := databaseSetup.InitDB(); err != nil {
+			log.Fatalf("Error initializing database: %v", err)
+		}
+		snapshot, err := matching.ExportSnapshot(databaseSetup.GetDB())
+		if err != nil {
+			log.Fatalf("Error exporting snapshot: %v", err)
+		}
+		if err := writeSnapshot(*exportPath, snapshot); err != nil {
+			log.Fatalf("Error writing snapshot: %v", err)
+		}
+		fmt.Printf("Exported %d users and %d outcomes to %s\n", len(snapshot.Users), len(snapshot.Outcomes), *exportPath)
+	}
+
+	if *snapshotPath == "" {
+		return
+	}
+
+	snapshot, err := readSnapshot(*snapshotPath)
+	if err != nil {
+		log.Fatalf("Error reading snapshot: %v", err)
+	}
+
+	var results []matching.Metrics
+	for _, scorer := range matching.AllScorers() {
+		results = append(results, matching.Evaluate(snapshot, scorer, *k))
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(results)
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "SCORER\tVIEWERS\tPRECISION@%d\tRECALL@%d\tACCEPTANCE\tMRR\n", *k, *k)
+	for _, m := range results {
+		fmt.Fprintf(table, "%s\t%d\t%.3f\t%.3f\t%.3f\t%.3f\n", m.Scorer, m.Viewers, m.PrecisionAtK, m.RecallAtK, m.AcceptanceRate, m.MRR)
+	}
+	table.Flush()
+}
+
+func writeSnapshot(path string, snapshot matching.Snapshot) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+func readSnapshot(path string) (matching.Snapshot, error) {
+	var snapshot matching.Snapshot
+	file, err := os.Open(path)
+	if err != nil {
+		return snapshot, err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&snapshot)
+	return snapshot, err
+}
@@ -0,0 +1,309 @@
+// Command seed fills a development database with synthetic users so there is
+// someone to match with. The users are registered the same way the API
+// registers them, then get preferences, weights, a short biography and
+// profile fields, and optionally send each other likes. The same -seed on an
+// empty database always creates the same users.
+//
+// Every seeded user logs in with the password given by -password.
+//
+//	go run ./cmd/seed -n 200
+//	go run ./cmd/seed -n 50 -seed 7 -likes 5 -country ""
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/jobs"
+	"match_me_module/matching"
+	"match_me_module/profile"
+	"match_me_module/routes"
+	"match_me_module/structures"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var firstNames = []string{
+	"Anna", "Maria", "Liis", "Kadri", "Triin", "Kristiina", "Laura", "Mari", "Eliisa", "Helena",
+	"Sofia", "Emma", "Hanna", "Kati", "Piret", "Elina", "Julia", "Olga", "Nora", "Greta",
+	"Martin", "Andres", "Marko", "Rasmus", "Tanel", "Kristjan", "Mihkel", "Karl", "Oliver", "Henrik",
+	"Jaan", "Toomas", "Rein", "Siim", "Erik", "Lukas", "Daniel", "Markus", "Ivan", "Jonas",
+}
+
+var middleNames = []string{
+	"Johanna", "Elisabeth", "Marie", "Louise", "Katariina", "Aleksander", "Johannes", "Peeter", "Mattias", "Robert",
+}
+
+var lastNames = []string{
+	"Tamm", "Saar", "Sepp", "Magi", "Kask", "Kukk", "Rebane", "Ilves", "Parn", "Koppel",
+	"Lepik", "Oja", "Kuusk", "Karu", "Vaher", "Lill", "Mets", "Raudsepp", "Luik", "Kallas",
+	"Smith", "Muller", "Virtanen", "Korhonen", "Novak", "Rossi", "Garcia", "Larsen", "Berg", "Ivanov",
+}
+
+var aboutOpeners = []string{
+	"Born and raised in %s.",
+	"Living in %s for a few years now.",
+	"Moved to %s for work and stayed for the people.",
+	"Happiest somewhere around %s.",
+}
+
+var languages = []string{"et", "en", "ru", "fi", "de", "fr", "es", "sv"}
+
+// Birthdates are drawn from a fixed range, so a seed gives the same users
+// whenever it runs
+var (
+	oldestBirthdate   = time.Date(1965, time.January, 1, 0, 0, 0, 0, time.UTC)
+	youngestBirthdate = time.Date(2005, time.December, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// preference is a code of a pref_* table and its description.
+type preference struct {
+	code        string
+	description string
+}
+
+func main() {
+	count := flag.Int("n", 100, "number of users to create")
+	seed := flag.Int64("seed", 1, "seed of the generator, the same seed creates the same users")
+	password := flag.String("password", "seed-password", "password of every created user")
+	country := flag.String("country", "EE", "country code of the home cities, empty for every city in the gazetteer")
+	likes := flag.Int("likes", 3, "likes each user sends, mutual likes become connections")
+	flag.Parse()
+
+	if *count < 1 || *likes < 0 || *likes >= *count {
+		flag.Usage()
+		log.Fatal("-n must be positive and -likes below -n")
+	}
+
+	if err := databaseSetup.InitDB(); err != nil {
+		log.Fatalf("Error initializing database: %v", err)
+	}
+	db := databaseSetup.GetDB()
+	if err := databaseSetup.Migrate(db); err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+
+	// User IDs come from uuid.New, they follow the seed too
+	rng := rand.New(rand.NewSource(*seed))
+	uuid.SetRand(rng)
+
+	cities, err := loadCities(db, *country)
+	if err != nil {
+		log.Fatalf("Error loading cities: %v", err)
+	}
+	if len(cities) == 0 {
+		log.Fatalf("No cities with country code %q in the gazetteer", *country)
+	}
+	prefs := map[string][]preference{}
+	for _, category := range matching.Categories {
+		if prefs[category], err = loadPreferences(db, category); err != nil {
+			log.Fatalf("Error loading %s preferences: %v", category, err)
+		}
+	}
+
+	var users []string
+	for i := 0; i < *count; i++ {
+		request := newUser(rng, i, cities, *password)
+		userID, err := routes.RegisterUser(db, request)
+		if err != nil {
+			log.Fatalf("Error registering %s: %v", request.Username, err)
+		}
+		if err := fillProfile(db, rng, userID, request.City, prefs); err != nil {
+			log.Fatalf("Error filling the profile of %s: %v", request.Username, err)
+		}
+		users = append(users, userID)
+	}
+
+	connections := 0
+	for _, userID := range users {
+		sent := 0
+		for _, i := range rng.Perm(len(users)) {
+			if sent == *likes {
+				break
+			}
+			if users[i] == userID {
+				continue
+			}
+			mutual, _, err := routes.RecordDecision(db, userID, users[i], routes.DecisionLike)
+			if err != nil {
+				log.Fatalf("Error recording like: %v", err)
+			}
+			if mutual {
+				connections++
+			}
+			sent++
+		}
+	}
+
+	if err := recompute(db, users); err != nil {
+		log.Fatalf("Error computing recommendations: %v", err)
+	}
+	fmt.Printf("Created %d users with %d connections, they log in with the password %q\n", len(users), connections, *password)
+}
+
+// loadCities returns the names of the home cities to choose from, the most
+// populous first.
+func loadCities(db *sql.DB, country string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT name FROM geo_cities
+		WHERE $1 = '' OR country_code = $1
+		ORDER BY population DESC, geoname_id`, country)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cities []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cities = append(cities, name)
+	}
+	return cities, rows.Err()
+}
+
+// loadPreferences returns the codes of a preference category with their descriptions.
+func loadPreferences(db *sql.DB, category string) ([]preference, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT %[1]s_code, %[1]s_description FROM pref_%[1]s ORDER BY %[1]s_code", category))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefs []preference
+	for rows.Next() {
+		var p preference
+		if err := rows.Scan(&p.code, &p.description); err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, p)
+	}
+	return prefs, rows.Err()
+}
+
+// newUser makes up the registration of the i-th user.
+func newUser(rng *rand.Rand, i int, cities []string, password string) structures.RegisterRequest {
+	first := firstNames[rng.Intn(len(firstNames))]
+	last := lastNames[rng.Intn(len(lastNames))]
+	username := fmt.Sprintf("%s.%s%d", strings.ToLower(first), strings.ToLower(last), i+1)
+
+	days := int(youngestBirthdate.Sub(oldestBirthdate).Hours() / 24)
+	birthdate := oldestBirthdate.AddDate(0, 0, rng.Intn(days+1))
+
+	// Squaring favours the front of the list, big cities get more people
+	city := cities[int(float64(len(cities))*rng.Float64()*rng.Float64())]
+
+	return structures.RegisterRequest{
+		Username:   username,
+		Email:      username + "@example.com",
+		FirstName:  first,
+		MiddleName: middleNames[rng.Intn(len(middleNames))],
+		LastName:   last,
+		Birthdate:  birthdate.Format(matching.BirthdateLayout),
+		Password:   password,
+		City:       city,
+	}
+}
+
+// fillProfile gives a registered user preferences, weights, a biography and
+// profile fields. Without a photo that is enough to be recommended.
+func fillProfile(db *sql.DB, rng *rand.Rand, userID, city string, prefs map[string][]preference) error {
+	chosen := map[string][]preference{}
+	for _, category := range matching.Categories {
+		chosen[category] = pick(rng, prefs[category], 1+rng.Intn(4))
+		var codes []string
+		for _, p := range chosen[category] {
+			codes = append(codes, p.code)
+		}
+		query := fmt.Sprintf("UPDATE profile_info SET %s = $1 WHERE user_uuid = $2", matching.PrefColumns[category])
+		if _, err := db.Exec(query, strings.Join(codes, ","), userID); err != nil {
+			return err
+		}
+	}
+
+	// Weights between 0.5 and 3 in steps of a half
+	weight := func() float64 { return float64(1+rng.Intn(6)) / 2 }
+	_, err := db.Exec(`
+		UPDATE weights
+		SET weigh_distance = $1, weigh_age = $2, weigh_food = $3, weigh_hobbies = $4, weigh_music = $5, datetime_updated = now()
+		WHERE user_uuid = $6`, weight(), weight(), weight(), weight(), weight(), userID)
+	if err != nil {
+		return err
+	}
+
+	about := fmt.Sprintf(aboutOpeners[rng.Intn(len(aboutOpeners))], city) +
+		fmt.Sprintf(" Into %s, %s and %s.",
+			strings.ToLower(chosen["hobby"][0].description),
+			strings.ToLower(chosen["music"][0].description),
+			strings.ToLower(chosen["food"][0].description))
+
+	var spoken []string
+	for _, i := range rng.Perm(len(languages))[:1+rng.Intn(3)] {
+		spoken = append(spoken, languages[i])
+	}
+	_, err = db.Exec(`
+		UPDATE profile_info
+		SET about_me = $1, height_cm = $2, languages = $3, relationship_goal = $4
+		WHERE user_uuid = $5`,
+		about, 155+rng.Intn(46), strings.Join(spoken, ","), profile.RelationshipGoals[rng.Intn(len(profile.RelationshipGoals))], userID)
+	return err
+}
+
+// pick returns n different preferences in a random order.
+func pick(rng *rand.Rand, prefs []preference, n int) []preference {
+	if n > len(prefs) {
+		n = len(prefs)
+	}
+	var picked []preference
+	for _, i := range rng.Perm(len(prefs))[:n] {
+		picked = append(picked, prefs[i])
+	}
+	return picked
+}
+
+// recompute scores every profile and rebuilds all recommendations at once,
+// instead of leaving a job per seeded user to the server's workers.
+func recompute(db *sql.DB, seeded []string) error {
+	rows, err := db.Query("SELECT user_uuid FROM user_info")
+	if err != nil {
+		return err
+	}
+	var users []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Candidates are filtered on completeness, so every score comes first
+	for _, userID := range users {
+		if err := matching.UpdateCompleteness(db, userID); err != nil {
+			return err
+		}
+	}
+	for _, userID := range users {
+		if err := matching.Recompute(db, userID); err != nil {
+			return err
+		}
+	}
+	for _, userID := range seeded {
+		if err := jobs.Cancel(db, jobs.KindProfileChanged, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
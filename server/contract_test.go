@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"match_me_module/api"
+	middleware "match_me_module/middleware"
+	"match_me_module/routes"
+	"match_me_module/storage"
+	"match_me_module/testdb"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+// The server the document lists, requests are matched against it
+const specServer = "http://localhost:3001"
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(api.Spec)
+	if err != nil {
+		t.Fatalf("Error loading the OpenAPI document: %v", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		t.Fatalf("The OpenAPI document is invalid: %v", err)
+	}
+	return doc
+}
+
+// TestSpecCoversRoutes needs no database, it keeps the document and the
+// router listing the same operations.
+func TestSpecCoversRoutes(t *testing.T) {
+	doc := loadSpec(t)
+
+	registered := map[string]bool{}
+	err := newRouter(nil).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		// The versioned subrouter itself only holds routes
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			registered[method+" "+path] = true
+			if item := doc.Paths.Value(path); item == nil || item.GetOperation(method) == nil {
+				t.Errorf("%s %s is not in the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error walking the router: %v", err)
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !registered[method+" "+path] {
+				t.Errorf("%s %s is documented but not routed", method, path)
+			}
+		}
+	}
+}
+
+// contract sends requests through the router and checks both the request
+// and the response against the document.
+type contract struct {
+	t      *testing.T
+	db     *testdb.DB
+	router *mux.Router
+	spec   routers.Router
+}
+
+func newContract(t *testing.T) *contract {
+	db := testdb.New(t)
+
+	store, err := storage.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating the photo store: %v", err)
+	}
+	routes.SetBlobStore(store)
+
+	// Binary responses are checked for their status and content type only
+	for _, contentType := range []string{"application/zip", "image/jpeg", "image/png", "text/event-stream"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.FileBodyDecoder)
+	}
+
+	spec, err := gorillamux.NewRouter(loadSpec(t))
+	if err != nil {
+		t.Fatalf("Error routing the OpenAPI document: %v", err)
+	}
+	return &contract{t: t, db: db, router: newRouter(nil), spec: spec}
+}
+
+// call sends a JSON body, or no body when it is nil.
+func (c *contract) call(method, path, token string, body interface{}, want int) *httptest.ResponseRecorder {
+	c.t.Helper()
+	if body == nil {
+		return c.send(method, path, token, "", nil, want, true)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		c.t.Fatalf("Error encoding request body: %v", err)
+	}
+	return c.send(method, path, token, "application/json", encoded, want, true)
+}
+
+// invalid sends a request the document rejects, the handler has to reject
+// it as well.
+func (c *contract) invalid(method, path, token string, body interface{}) {
+	c.t.Helper()
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		c.t.Fatalf("Error encoding request body: %v", err)
+	}
+	c.send(method, path, token, "application/json", encoded, http.StatusBadRequest, false)
+}
+
+func (c *contract) send(method, path, token, contentType string, body []byte, want int, valid bool) *httptest.ResponseRecorder {
+	c.t.Helper()
+	return c.sendContext(context.Background(), method, path, token, contentType, body, want, valid)
+}
+
+func (c *contract) sendContext(ctx context.Context, method, path, token, contentType string, body []byte, want int, valid bool) *httptest.ResponseRecorder {
+	c.t.Helper()
+	request := httptest.NewRequest(method, specServer+path, bytes.NewReader(body)).WithContext(ctx)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	route, params, err := c.spec.FindRoute(request)
+	if err != nil {
+		c.t.Fatalf("%s %s is not in the OpenAPI document: %v", method, path, err)
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    request,
+		PathParams: params,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	err = openapi3filter.ValidateRequest(ctx, input)
+	if valid && err != nil {
+		c.t.Errorf("Request %s %s does not match the document: %v", method, path, err)
+	}
+	if !valid && err == nil {
+		c.t.Errorf("Request %s %s should not match the document", method, path)
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorder := httptest.NewRecorder()
+	c.router.ServeHTTP(recorder, request)
+	if recorder.Code != want {
+		c.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, recorder.Code, want, recorder.Body.String())
+	}
+
+	output := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 recorder.Code,
+		Header:                 recorder.Header(),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	output.SetBodyBytes(recorder.Body.Bytes())
+	if err := openapi3filter.ValidateResponse(ctx, output); err != nil {
+		c.t.Errorf("Response of %s %s does not match the document: %v", method, path, err)
+	}
+	return recorder
+}
+
+func (c *contract) decode(recorder *httptest.ResponseRecorder, v interface{}) {
+	c.t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		c.t.Fatalf("Error decoding response: %v", err)
+	}
+}
+
+// register creates a user and logs in, it returns the token and user id.
+func (c *contract) register(username, password string) (string, string) {
+	c.t.Helper()
+	c.call("POST", "/api/v1/users", "", map[string]interface{}{
+		"username":    username,
+		"email":       username + "@example.com",
+		"first_name":  "Test",
+		"middle_name": "Contract",
+		"last_name":   "User",
+		"birthdate":   "1990-05-17",
+		"password":    password,
+		"user_city":   "Tallinn",
+	}, http.StatusOK)
+	token := c.login(username, password)
+
+	var info struct {
+		UserID string `json:"user_id"`
+	}
+	c.decode(c.call("GET", "/api/v1/me", token, nil, http.StatusOK), &info)
+	return token, info.UserID
+}
+
+func (c *contract) login(username, password string) string {
+	c.t.Helper()
+	var response struct {
+		Token string `json:"token"`
+	}
+	c.decode(c.call("POST", "/api/v1/sessions", "", map[string]string{"username": username, "password": password}, http.StatusOK), &response)
+	return response.Token
+}
+
+// testPhoto returns a PNG large enough to be accepted as a profile photo.
+func testPhoto(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 300; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Error encoding test photo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestContract(t *testing.T) {
+	c := newContract(t)
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	alice, aliceID := c.register("alice_"+suffix, "alice-password")
+	bob, bobID := c.register("bob_"+suffix, "bob-password")
+
+	c.call("GET", "/api/v1/openapi.json", "", nil, http.StatusOK)
+
+	// Requests outside the document are turned away by the handlers too
+	c.invalid("POST", "/api/v1/users", "", map[string]string{"username": "nobody_" + suffix})
+	c.invalid("PUT", "/api/v1/me/filters/age", alice, map[string]int{"min_age": 10})
+	c.invalid("PUT", "/api/v1/feed/"+bobID+"/decision", alice, map[string]string{"decision": "maybe"})
+	c.call("GET", "/api/v1/me", "", nil, http.StatusUnauthorized)
+
+	t.Run("account", func(t *testing.T) {
+		c.t = t
+		c.call("PUT", "/api/v1/me/username", alice, map[string]string{"username": "alice2_" + suffix}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/email", alice, map[string]string{"email": "alice2_" + suffix + "@example.com"}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/first-name", alice, map[string]string{"first_name": "Alice"}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/middle-name", alice, map[string]string{"middle_name": "Marie"}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/last-name", alice, map[string]string{"last_name": "Smith"}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/password", alice, map[string]string{"password": "alice-password2"}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/city", alice, map[string]string{"city": "Tartu"}, http.StatusOK)
+		c.call("GET", "/api/v1/me", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/me/onboarding", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/me/export", alice, nil, http.StatusOK)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		c.t = t
+		c.call("PUT", "/api/v1/me/about", alice, map[string]string{"newAbout": "I like long walks and good coffee."}, http.StatusOK)
+		c.call("GET", "/api/v1/me/about", alice, nil, http.StatusOK)
+		c.call("PUT", "/api/v1/me/birthdate", alice, map[string]string{"birthday": "1991-02-03"}, http.StatusOK)
+		c.call("GET", "/api/v1/me/birthdate", alice, nil, http.StatusOK)
+		c.call("PUT", "/api/v1/me/birthdate/privacy", alice, map[string]bool{"show_birthdate": true}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/fields", alice, map[string]interface{}{
+			"height_cm":         170,
+			"occupation":        "Engineer",
+			"languages":         []string{"en", "et"},
+			"relationship_goal": "long_term",
+		}, http.StatusOK)
+		c.call("GET", "/api/v1/me/fields", alice, nil, http.StatusOK)
+
+		var prompts []struct {
+			ID int `json:"id"`
+		}
+		c.decode(c.call("GET", "/api/v1/prompts", alice, nil, http.StatusOK), &prompts)
+		if len(prompts) == 0 {
+			t.Fatal("No prompts were seeded")
+		}
+		c.call("PUT", "/api/v1/me/answers", alice, map[string]interface{}{
+			"answers": []map[string]interface{}{{"prompt_id": prompts[0].ID, "answer": "Sunday mornings"}},
+		}, http.StatusOK)
+		c.call("GET", "/api/v1/me/answers", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/users/"+aliceID+"/profile", bob, nil, http.StatusOK)
+	})
+
+	t.Run("preferences", func(t *testing.T) {
+		c.t = t
+		var mappings map[string][]struct {
+			Code string `json:"code"`
+		}
+		c.decode(c.call("GET", "/api/v1/preferences", alice, nil, http.StatusOK), &mappings)
+		for _, category := range []string{"food", "hobby", "music"} {
+			if len(mappings[category]) == 0 {
+				t.Fatalf("No %s codes were seeded", category)
+			}
+			code := mappings[category][0].Code
+			c.call("POST", "/api/v1/me/preferences/"+category, alice, map[string]interface{}{"code": code}, http.StatusOK)
+			c.call("POST", "/api/v1/me/filters/"+category, alice, map[string]interface{}{"code": code, "mode": "required"}, http.StatusOK)
+			c.call("POST", "/api/v1/me/filters/"+category, alice, map[string]interface{}{"code": code, "mode": "required", "isUnchecked": true}, http.StatusOK)
+		}
+		c.call("GET", "/api/v1/me/preferences", alice, nil, http.StatusOK)
+
+		for _, weight := range []string{"distance", "age", "food", "hobby", "music"} {
+			c.call("PUT", "/api/v1/me/weights/"+weight, alice, map[string]float64{"number": 2}, http.StatusOK)
+		}
+		c.call("GET", "/api/v1/me/weights", alice, nil, http.StatusOK)
+
+		c.call("PUT", "/api/v1/me/filters/age", alice, map[string]int{"min_age": 20, "max_age": 60}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/distance", alice, map[string]float64{"max_distance": 300}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/height", alice, map[string]int{"min_height": 150, "max_height": 200}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/languages", alice, map[string][]string{"languages": {"en"}}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/goals", alice, map[string][]string{"goals": {"long_term"}}, http.StatusOK)
+		c.call("GET", "/api/v1/me/filters", alice, nil, http.StatusOK)
+
+		// Clear the filters again so bob stays a candidate
+		c.call("PUT", "/api/v1/me/filters/age", alice, map[string]interface{}{"min_age": nil, "max_age": nil}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/distance", alice, map[string]interface{}{"max_distance": nil}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/height", alice, map[string]interface{}{"min_height": nil, "max_height": nil}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/languages", alice, map[string]interface{}{"languages": nil}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/filters/goals", alice, map[string]interface{}{"goals": nil}, http.StatusOK)
+	})
+
+	t.Run("location", func(t *testing.T) {
+		c.t = t
+		c.call("PUT", "/api/v1/me/location", alice, map[string]float64{"latitude": 58.38, "longitude": 26.72, "accuracy": 50}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/location/mode", alice, map[string]string{"mode": "current"}, http.StatusOK)
+		c.call("GET", "/api/v1/me/location", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/cities?q=Tal&limit=5", "", nil, http.StatusOK)
+		c.call("GET", "/api/v1/cities/by-name?city=Tallinn", "", nil, http.StatusOK)
+		c.call("GET", "/api/v1/cities/nearest?lat=59.43&lon=24.75", "", nil, http.StatusOK)
+		c.call("GET", "/api/v1/cities/by-name?city=Atlantis", "", nil, http.StatusNotFound)
+	})
+
+	t.Run("matching", func(t *testing.T) {
+		c.t = t
+		c.call("GET", "/api/v1/recommendations", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/recommendations/"+bobID+"/explanation", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/users/nearby?radius=500&limit=10", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/feed?limit=5", alice, nil, http.StatusOK)
+		c.call("PUT", "/api/v1/feed/"+bobID+"/decision", alice, map[string]string{"decision": "like"}, http.StatusOK)
+		c.call("PUT", "/api/v1/feed/"+aliceID+"/decision", bob, map[string]string{"decision": "like"}, http.StatusOK)
+	})
+
+	t.Run("live", func(t *testing.T) {
+		c.t = t
+		var list struct {
+			Notifications []struct {
+				ID int64 `json:"id"`
+			} `json:"notifications"`
+		}
+		c.decode(c.call("GET", "/api/v1/notifications?limit=10&unread=true", alice, nil, http.StatusOK), &list)
+		c.call("POST", "/api/v1/notifications/read", alice, map[string][]int64{"ids": {}}, http.StatusOK)
+		c.call("GET", "/api/v1/notifications/preferences", alice, nil, http.StatusOK)
+		c.call("PUT", "/api/v1/notifications/preferences", alice, map[string]map[string]bool{"match": {"email": false}}, http.StatusOK)
+
+		// No hub is set up here, so the socket is unavailable
+		c.call("GET", "/api/v1/notifications/ws", alice, nil, http.StatusServiceUnavailable)
+		c.call("POST", "/api/v1/me/stream-tickets", alice, nil, http.StatusCreated)
+
+		// The stream ends with the request, which gives up after a moment
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		stream := c.sendContext(ctx, "GET", "/api/v1/events?last_event_id=0", alice, "", nil, http.StatusOK, true)
+		if !strings.HasPrefix(stream.Body.String(), "retry:") {
+			t.Errorf("Event stream does not start with the retry interval: %q", stream.Body.String())
+		}
+	})
+
+	t.Run("photos", func(t *testing.T) {
+		c.t = t
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("photo", "photo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(testPhoto(t))
+		form.Close()
+
+		var uploaded struct {
+			ID string `json:"id"`
+		}
+		c.decode(c.send("POST", "/api/v1/me/photos", alice, form.FormDataContentType(), body.Bytes(), http.StatusCreated, true), &uploaded)
+		c.call("GET", "/api/v1/me/photos", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/users/"+aliceID+"/photos", bob, nil, http.StatusOK)
+		c.call("GET", "/api/v1/photos/"+uploaded.ID+"/thumb", bob, nil, http.StatusOK)
+		c.call("PUT", "/api/v1/me/photos/order", alice, map[string][]string{"photo_ids": {uploaded.ID}}, http.StatusOK)
+		c.call("PUT", "/api/v1/me/photos/"+uploaded.ID+"/primary", alice, nil, http.StatusOK)
+		c.call("DELETE", "/api/v1/me/photos/"+uploaded.ID, alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/photos/"+uploaded.ID+"/full", alice, nil, http.StatusNotFound)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		c.t = t
+		c.call("GET", "/api/v1/admin/users", alice, nil, http.StatusForbidden)
+		if _, err := c.db.Exec("UPDATE user_table SET role = 'admin' WHERE user_uuid = $1", aliceID); err != nil {
+			t.Fatalf("Error promoting admin: %v", err)
+		}
+		// Like the handlers changing an account do, the role is not taken from
+		// the cache anymore. The old token carries the old role.
+		middleware.ForgetAccount(aliceID)
+		c.call("GET", "/api/v1/me", alice, nil, http.StatusUnauthorized)
+		alice = c.login("alice2_"+suffix, "alice-password2")
+		admin := alice
+
+		c.call("POST", "/api/v1/users/"+bobID+"/reports", alice, map[string]string{"category": "spam", "details": "Contract test"}, http.StatusOK)
+		var reports []struct {
+			ID         int    `json:"id"`
+			ReportedID string `json:"reported_id"`
+		}
+		c.decode(c.call("GET", "/api/v1/admin/reports?status=open&limit=200", admin, nil, http.StatusOK), &reports)
+		reportID := 0
+		for _, report := range reports {
+			if report.ReportedID == bobID {
+				reportID = report.ID
+			}
+		}
+		if reportID == 0 {
+			t.Fatal("The report is not listed")
+		}
+		c.call("PUT", fmt.Sprintf("/api/v1/admin/reports/%d/status", reportID), admin, map[string]string{"status": "reviewed"}, http.StatusOK)
+
+		c.call("GET", "/api/v1/admin/users?q="+suffix+"&limit=10&offset=0", admin, nil, http.StatusOK)
+		c.call("PUT", "/api/v1/admin/users/"+bobID+"/status", admin, map[string]interface{}{"status": "suspended", "days": 1, "reason": "Contract test"}, http.StatusOK)
+		c.call("PUT", "/api/v1/admin/users/"+bobID+"/status", admin, map[string]string{"status": "active"}, http.StatusOK)
+
+		c.call("PUT", "/api/v1/admin/preferences/food", admin, map[string]string{"code": "Z9", "description": "Contract test food"}, http.StatusOK)
+		c.call("DELETE", "/api/v1/admin/preferences/food/Z9", admin, nil, http.StatusOK)
+
+		var created struct {
+			ID int `json:"id"`
+		}
+		c.decode(c.call("POST", "/api/v1/admin/prompts", admin, map[string]string{"question": "Contract test " + suffix + "?"}, http.StatusCreated), &created)
+		c.call("PATCH", fmt.Sprintf("/api/v1/admin/prompts/%d", created.ID), admin, map[string]bool{"active": false}, http.StatusOK)
+		c.call("GET", "/api/v1/admin/prompts", admin, nil, http.StatusOK)
+		c.call("GET", "/api/v1/admin/audit-log?limit=5", admin, nil, http.StatusOK)
+
+		// The unversioned routes still work until the sunset and are counted
+		c.call("GET", "/api/user", admin, nil, http.StatusOK)
+		var calls map[string]int64
+		c.decode(c.call("GET", "/api/v1/admin/deprecations", admin, nil, http.StatusOK), &calls)
+		if calls["GET /api/user"] == 0 {
+			t.Errorf("The call of GET /api/user is not counted: %v", calls)
+		}
+
+		// bob has to pick a new password before logging in again
+		c.call("POST", "/api/v1/admin/users/"+bobID+"/password-reset", admin, nil, http.StatusOK)
+		c.call("POST", "/api/v1/sessions", "", map[string]string{"username": "bob_" + suffix, "password": "bob-password"}, http.StatusForbidden)
+		c.call("POST", "/api/v1/sessions", "", map[string]string{
+			"username": "bob_" + suffix, "password": "bob-password", "new_password": "bob-password2",
+		}, http.StatusOK)
+		bob = c.login("bob_"+suffix, "bob-password2")
+	})
+
+	t.Run("safety", func(t *testing.T) {
+		c.t = t
+		c.call("PUT", "/api/v1/me/blocks/"+bobID, alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/me/blocks", alice, nil, http.StatusOK)
+		c.call("GET", "/api/v1/users/"+aliceID+"/profile", bob, nil, http.StatusNotFound)
+		c.call("DELETE", "/api/v1/me/blocks/"+bobID, alice, nil, http.StatusOK)
+		c.call("DELETE", "/api/v1/me/blocks/"+bobID, alice, nil, http.StatusNotFound)
+	})
+
+	t.Run("deletion", func(t *testing.T) {
+		c.t = t
+		c.call("DELETE", "/api/v1/me", bob, map[string]string{"password": "bob-password2"}, http.StatusOK)
+		c.call("POST", "/api/v1/me/restore", "", map[string]string{"username": "bob_" + suffix, "password": "bob-password2"}, http.StatusOK)
+		c.call("POST", "/api/v1/me/restore", "", map[string]string{"username": "bob_" + suffix, "password": "bob-password2"}, http.StatusConflict)
+	})
+}
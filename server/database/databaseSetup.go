@@ -1,11 +1,13 @@
 package databaseSetup
 
 import (
+	"bufio"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -17,6 +19,9 @@ const (
 	database    = "match_me_db"
 	newUser     = "kood_user"
 	newUserPass = "kood_johvi"
+
+	// Bundled cities file in the GeoNames dump format used for geocoding
+	gazetteerFile = "../server/data/cities.txt"
 )
 
 var db *sql.DB
@@ -116,23 +121,53 @@ func SetupDatabase() error {
 	}
 	fmt.Printf("Connected to the new database '%s'.\n", database)
 
-	_, err = newDB.Exec(`CREATE EXTENSION IF NOT EXISTS postgis;`)
+	if err := Migrate(newDB); err != nil {
+		return err
+	}
+
+	err = promoteAdmins(newDB, os.Getenv("ADMIN_USERNAMES"))
+	if err != nil {
+		return fmt.Errorf("error promoting admins: %v", err)
+	}
+
+	fmt.Println("Setup completed.")
+	return nil
+}
+
+// Migrate brings the schema of an existing database up to date and fills in
+// the reference data. It is safe to run on every start, tests run it against
+// their own database.
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS postgis;`)
 	if err != nil {
 		return fmt.Errorf("error adding PostGIS extension: %v", err)
 	}
 	fmt.Println("PostGIS extension added to the database.")
 
-	err = createTables(newDB)
+	err = createTables(db)
 	if err != nil {
 		return fmt.Errorf("error creating tables: %v", err)
 	}
 
-	err = mapMappingTables(newDB)
+	err = alterTables(db)
+	if err != nil {
+		return fmt.Errorf("error altering tables: %v", err)
+	}
+
+	err = mapMappingTables(db)
 	if err != nil {
 		return fmt.Errorf("error mapping tables: %v", err)
 	}
 
-	fmt.Println("Setup completed.")
+	err = seedPrompts(db)
+	if err != nil {
+		return fmt.Errorf("error seeding prompts: %v", err)
+	}
+
+	err = loadGazetteer(db, gazetteerFile)
+	if err != nil {
+		return fmt.Errorf("error loading gazetteer: %v", err)
+	}
 	return nil
 }
 
@@ -200,6 +235,19 @@ func createTables(db *sql.DB) error {
 			weigh_hobbies NUMERIC,
 			weigh_music NUMERIC
 		);`,
+		`CREATE TABLE IF NOT EXISTS match_filters (
+			id SERIAL PRIMARY KEY,
+			user_uuid UUID UNIQUE,
+			min_age INTEGER,
+			max_age INTEGER,
+			max_distance_km NUMERIC,
+			food_required VARCHAR(1000),
+			food_excluded VARCHAR(1000),
+			hobby_required VARCHAR(1000),
+			hobby_excluded VARCHAR(1000),
+			music_required VARCHAR(1000),
+			music_excluded VARCHAR(1000)
+		);`,
 		`CREATE TABLE IF NOT EXISTS pending_connections (
 			user_uuid_of UUID,
 			user_uuid_with UUID
@@ -214,6 +262,140 @@ func createTables(db *sql.DB) error {
 			compability NUMERIC,
 			distance NUMERIC
 		);`,
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id BIGSERIAL PRIMARY KEY,
+			kind VARCHAR(50),
+			user_uuid UUID,
+			status VARCHAR(20),
+			attempts INTEGER,
+			max_attempts INTEGER,
+			run_at TIMESTAMPTZ,
+			last_error TEXT,
+			datetime_created TIMESTAMPTZ,
+			datetime_updated TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (run_at, id) WHERE status = 'pending';`,
+		`CREATE TABLE IF NOT EXISTS blocks (
+			blocker_uuid UUID,
+			blocked_uuid UUID,
+			datetime_created TIMESTAMP,
+			PRIMARY KEY (blocker_uuid, blocked_uuid)
+		);`,
+		`CREATE INDEX IF NOT EXISTS user_data_register_location_gix ON user_data USING GIST (register_location);`,
+		`CREATE INDEX IF NOT EXISTS user_data_browser_location_gix ON user_data USING GIST (browser_location);`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor_uuid UUID,
+			action VARCHAR(50),
+			target VARCHAR(100),
+			details JSONB,
+			datetime_created TIMESTAMPTZ DEFAULT now()
+		);`,
+		`CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;`,
+		`DROP TRIGGER IF EXISTS audit_log_no_change ON audit_log;`,
+		`CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();`,
+		`DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;`,
+		`CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+			FOR EACH STATEMENT EXECUTE FUNCTION audit_log_immutable();`,
+		`CREATE TABLE IF NOT EXISTS reports (
+			id SERIAL PRIMARY KEY,
+			reporter_uuid UUID,
+			reported_uuid UUID,
+			category VARCHAR(30),
+			details TEXT,
+			status VARCHAR(20) DEFAULT 'open',
+			datetime_created TIMESTAMPTZ
+		);`,
+		`CREATE TABLE IF NOT EXISTS decisions (
+			user_uuid_of UUID,
+			user_uuid_with UUID,
+			decision VARCHAR(10),
+			datetime_created TIMESTAMPTZ,
+			PRIMARY KEY (user_uuid_of, user_uuid_with)
+		);`,
+		`CREATE TABLE IF NOT EXISTS feed_impressions (
+			session_id VARCHAR(32),
+			user_uuid_of UUID,
+			user_uuid_with UUID,
+			datetime_created TIMESTAMPTZ,
+			PRIMARY KEY (session_id, user_uuid_of, user_uuid_with)
+		);`,
+		`CREATE TABLE IF NOT EXISTS photos (
+			id SERIAL PRIMARY KEY,
+			photo_uuid UUID UNIQUE,
+			user_uuid UUID,
+			position INTEGER,
+			is_primary BOOLEAN DEFAULT false,
+			content_type VARCHAR(20),
+			extension VARCHAR(5),
+			width INTEGER,
+			height INTEGER,
+			datetime_created TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS photos_user_idx ON photos (user_uuid, position);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS photos_one_primary_idx ON photos (user_uuid) WHERE is_primary;`,
+		`CREATE TABLE IF NOT EXISTS prompts (
+			id SERIAL PRIMARY KEY,
+			question VARCHAR(200) UNIQUE,
+			active BOOLEAN DEFAULT true,
+			datetime_created TIMESTAMPTZ
+		);`,
+		`CREATE TABLE IF NOT EXISTS profile_prompts (
+			user_uuid UUID,
+			prompt_id INTEGER REFERENCES prompts (id),
+			answer VARCHAR(300),
+			position INTEGER,
+			PRIMARY KEY (user_uuid, prompt_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id BIGSERIAL PRIMARY KEY,
+			user_uuid UUID,
+			kind VARCHAR(30),
+			actor_uuid UUID,
+			payload JSONB,
+			read_at TIMESTAMPTZ,
+			datetime_created TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_uuid, id DESC);`,
+		`CREATE TABLE IF NOT EXISTS notification_prefs (
+			user_uuid UUID,
+			kind VARCHAR(30),
+			in_app BOOLEAN,
+			email BOOLEAN,
+			push BOOLEAN,
+			PRIMARY KEY (user_uuid, kind)
+		);`,
+		`CREATE TABLE IF NOT EXISTS event_log (
+			id BIGSERIAL PRIMARY KEY,
+			user_uuid UUID,
+			type VARCHAR(30),
+			data JSONB,
+			datetime_created TIMESTAMPTZ
+		);`,
+		`CREATE INDEX IF NOT EXISTS event_log_user_idx ON event_log (user_uuid, id);`,
+		`CREATE TABLE IF NOT EXISTS stream_tickets (
+			ticket_hash CHAR(64) PRIMARY KEY,
+			user_uuid UUID,
+			expires_at TIMESTAMPTZ,
+			token_expires_at TIMESTAMPTZ
+		);`,
+		`CREATE TABLE IF NOT EXISTS geo_cities (
+			id SERIAL PRIMARY KEY,
+			geoname_id INTEGER UNIQUE,
+			name VARCHAR(200),
+			ascii_name VARCHAR(200),
+			alternate_names TEXT,
+			country_code VARCHAR(2),
+			population BIGINT,
+			location GEOGRAPHY(POINT, 4326)
+		);`,
+		`CREATE INDEX IF NOT EXISTS geo_cities_location_gix ON geo_cities USING GIST (location);`,
+		`CREATE INDEX IF NOT EXISTS geo_cities_ascii_name_idx ON geo_cities (lower(ascii_name) text_pattern_ops);`,
 	}
 
 	for _, query := range tables {
@@ -226,6 +408,66 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
+// Adds columns introduced after the initial schema to existing tables.
+func alterTables(db *sql.DB) error {
+	columns := []string{
+		`ALTER TABLE user_data ADD COLUMN IF NOT EXISTS browser_location_at TIMESTAMPTZ;`,
+		`ALTER TABLE user_data ADD COLUMN IF NOT EXISTS browser_accuracy NUMERIC;`,
+		`ALTER TABLE user_data ADD COLUMN IF NOT EXISTS location_mode VARCHAR(10) DEFAULT 'home';`,
+		`ALTER TABLE user_table ADD COLUMN IF NOT EXISTS role VARCHAR(20) DEFAULT 'user';`,
+		`ALTER TABLE user_table ADD COLUMN IF NOT EXISTS account_status VARCHAR(20) DEFAULT 'active';`,
+		`ALTER TABLE user_table ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMPTZ;`,
+		`ALTER TABLE user_table ADD COLUMN IF NOT EXISTS must_reset_password BOOLEAN DEFAULT false;`,
+		`ALTER TABLE user_table ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMPTZ;`,
+		`ALTER TABLE weights ADD COLUMN IF NOT EXISTS datetime_updated TIMESTAMPTZ;`,
+		`ALTER TABLE profile_info ADD COLUMN IF NOT EXISTS completeness INTEGER;`,
+		`ALTER TABLE profile_info ADD COLUMN IF NOT EXISTS show_birthdate BOOLEAN NOT NULL DEFAULT false;`,
+		`ALTER TABLE profile_info ADD COLUMN IF NOT EXISTS height_cm INTEGER;`,
+		`ALTER TABLE profile_info ADD COLUMN IF NOT EXISTS occupation VARCHAR(100);`,
+		`ALTER TABLE profile_info ADD COLUMN IF NOT EXISTS languages VARCHAR(100);`,
+		`ALTER TABLE profile_info ADD COLUMN IF NOT EXISTS relationship_goal VARCHAR(20);`,
+		`ALTER TABLE match_filters ADD COLUMN IF NOT EXISTS min_height INTEGER;`,
+		`ALTER TABLE match_filters ADD COLUMN IF NOT EXISTS max_height INTEGER;`,
+		`ALTER TABLE match_filters ADD COLUMN IF NOT EXISTS languages_required VARCHAR(100);`,
+		`ALTER TABLE match_filters ADD COLUMN IF NOT EXISTS goals_required VARCHAR(100);`,
+		// Account purges are retried without limit, this includes the ones queued or given up on before
+		`UPDATE jobs
+		SET max_attempts = 0,
+		    run_at = CASE WHEN status = 'dead' THEN now() ELSE run_at END,
+		    status = CASE WHEN status = 'dead' THEN 'pending' ELSE status END
+		WHERE kind = 'account_deletion' AND max_attempts <> 0;`,
+	}
+
+	for _, query := range columns {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("error adding column: %v", err)
+		}
+	}
+
+	fmt.Println("All columns added.")
+	return nil
+}
+
+// Gives the admin role to the users in a comma separated list of usernames.
+func promoteAdmins(db *sql.DB, usernames string) error {
+	for _, username := range strings.Split(usernames, ",") {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			continue
+		}
+		result, err := db.Exec(`
+			UPDATE user_table SET role = 'admin'
+			WHERE user_uuid = (SELECT user_uuid FROM user_info WHERE username = $1)`, username)
+		if err != nil {
+			return fmt.Errorf("error promoting %s: %v", username, err)
+		}
+		if promoted, _ := result.RowsAffected(); promoted == 0 {
+			log.Printf("Admin user %s does not exist yet", username)
+		}
+	}
+	return nil
+}
+
 func mapMappingTablesFunctionInternal(db *sql.DB) error {
 	queries := []string{
 		`INSERT INTO pref_food (food_code, food_description) VALUES 
@@ -316,6 +558,107 @@ func mapMappingTables(db *sql.DB) error {
 	return nil
 }
 
+// Adds a starting set of profile prompts, admins manage them afterwards.
+func seedPrompts(db *sql.DB) error {
+	isEmpty, err := checkIfTableIsEmpty(db, "prompts")
+	if err != nil {
+		return err
+	}
+	if !isEmpty {
+		return nil
+	}
+
+	_, err = db.Exec(`INSERT INTO prompts (question, datetime_created) VALUES
+		('My ideal weekend', now()),
+		('A fact about me that surprises people', now()),
+		('The way to win me over is', now()),
+		('I geek out on', now()),
+		('My most irrational fear', now()),
+		('We will get along if', now());`)
+	if err != nil {
+		return fmt.Errorf("error inserting prompts: %v", err)
+	}
+	fmt.Println("Profile prompts seeded.")
+	return nil
+}
+
+// Loads the cities of a GeoNames style dump into the geo_cities table, skipped when the table already has rows.
+func loadGazetteer(db *sql.DB, path string) error {
+	isEmpty, err := checkIfTableIsEmpty(db, "geo_cities")
+	if err != nil {
+		return err
+	}
+	if !isEmpty {
+		log.Println("Gazetteer already loaded, skipping.")
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer file.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO geo_cities (geoname_id, name, ascii_name, alternate_names, country_code, population, location)
+		VALUES ($1, $2, $3, $4, $5, $6, ST_SetSRID(ST_MakePoint($7, $8), 4326))
+		ON CONFLICT (geoname_id) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("error preparing insert: %v", err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // Alternate names can make lines long
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// GeoNames columns: geonameid, name, asciiname, alternatenames, latitude, longitude,
+		// feature class, feature code, country code, cc2, admin1-4, population, ...
+		fields := strings.Split(text, "\t")
+		if len(fields) < 15 {
+			return fmt.Errorf("line %d: expected at least 15 columns, got %d", line, len(fields))
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid geonameid: %v", line, err)
+		}
+		latitude, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid latitude: %v", line, err)
+		}
+		longitude, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid longitude: %v", line, err)
+		}
+		population, _ := strconv.ParseInt(fields[14], 10, 64)
+
+		_, err = stmt.Exec(id, fields[1], fields[2], strings.ToLower(fields[3]), fields[8], population, longitude, latitude)
+		if err != nil {
+			return fmt.Errorf("line %d: error inserting city: %v", line, err)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing gazetteer: %v", err)
+	}
+	fmt.Printf("Gazetteer loaded with %d cities.\n", count)
+	return nil
+}
+
 func InitDB() error {
 
 	var err error
@@ -334,6 +677,12 @@ func InitDB() error {
 	return nil
 }
 
+// SetDB replaces the connection returned by GetDB, tests use it to point the
+// handlers at their own database.
+func SetDB(conn *sql.DB) {
+	db = conn
+}
+
 func GetDB() *sql.DB {
 	if db == nil {
 		InitDB()
@@ -0,0 +1,159 @@
+// Package events keeps a short log of live updates per user, which clients
+// follow over a Server-Sent Events stream. The log lets a client that lost
+// its connection resume from the last event it saw.
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	TypeNewRecommendation  = "new_recommendation"
+	TypeConnectionRequest  = "connection_request"
+	TypeConnectionAccepted = "connection_accepted"
+	TypeProfileViewed      = "profile_viewed"
+)
+
+const (
+	// Retention is how long events can be resumed from.
+	Retention = 24 * time.Hour
+
+	// MaxStreamsPerUser is how many streams a user can keep open at once.
+	MaxStreamsPerUser = 3
+)
+
+// ErrTooManyStreams is returned by Subscribe when the user is at MaxStreamsPerUser.
+var ErrTooManyStreams = fmt.Errorf("at most %d event streams per user", MaxStreamsPerUser)
+
+// Event is a row of the event_log table.
+type Event struct {
+	ID   int64
+	Type string
+	Data json.RawMessage
+}
+
+// Publish appends an event for a user and wakes up their streams on this
+// server. Streams on other instances pick it up with their next poll.
+func Publish(db *sql.DB, userID, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %v", eventType, err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO event_log (user_uuid, type, data, datetime_created)
+		VALUES ($1, $2, $3, now())`, userID, eventType, encoded); err != nil {
+		return fmt.Errorf("error saving %s event: %v", eventType, err)
+	}
+
+	// Every publish clears the expired events of the same user
+	if _, err := db.Exec("DELETE FROM event_log WHERE user_uuid = $1 AND datetime_created < $2",
+		userID, time.Now().Add(-Retention)); err != nil {
+		return fmt.Errorf("error pruning events: %v", err)
+	}
+
+	wake(userID)
+	return nil
+}
+
+// PublishOnce is Publish, unless an event with the same type and data was
+// already published for the user within the given time.
+func PublishOnce(db *sql.DB, userID, eventType string, data interface{}, within time.Duration) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %v", eventType, err)
+	}
+	var recent bool
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM event_log
+		               WHERE user_uuid = $1 AND type = $2 AND data = $3::jsonb AND datetime_created > $4)`,
+		userID, eventType, encoded, time.Now().Add(-within)).Scan(&recent)
+	if err != nil {
+		return fmt.Errorf("error checking recent %s events: %v", eventType, err)
+	}
+	if recent {
+		return nil
+	}
+	return Publish(db, userID, eventType, data)
+}
+
+// Since returns up to limit events of a user after the given id, oldest first.
+func Since(db *sql.DB, userID string, afterID int64, limit int) ([]Event, error) {
+	rows, err := db.Query(`
+		SELECT id, type, data FROM event_log
+		WHERE user_uuid = $1 AND id > $2 AND datetime_created >= $3
+		ORDER BY id
+		LIMIT $4`, userID, afterID, time.Now().Add(-Retention), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.Data); err != nil {
+			return nil, fmt.Errorf("error scanning event: %v", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// LatestID returns the id of the newest event of a user, zero if there is none.
+func LatestID(db *sql.DB, userID string) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT coalesce(max(id), 0) FROM event_log WHERE user_uuid = $1", userID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error querying latest event: %v", err)
+	}
+	return id, nil
+}
+
+// The streams open on this server, a stream is woken by a send on its channel
+var (
+	mu      sync.Mutex
+	streams = map[string]map[chan struct{}]bool{}
+)
+
+// Subscribe registers a stream of the user. The returned channel receives a
+// value whenever new events may be available, cancel must be called when
+// the stream ends.
+func Subscribe(userID string) (<-chan struct{}, func(), error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(streams[userID]) >= MaxStreamsPerUser {
+		return nil, nil, ErrTooManyStreams
+	}
+	if streams[userID] == nil {
+		streams[userID] = map[chan struct{}]bool{}
+	}
+	ch := make(chan struct{}, 1)
+	streams[userID][ch] = true
+
+	cancel := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(streams[userID], ch)
+		if len(streams[userID]) == 0 {
+			delete(streams, userID)
+		}
+	}
+	return ch, cancel, nil
+}
+
+func wake(userID string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for ch := range streams[userID] {
+		// A pending wake-up already covers this event
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package geocode
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxMismatchKm is how far the submitted coordinates may be from the named
+// city before the two are considered to contradict each other.
+const MaxMismatchKm = 50
+
+var (
+	ErrUnknownCity        = errors.New("unknown city")
+	ErrInvalidCoordinates = errors.New("invalid coordinates")
+	ErrLocationMismatch   = errors.New("coordinates do not match the city")
+)
+
+// City is a row of the geo_cities table.
+type City struct {
+	Name        string  `json:"name"`
+	CountryCode string  `json:"country_code"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Population  int64   `json:"population"`
+	DistanceKm  float64 `json:"distance_km"`
+}
+
+// Columns selected for a City, distance is filled in by the caller's query.
+const cityColumns = `name, country_code, ST_Y(location::geometry), ST_X(location::geometry), population`
+
+// nameMatches is true when the city is known under the name $1 (lower case).
+const nameMatches = `(lower(name) = $1 OR lower(ascii_name) = $1 OR $1 = ANY(string_to_array(alternate_names, ',')))`
+
+func scanCities(rows *sql.Rows) ([]City, error) {
+	defer rows.Close()
+
+	cities := []City{}
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.Name, &c.CountryCode, &c.Latitude, &c.Longitude, &c.Population, &c.DistanceKm); err != nil {
+			return nil, fmt.Errorf("error scanning city: %v", err)
+		}
+		cities = append(cities, c)
+	}
+	return cities, rows.Err()
+}
+
+// ValidCoordinates reports whether a position lies on the globe and is not
+// the (0,0) placeholder sent when a client has no position.
+func ValidCoordinates(latitude, longitude float64) bool {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return false
+	}
+	return latitude != 0 || longitude != 0
+}
+
+// Autocomplete returns the most populous cities whose name starts with prefix.
+func Autocomplete(db *sql.DB, prefix string, limit int) ([]City, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return []City{}, nil
+	}
+
+	// Escape LIKE wildcards so they match literally
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+
+	rows, err := db.Query(`
+		SELECT `+cityColumns+`, 0
+		FROM geo_cities
+		WHERE lower(ascii_name) LIKE $1 OR lower(name) LIKE $1
+		ORDER BY population DESC, name
+		LIMIT $2`, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cities: %v", err)
+	}
+	return scanCities(rows)
+}
+
+// Resolve returns the most populous city known under the given name.
+func Resolve(db *sql.DB, name string) (City, error) {
+	rows, err := db.Query(`
+		SELECT `+cityColumns+`, 0
+		FROM geo_cities
+		WHERE `+nameMatches+`
+		ORDER BY population DESC
+		LIMIT 1`, strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return City{}, fmt.Errorf("error resolving city: %v", err)
+	}
+	cities, err := scanCities(rows)
+	if err != nil {
+		return City{}, err
+	}
+	if len(cities) == 0 {
+		return City{}, ErrUnknownCity
+	}
+	return cities[0], nil
+}
+
+// Reverse returns the city closest to the given position.
+func Reverse(db *sql.DB, latitude, longitude float64) (City, error) {
+	if !ValidCoordinates(latitude, longitude) {
+		return City{}, ErrInvalidCoordinates
+	}
+
+	rows, err := db.Query(`
+		SELECT `+cityColumns+`, ST_Distance(location, p.point) / 1000
+		FROM geo_cities
+		CROSS JOIN (SELECT ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography AS point) p
+		ORDER BY location <-> p.point
+		LIMIT 1`, longitude, latitude)
+	if err != nil {
+		return City{}, fmt.Errorf("error reverse geocoding: %v", err)
+	}
+	cities, err := scanCities(rows)
+	if err != nil {
+		return City{}, err
+	}
+	if len(cities) == 0 {
+		return City{}, ErrUnknownCity
+	}
+	return cities[0], nil
+}
+
+// Validate checks that a city name and a position agree and returns the
+// matching gazetteer city. When no position is given (0,0) the position of
+// the named city is used instead.
+func Validate(db *sql.DB, name string, latitude, longitude float64) (City, error) {
+	if latitude == 0 && longitude == 0 {
+		return Resolve(db, name)
+	}
+	if !ValidCoordinates(latitude, longitude) {
+		return City{}, ErrInvalidCoordinates
+	}
+
+	// Several cities can share a name, pick the one closest to the position
+	rows, err := db.Query(`
+		SELECT `+cityColumns+`, ST_Distance(location, p.point) / 1000
+		FROM geo_cities
+		CROSS JOIN (SELECT ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography AS point) p
+		WHERE `+nameMatches+`
+		ORDER BY location <-> p.point
+		LIMIT 1`, strings.ToLower(strings.TrimSpace(name)), longitude, latitude)
+	if err != nil {
+		return City{}, fmt.Errorf("error validating city: %v", err)
+	}
+	cities, err := scanCities(rows)
+	if err != nil {
+		return City{}, err
+	}
+	if len(cities) == 0 {
+		return City{}, ErrUnknownCity
+	}
+	if cities[0].DistanceKm > MaxMismatchKm {
+		return cities[0], ErrLocationMismatch
+	}
+	return cities[0], nil
+}
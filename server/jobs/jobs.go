@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Job kinds
+const (
+	KindProfileChanged  = "profile_changed"
+	KindAccountDeletion = "account_deletion"
+)
+
+// Job statuses
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+const (
+	// DefaultMaxAttempts is how often a job is tried before it is moved to the dead state.
+	DefaultMaxAttempts = 5
+
+	// Unlimited as the max attempts of a job retries it until it succeeds.
+	Unlimited = 0
+
+	// Retry delays start at baseBackoff and double after every failed attempt up to maxBackoff.
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 10 * time.Minute
+
+	// How long an idle worker waits before looking for new jobs.
+	pollInterval = time.Second
+
+	// Jobs left running for longer than this are assumed to belong to a crashed worker.
+	staleAfter = 15 * time.Minute
+
+	// Finished jobs are kept this long for inspection.
+	keepDone = 7 * 24 * time.Hour
+)
+
+// maxAttempts overrides DefaultMaxAttempts for kinds that must not be given
+// up on. A purge that failed for good would keep the data of an account its
+// owner asked to delete.
+var maxAttempts = map[string]int{
+	KindAccountDeletion: Unlimited,
+}
+
+// MaxAttempts returns how often a job of the kind is tried.
+func MaxAttempts(kind string) int {
+	if attempts, ok := maxAttempts[kind]; ok {
+		return attempts
+	}
+	return DefaultMaxAttempts
+}
+
+// Job is a claimed row of the jobs table.
+type Job struct {
+	ID          int64
+	Kind        string
+	UserID      string
+	Attempts    int
+	MaxAttempts int
+}
+
+// Handler processes a job, returning an error schedules a retry.
+type Handler func(db *sql.DB, job Job) error
+
+// Sweep is housekeeping the cleanup loop runs every hour, like removing rows
+// that expired. A failure is logged and tried again the next hour.
+type Sweep func(db *sql.DB) error
+
+// Execer is implemented by both *sql.DB and *sql.Tx, so a job can be queued
+// in the transaction of the change that needs it.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue adds a job for a user that runs as soon as possible, unless one that
+// is due is already waiting.
+func Enqueue(db Execer, kind, userID string) error {
+	return EnqueueAt(db, kind, userID, time.Now())
+}
+
+// EnqueueAt adds a job for a user that runs no earlier than runAt, unless a
+// waiting one already covers it: one due for the same time, or for a job that
+// is due now, any job that is due as well. A job waiting for a different time
+// never absorbs the new one, so delayed work is not lost to an immediate job
+// and an immediate job is not held back by a delayed one.
+func EnqueueAt(db Execer, kind, userID string, runAt time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO jobs (kind, user_uuid, status, attempts, max_attempts, run_at, datetime_created, datetime_updated)
+		SELECT $1, $2, $3, 0, $4, $5, now(), now()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM jobs
+			WHERE kind = $1 AND user_uuid = $2 AND status = $3
+			  AND (run_at = $5 OR (run_at <= now() AND $5 <= now()))
+		)`, kind, userID, StatusPending, MaxAttempts(kind), runAt)
+	if err != nil {
+		return fmt.Errorf("error enqueueing %s job: %v", kind, err)
+	}
+	return nil
+}
+
+// Cancel removes the waiting jobs of a kind for a user.
+func Cancel(db Execer, kind, userID string) error {
+	_, err := db.Exec("DELETE FROM jobs WHERE kind = $1 AND user_uuid = $2 AND status = $3", kind, userID, StatusPending)
+	if err != nil {
+		return fmt.Errorf("error cancelling %s job: %v", kind, err)
+	}
+	return nil
+}
+
+// Backoff returns the delay before the next try of a job that failed attempts times.
+func Backoff(attempts int) time.Duration {
+	// Far beyond the cap, and 2^attempts would overflow for jobs retried without limit
+	if attempts > 30 {
+		return maxBackoff
+	}
+	delay := time.Duration(float64(baseBackoff) * math.Pow(2, float64(attempts-1)))
+	if delay > maxBackoff || delay <= 0 {
+		return maxBackoff
+	}
+	return delay
+}
+
+// Start launches the given number of workers in the background, together
+// with a cleanup loop running the sweeps by name.
+func Start(db *sql.DB, workers int, handlers map[string]Handler, sweeps map[string]Sweep) {
+	if err := requeueStale(db); err != nil {
+		log.Printf("Error requeueing stale jobs: %v", err)
+	}
+	for i := 0; i < workers; i++ {
+		go work(db, handlers)
+	}
+	go cleanup(db, sweeps)
+}
+
+// work claims and runs jobs until the process exits.
+func work(db *sql.DB, handlers map[string]Handler) {
+	for {
+		job, err := claim(db)
+		if err != nil {
+			log.Printf("Error claiming job: %v", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		if job == nil {
+			time.Sleep(pollInterval)
+			continue
+		}
+		run(db, *job, handlers)
+	}
+}
+
+// claim locks the oldest due job, other workers skip over it instead of waiting.
+func claim(db *sql.DB) (*Job, error) {
+	var job Job
+	err := db.QueryRow(`
+		UPDATE jobs
+		SET status = $1, attempts = attempts + 1, datetime_updated = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = $2 AND run_at <= now()
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, kind, user_uuid, attempts, max_attempts`, StatusRunning, StatusPending).
+		Scan(&job.ID, &job.Kind, &job.UserID, &job.Attempts, &job.MaxAttempts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func run(db *sql.DB, job Job, handlers map[string]Handler) {
+	handler, ok := handlers[job.Kind]
+	var err error
+	giveUp := job.MaxAttempts != Unlimited && job.Attempts >= job.MaxAttempts
+	if !ok {
+		err = fmt.Errorf("no handler for job kind %s", job.Kind)
+		giveUp = true // Retrying cannot help
+	} else {
+		err = safeRun(handler, db, job)
+	}
+
+	if err == nil {
+		_, err = db.Exec("UPDATE jobs SET status = $1, last_error = NULL, datetime_updated = now() WHERE id = $2", StatusDone, job.ID)
+		if err != nil {
+			log.Printf("Error completing job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	if giveUp {
+		log.Printf("Job %d (%s for %s) failed for good after %d attempts: %v", job.ID, job.Kind, job.UserID, job.Attempts, err)
+		_, dbErr := db.Exec("UPDATE jobs SET status = $1, last_error = $2, datetime_updated = now() WHERE id = $3", StatusDead, err.Error(), job.ID)
+		if dbErr != nil {
+			log.Printf("Error moving job %d to the dead state: %v", job.ID, dbErr)
+		}
+		return
+	}
+
+	delay := Backoff(job.Attempts)
+	log.Printf("Job %d (%s for %s) failed, retrying in %v: %v", job.ID, job.Kind, job.UserID, delay, err)
+	_, dbErr := db.Exec(`
+		UPDATE jobs
+		SET status = $1, last_error = $2, run_at = now() + $3 * interval '1 millisecond', datetime_updated = now()
+		WHERE id = $4`, StatusPending, err.Error(), delay.Milliseconds(), job.ID)
+	if dbErr != nil {
+		log.Printf("Error rescheduling job %d: %v", job.ID, dbErr)
+	}
+}
+
+// safeRun turns a panicking handler into a failed attempt instead of a dead worker.
+func safeRun(handler Handler, db *sql.DB, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(db, job)
+}
+
+// requeueStale returns jobs stuck in the running state to the queue.
+func requeueStale(db *sql.DB) error {
+	_, err := db.Exec(`
+		UPDATE jobs SET status = $1, datetime_updated = now()
+		WHERE status = $2 AND datetime_updated < now() - $3 * interval '1 second'`,
+		StatusPending, StatusRunning, int(staleAfter.Seconds()))
+	return err
+}
+
+// cleanup periodically requeues stale jobs, removes old finished ones and
+// runs the sweeps.
+func cleanup(db *sql.DB, sweeps map[string]Sweep) {
+	for range time.Tick(time.Hour) {
+		for name, sweep := range sweeps {
+			if err := sweep(db); err != nil {
+				log.Printf("Error sweeping %s: %v", name, err)
+			}
+		}
+		if err := requeueStale(db); err != nil {
+			log.Printf("Error requeueing stale jobs: %v", err)
+		}
+		_, err := db.Exec("DELETE FROM jobs WHERE status = $1 AND datetime_updated < now() - $2 * interval '1 second'",
+			StatusDone, int(keepDone.Seconds()))
+		if err != nil {
+			log.Printf("Error removing finished jobs: %v", err)
+		}
+	}
+}
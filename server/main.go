@@ -1,16 +1,25 @@
 package main
 
 import (
+	"database/sql"
 	"log"
 	databaseSetup "match_me_module/database"
+	"match_me_module/jobs"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"match_me_module/notify"
 	"match_me_module/routes"
+	"match_me_module/storage"
 	"net/http"
 	"os"
+	"strings"
 
-	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
+// Number of background workers processing the job queue
+const recommendationWorkers = 2
+
 func main() {
 	// Open or create a log file
 	logFile, err := os.OpenFile("server.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
@@ -34,43 +43,65 @@ func main() {
 		log.Fatalf("Error initializing database: %v", err)
 	}
 
-	// Create the router
-	r := mux.NewRouter()
-
-	// Define API routes
-	r.HandleFunc("/api/user", routes.UserInfo).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/login", routes.Login).Methods("POST")
-	r.HandleFunc("/api/register", routes.Register).Methods("POST")
-	r.HandleFunc("/api/edit/user", routes.EditUsername).Methods("POST")
-	r.HandleFunc("/api/edit/email", routes.EditEmail).Methods("POST")
-	r.HandleFunc("/api/edit/first", routes.EditFirst).Methods("POST")
-	r.HandleFunc("/api/edit/middle", routes.EditMiddle).Methods("POST")
-	r.HandleFunc("/api/edit/last", routes.EditLast).Methods("POST")
-	r.HandleFunc("/api/edit/pass", routes.EditPassword).Methods("POST")
-	r.HandleFunc("/api/edit/city", routes.EditCity).Methods("POST")
-	r.HandleFunc("/api/biog/about", routes.AboutYou).Methods("POST")
-	r.HandleFunc("/api/biog/birthday", routes.Birthday).Methods("POST")
-	r.HandleFunc("/api/biog/aboutget", routes.AboutYouGet).Methods("GET")
-	r.HandleFunc("/api/biog/birthdayget", routes.BirthdayGet).Methods("GET")
-	r.HandleFunc("/api/pref/food", routes.FoodPref).Methods("POST")
-	r.HandleFunc("/api/pref/hobby", routes.HobbyPref).Methods("POST")
-	r.HandleFunc("/api/pref/music", routes.MusicPref).Methods("POST")
-	r.HandleFunc("/api/pref/get", routes.PrefGet).Methods("GET")
-	r.HandleFunc("/api/pref/mapget", routes.PrefMappingGet).Methods("GET")
-	r.HandleFunc("/api/wigh/dist", routes.WeightDistance).Methods("POST")
-	r.HandleFunc("/api/wigh/age", routes.WeightAge).Methods("POST")
-	r.HandleFunc("/api/wigh/food", routes.WeightFood).Methods("POST")
-	r.HandleFunc("/api/wigh/hobby", routes.WeightHobbies).Methods("POST")
-	r.HandleFunc("/api/wigh/music", routes.WeightMusic).Methods("POST")
-	r.HandleFunc("/api/wigh/get", routes.WeightGet).Methods("GET")
+	// Profiles created before completeness was tracked are scored once
+	if err := matching.BackfillCompleteness(databaseSetup.GetDB()); err != nil {
+		log.Fatalf("Error scoring profile completeness: %v", err)
+	}
+
+	// Pick the scoring strategy for recommendations
+	scorer, err := matching.NewScorer(os.Getenv("MATCH_SCORER"), os.Getenv("MATCH_DISTANCE_DECAY"))
+	if err != nil {
+		log.Fatalf("Error configuring scorer: %v", err)
+	}
+	matching.SetScorer(scorer)
+	log.Println("Scoring recommendations with " + scorer.Name())
+
+	// Load the keys tokens are signed and verified with
+	middleware.LoadKeys()
+
+	// Open the storage for uploaded photos
+	blobStore, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Error opening blob store: %v", err)
+	}
+	routes.SetBlobStore(blobStore)
+
+	// Set up the channels notifications are delivered over
+	mailer, err := notify.MailerFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring mailer: %v", err)
+	}
+	hub := notify.NewHub()
+	routes.SetNotifications(notify.NewCenter(notify.InApp{}, notify.NewEmail(mailer), notify.NewPush(hub)), hub)
+
+	// Start the workers that keep recommendations up to date
+	jobs.Start(databaseSetup.GetDB(), recommendationWorkers, map[string]jobs.Handler{
+		jobs.KindProfileChanged: func(db *sql.DB, job jobs.Job) error {
+			return matching.RecomputeUser(db, job.UserID)
+		},
+		jobs.KindAccountDeletion: func(db *sql.DB, job jobs.Job) error {
+			return routes.PurgeAccount(db, job.UserID)
+		},
+	}, map[string]jobs.Sweep{
+		"feed impressions": routes.PruneFeedImpressions,
+		"stream tickets":   routes.PruneStreamTickets,
+	})
+
+	// Limit how fast each client may call the API
+	limiter, err := middleware.RateLimiterFromEnv(rateLimits)
+	if err != nil {
+		log.Fatalf("Error configuring rate limits: %v", err)
+	}
 
 	// Set up CORS middleware
+	log.Println("Allowing browser requests from " + strings.Join(middleware.AllowedOrigins(), ", "))
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"}, // Allow React frontend
+		AllowedOrigins:   middleware.AllowedOrigins(), // The web clients from CORS_ORIGINS
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},        // Include OPTIONS for preflight
-		AllowedHeaders:   []string{"Authorization", "Content-Type"}, // Headers expected by the client
-	}).Handler(r)
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},     // Include OPTIONS for preflight
+		AllowedHeaders:   []string{"Authorization", "Content-Type", middleware.CSRFHeader}, // Headers expected by the client
+		ExposedHeaders:   []string{"Deprecation", "Sunset", "Link", "Retry-After"},         // Lets the client notice deprecated routes and wait out rate limits
+	}).Handler(newRouter(limiter))
 
 	// Define server port
 	port := "3001"
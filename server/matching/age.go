@@ -0,0 +1,70 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MinimumAge is the youngest a user may be to register or keep a birthdate.
+const MinimumAge = 18
+
+// Birthdates further back than this are taken for typos.
+const maximumAge = 120
+
+// BirthdateLayout is the only accepted birthdate format, YYYY-MM-DD.
+const BirthdateLayout = "2006-01-02"
+
+var (
+	ErrInvalidBirthdate = errors.New("birthdate must be a valid date in YYYY-MM-DD format")
+	ErrFutureBirthdate  = errors.New("birthdate cannot be in the future")
+	ErrTooYoung         = fmt.Errorf("you must be at least %d years old", MinimumAge)
+	ErrTooOld           = fmt.Errorf("birthdate cannot be more than %d years ago", maximumAge)
+)
+
+// ParseBirthdate strictly parses a birthdate and checks the user is old
+// enough on the given day. The result is midnight UTC of that date.
+func ParseBirthdate(value string, now time.Time) (time.Time, error) {
+	// time.Parse accepts no trailing time and rejects days like 2001-02-30
+	birthdate, err := time.Parse(BirthdateLayout, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidBirthdate
+	}
+	if birthdate.After(today(now)) {
+		return time.Time{}, ErrFutureBirthdate
+	}
+	age := Age(birthdate, now)
+	if age < MinimumAge {
+		return time.Time{}, ErrTooYoung
+	}
+	if age > maximumAge {
+		return time.Time{}, ErrTooOld
+	}
+	return birthdate, nil
+}
+
+// Age returns the age in whole years on the day of now. Only the calendar
+// date of birthdate is used and the day is taken in UTC, like AgeSQL, so the
+// result does not depend on the time zone of the server or the database.
+// Someone born on 29 February turns a year older on 1 March in common years.
+func Age(birthdate, now time.Time) int {
+	// The date as written, converting to UTC could move it to the day before
+	year, month, dayOfMonth := birthdate.Date()
+	day := today(now)
+	age := day.Year() - year
+	if day.Month() < month || (day.Month() == month && day.Day() < dayOfMonth) {
+		age--
+	}
+	return age
+}
+
+// AgeSQL returns an expression computing the age in whole years from a DATE
+// column, counting days the same way as Age.
+func AgeSQL(column string) string {
+	return fmt.Sprintf("EXTRACT(YEAR FROM age((now() AT TIME ZONE 'UTC')::date, %s))::int", column)
+}
+
+func today(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,97 @@
+package matching
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	east := time.FixedZone("UTC+2", 2*60*60)
+	west := time.FixedZone("UTC-5", -5*60*60)
+
+	tests := []struct {
+		name      string
+		birthdate time.Time
+		now       time.Time
+		want      int
+	}{
+		{"day before the birthday", utc(2000, time.June, 15, 0, 0), utc(2026, time.June, 14, 12, 0), 25},
+		{"day of the birthday", utc(2000, time.June, 15, 0, 0), utc(2026, time.June, 15, 0, 0), 26},
+		{"day after the birthday", utc(2000, time.June, 15, 0, 0), utc(2026, time.June, 16, 0, 0), 26},
+		{"earlier month", utc(2000, time.June, 15, 0, 0), utc(2026, time.May, 31, 0, 0), 25},
+
+		// Born on 29 February
+		{"leap day, 28 February of a common year", utc(2004, time.February, 29, 0, 0), utc(2025, time.February, 28, 23, 59), 20},
+		{"leap day, 1 March of a common year", utc(2004, time.February, 29, 0, 0), utc(2025, time.March, 1, 0, 0), 21},
+		{"leap day, 28 February of a leap year", utc(2004, time.February, 29, 0, 0), utc(2028, time.February, 28, 0, 0), 23},
+		{"leap day, 29 February of a leap year", utc(2004, time.February, 29, 0, 0), utc(2028, time.February, 29, 0, 0), 24},
+
+		// The day is the UTC one, whatever the zone of now
+		{"last minute before the birthday in UTC", utc(2000, time.June, 15, 0, 0), utc(2026, time.June, 14, 23, 59), 25},
+		{"birthday already begun east of UTC", utc(2000, time.June, 15, 0, 0), time.Date(2026, time.June, 15, 1, 0, 0, 0, east), 25},
+		{"birthday not begun yet west of UTC", utc(2000, time.June, 15, 0, 0), time.Date(2026, time.June, 14, 20, 0, 0, 0, west), 26},
+
+		// Only the calendar date of the birthdate counts
+		{"birthdate east of UTC", time.Date(2000, time.June, 15, 0, 0, 0, 0, east), utc(2026, time.June, 14, 12, 0), 25},
+		{"birthdate late in the day", utc(2000, time.June, 15, 23, 59), utc(2026, time.June, 15, 0, 0), 26},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Age(tt.birthdate, tt.now); got != tt.want {
+				t.Errorf("Age(%v, %v): got %d, want %d", tt.birthdate, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBirthdate(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		now   time.Time
+		err   error
+	}{
+		{"adult", "1990-05-01", now, nil},
+		{"turns 18 today", "2008-10-19", now, nil},
+		{"turns 18 tomorrow", "2008-10-20", now, ErrTooYoung},
+		{"born today", "2026-10-19", now, ErrTooYoung},
+		{"born tomorrow", "2026-10-20", now, ErrFutureBirthdate},
+		{"120 until tomorrow", "1905-10-20", now, nil},
+		{"turned 121 today", "1905-10-19", now, ErrTooOld},
+
+		// 18 on 1 March in common years
+		{"leap day, 28 February at 18", "2008-02-29", time.Date(2026, time.February, 28, 12, 0, 0, 0, time.UTC), ErrTooYoung},
+		{"leap day, 1 March at 18", "2008-02-29", time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC), nil},
+
+		// 18 when the day begins in UTC
+		{"last minute before turning 18", "2008-10-20", time.Date(2026, time.October, 19, 23, 59, 0, 0, time.UTC), ErrTooYoung},
+		{"turns 18 at midnight UTC", "2008-10-20", time.Date(2026, time.October, 20, 0, 0, 0, 0, time.UTC), nil},
+		{"evening west of UTC is tomorrow", "2008-10-20", time.Date(2026, time.October, 19, 22, 0, 0, 0, time.FixedZone("UTC-3", -3*60*60)), nil},
+		{"future in UTC only", "2026-10-20", time.Date(2026, time.October, 20, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60)), ErrFutureBirthdate},
+
+		{"empty", "", now, ErrInvalidBirthdate},
+		{"no such day", "2001-02-29", now, ErrInvalidBirthdate},
+		{"unpadded", "1990-5-1", now, ErrInvalidBirthdate},
+		{"with a time", "1990-05-01T00:00:00Z", now, ErrInvalidBirthdate},
+		{"other order", "01-05-1990", now, ErrInvalidBirthdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			birthdate, err := ParseBirthdate(tt.value, tt.now)
+			if err != tt.err {
+				t.Fatalf("ParseBirthdate(%q): got error %v, want %v", tt.value, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := birthdate.Format(BirthdateLayout); got != tt.value || birthdate.Location() != time.UTC || birthdate.Hour() != 0 {
+				t.Errorf("ParseBirthdate(%q): got %v, want midnight UTC of the date", tt.value, birthdate)
+			}
+		})
+	}
+}
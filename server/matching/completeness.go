@@ -0,0 +1,163 @@
+package matching
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// MatchableCompleteness is the completeness a profile needs before it is
+// recommended to anyone.
+const MatchableCompleteness = 70
+
+// Shortest about_me text that counts as filled in.
+const minAboutLength = 20
+
+// Onboarding states, derived from the completeness score
+const (
+	OnboardingIncomplete = "incomplete" // below MatchableCompleteness, hidden from others
+	OnboardingMatchable  = "matchable"  // recommended, some steps left
+	OnboardingComplete   = "complete"   // every step done
+)
+
+// Step is one part of a profile that counts towards its completeness.
+type Step struct {
+	Name   string `json:"step"`
+	Points int    `json:"points"`
+	Hint   string `json:"hint"`
+}
+
+// Steps in the order onboarding walks through them, the points add up to 100.
+var Steps = []Step{
+	{"city", 10, "Set the city you live in"},
+	{"birthdate", 20, "Add your date of birth"},
+	{"photo", 20, "Upload at least one photo"},
+	{"about_me", 15, fmt.Sprintf("Write at least %d characters about yourself", minAboutLength)},
+	{"food", 10, "Pick your food preferences"},
+	{"hobby", 10, "Pick your hobbies"},
+	{"music", 10, "Pick your music taste"},
+	{"weights", 5, "Tell us what matters most to you in a match"},
+}
+
+// ProfileFacts is what completeness is computed from.
+type ProfileFacts struct {
+	HasCity      bool
+	HasBirthdate bool
+	Photos       int
+	AboutMe      string
+	Prefs        map[string][]string
+	WeightsSet   bool // the user changed at least one weight since registering
+}
+
+// Completeness is the result of checking a profile against Steps.
+type Completeness struct {
+	Score    int    `json:"completeness"`
+	State    string `json:"state"`
+	Missing  []Step `json:"missing"`
+	NextStep *Step  `json:"next_step"`
+}
+
+// ProfileCompleteness adds up the points of the finished steps.
+func ProfileCompleteness(f ProfileFacts) Completeness {
+	done := map[string]bool{
+		"city":      f.HasCity,
+		"birthdate": f.HasBirthdate,
+		"photo":     f.Photos > 0,
+		"about_me":  len([]rune(strings.TrimSpace(f.AboutMe))) >= minAboutLength,
+		"food":      len(f.Prefs["food"]) > 0,
+		"hobby":     len(f.Prefs["hobby"]) > 0,
+		"music":     len(f.Prefs["music"]) > 0,
+		"weights":   f.WeightsSet,
+	}
+
+	c := Completeness{Missing: []Step{}}
+	for _, step := range Steps {
+		if done[step.Name] {
+			c.Score += step.Points
+		} else {
+			c.Missing = append(c.Missing, step)
+		}
+	}
+	if len(c.Missing) > 0 {
+		c.NextStep = &c.Missing[0]
+	}
+
+	switch {
+	case len(c.Missing) == 0:
+		c.State = OnboardingComplete
+	case c.Score >= MatchableCompleteness:
+		c.State = OnboardingMatchable
+	default:
+		c.State = OnboardingIncomplete
+	}
+	return c
+}
+
+// LoadCompleteness reads a user's profile and scores it.
+func LoadCompleteness(db *sql.DB, userID string) (Completeness, error) {
+	var f ProfileFacts
+	var about, food, hobby, music sql.NullString
+	err := db.QueryRow(`
+		SELECT d.register_location IS NOT NULL, i.birthdate IS NOT NULL,
+		       (SELECT count(*) FROM photos ph WHERE ph.user_uuid = i.user_uuid),
+		       p.about_me, p.food_myvariabledata, p.hobbies_myvariabledata, p.music_myvariabledata,
+		       coalesce(w.datetime_updated IS NOT NULL, false)
+		FROM user_info i
+		LEFT JOIN user_data d ON d.user_uuid = i.user_uuid
+		LEFT JOIN profile_info p ON p.user_uuid = i.user_uuid
+		LEFT JOIN weights w ON w.user_uuid = i.user_uuid
+		WHERE i.user_uuid = $1`, userID).
+		Scan(&f.HasCity, &f.HasBirthdate, &f.Photos, &about, &food, &hobby, &music, &f.WeightsSet)
+	if err != nil {
+		return Completeness{}, fmt.Errorf("error querying profile of %s: %v", userID, err)
+	}
+	f.AboutMe = about.String
+	f.Prefs = map[string][]string{"food": SplitCodes(food), "hobby": SplitCodes(hobby), "music": SplitCodes(music)}
+	return ProfileCompleteness(f), nil
+}
+
+// UpdateCompleteness stores the current completeness of a user in profile_info,
+// where loadCandidates reads it.
+func UpdateCompleteness(db *sql.DB, userID string) error {
+	c, err := LoadCompleteness(db, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE profile_info SET completeness = $1 WHERE user_uuid = $2", c.Score, userID); err != nil {
+		return fmt.Errorf("error saving completeness of %s: %v", userID, err)
+	}
+	return nil
+}
+
+// BackfillCompleteness scores every profile that has no completeness yet,
+// such as the ones created before it was tracked.
+func BackfillCompleteness(db *sql.DB) error {
+	rows, err := db.Query("SELECT user_uuid FROM profile_info WHERE completeness IS NULL")
+	if err != nil {
+		return fmt.Errorf("error querying profiles: %v", err)
+	}
+	var users []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning profile: %v", err)
+		}
+		users = append(users, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading profiles: %v", err)
+	}
+
+	for _, userID := range users {
+		if err := UpdateCompleteness(db, userID); err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("Scored the completeness of %d profiles", len(users))
+	}
+	return nil
+}
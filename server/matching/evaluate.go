@@ -0,0 +1,224 @@
+package matching
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Snapshot is an offline copy of the data scorers work on together with the
+// connection outcomes used to judge them.
+type Snapshot struct {
+	TakenAt  time.Time      `json:"taken_at"`
+	Users    []SnapshotUser `json:"users"`
+	Outcomes []Outcome      `json:"outcomes"`
+}
+
+// SnapshotUser holds a user's rows from user_info, user_data, profile_info and weights.
+type SnapshotUser struct {
+	UserID    string              `json:"user_id"`
+	Age       *int                `json:"age"`
+	Latitude  float64             `json:"latitude"`
+	Longitude float64             `json:"longitude"`
+	Prefs     map[string][]string `json:"prefs"`
+	Weights   Weights             `json:"weights"`
+}
+
+// Outcome records a connection request and whether it was accepted.
+type Outcome struct {
+	Of       string `json:"of"`
+	With     string `json:"with"`
+	Accepted bool   `json:"accepted"`
+}
+
+// Metrics summarises how well a scorer ranks the candidates users connected with.
+type Metrics struct {
+	Scorer  string `json:"scorer"`
+	K       int    `json:"k"`
+	Viewers int    `json:"viewers"` // users with at least one outcome
+
+	// Share of the top K candidates that are accepted connections.
+	PrecisionAtK float64 `json:"precision_at_k"`
+	// Share of a user's accepted connections found in their top K.
+	RecallAtK float64 `json:"recall_at_k"`
+	// Share of requests ranked in the top K that were accepted.
+	AcceptanceRate float64 `json:"acceptance_rate"`
+	// Mean of 1/rank of the best ranked accepted connection.
+	MRR float64 `json:"mrr"`
+}
+
+// ExportSnapshot reads the current state of the database into a Snapshot.
+func ExportSnapshot(db *sql.DB) (Snapshot, error) {
+	snapshot := Snapshot{TakenAt: time.Now().UTC()}
+
+	rows, err := db.Query(`
+		SELECT i.user_uuid, ` + AgeSQL("i.birthdate") + `,
+		       ST_Y(d.register_location::geometry), ST_X(d.register_location::geometry),
+		       p.food_myvariabledata, p.hobbies_myvariabledata, p.music_myvariabledata,
+		       w.weigh_distance, w.weigh_age, w.weigh_food, w.weigh_hobbies, w.weigh_music
+		FROM user_info i
+		JOIN user_data d ON d.user_uuid = i.user_uuid
+		JOIN profile_info p ON p.user_uuid = i.user_uuid
+		JOIN weights w ON w.user_uuid = i.user_uuid
+		WHERE d.register_location IS NOT NULL`)
+	if err != nil {
+		return snapshot, fmt.Errorf("error querying users: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u SnapshotUser
+		var age sql.NullInt64
+		var food, hobby, music sql.NullString
+		err := rows.Scan(&u.UserID, &age, &u.Latitude, &u.Longitude, &food, &hobby, &music,
+			&u.Weights.Distance, &u.Weights.Age, &u.Weights.Food, &u.Weights.Hobbies, &u.Weights.Music)
+		if err != nil {
+			return snapshot, fmt.Errorf("error scanning user: %v", err)
+		}
+		if age.Valid {
+			v := int(age.Int64)
+			u.Age = &v
+		}
+		u.Prefs = map[string][]string{"food": SplitCodes(food), "hobby": SplitCodes(hobby), "music": SplitCodes(music)}
+		snapshot.Users = append(snapshot.Users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return snapshot, fmt.Errorf("error reading users: %v", err)
+	}
+
+	// A pair found in real_connections was accepted, one only in pending_connections was not (yet)
+	outcomeRows, err := db.Query(`
+		SELECT user_uuid_of, user_uuid_with, bool_or(accepted)
+		FROM (
+			SELECT user_uuid_of, user_uuid_with, true AS accepted FROM real_connections
+			UNION ALL
+			SELECT user_uuid_of, user_uuid_with, false AS accepted FROM pending_connections
+		) outcomes
+		GROUP BY user_uuid_of, user_uuid_with`)
+	if err != nil {
+		return snapshot, fmt.Errorf("error querying connections: %v", err)
+	}
+	defer outcomeRows.Close()
+
+	for outcomeRows.Next() {
+		var o Outcome
+		if err := outcomeRows.Scan(&o.Of, &o.With, &o.Accepted); err != nil {
+			return snapshot, fmt.Errorf("error scanning connection: %v", err)
+		}
+		snapshot.Outcomes = append(snapshot.Outcomes, o)
+	}
+	return snapshot, outcomeRows.Err()
+}
+
+// Evaluate replays the snapshot with a scorer. Every user with an outcome
+// gets all other users ranked, and the ranking is compared to the outcomes.
+func Evaluate(snapshot Snapshot, s Scorer, k int) Metrics {
+	m := Metrics{Scorer: s.Name(), K: k}
+
+	users := make(map[string]SnapshotUser, len(snapshot.Users))
+	for _, u := range snapshot.Users {
+		users[u.UserID] = u
+	}
+	outcomes := map[string]map[string]bool{}
+	for _, o := range snapshot.Outcomes {
+		if outcomes[o.Of] == nil {
+			outcomes[o.Of] = map[string]bool{}
+		}
+		outcomes[o.Of][o.With] = outcomes[o.Of][o.With] || o.Accepted
+	}
+
+	var precisionSum, recallSum, reciprocalSum float64
+	var recallViewers, requestsInTopK, acceptedInTopK int
+
+	for viewerID, requests := range outcomes {
+		viewerRow, ok := users[viewerID]
+		if !ok {
+			continue
+		}
+		m.Viewers++
+
+		viewer := Profile{UserID: viewerID, Age: viewerRow.Age, Prefs: viewerRow.Prefs}
+		type ranked struct {
+			userID string
+			score  float64
+		}
+		var ranking []ranked
+		for _, c := range snapshot.Users {
+			if c.UserID == viewerID {
+				continue
+			}
+			candidate := Profile{
+				UserID:     c.UserID,
+				Age:        c.Age,
+				Prefs:      c.Prefs,
+				DistanceKm: HaversineKm(viewerRow.Latitude, viewerRow.Longitude, c.Latitude, c.Longitude),
+			}
+			ranking = append(ranking, ranked{c.UserID, Score(s, viewerRow.Weights, viewer, candidate)})
+		}
+		sort.Slice(ranking, func(i, j int) bool {
+			if ranking[i].score != ranking[j].score {
+				return ranking[i].score > ranking[j].score
+			}
+			return ranking[i].userID < ranking[j].userID
+		})
+
+		accepted, hits := 0, 0
+		for _, ok := range requests {
+			if ok {
+				accepted++
+			}
+		}
+		firstHit := 0
+		for rank, r := range ranking {
+			wasAccepted, requested := requests[r.userID]
+			if wasAccepted && firstHit == 0 {
+				firstHit = rank + 1
+			}
+			if rank >= k || !requested {
+				continue
+			}
+			requestsInTopK++
+			if wasAccepted {
+				acceptedInTopK++
+				hits++
+			}
+		}
+
+		if k > 0 {
+			precisionSum += float64(hits) / float64(k)
+		}
+		if accepted > 0 {
+			recallViewers++
+			recallSum += float64(hits) / float64(accepted)
+		}
+		if firstHit > 0 {
+			reciprocalSum += 1 / float64(firstHit)
+		}
+	}
+
+	if m.Viewers > 0 {
+		m.PrecisionAtK = precisionSum / float64(m.Viewers)
+		m.MRR = reciprocalSum / float64(m.Viewers)
+	}
+	if recallViewers > 0 {
+		m.RecallAtK = recallSum / float64(recallViewers)
+	}
+	if requestsInTopK > 0 {
+		m.AcceptanceRate = float64(acceptedInTopK) / float64(requestsInTopK)
+	}
+	return m
+}
+
+// HaversineKm returns the great-circle distance between two positions.
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
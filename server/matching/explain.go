@@ -0,0 +1,105 @@
+package matching
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lib/pq"
+)
+
+// ErrUnknownCandidate is returned when the candidate of an explanation does not exist.
+var ErrUnknownCandidate = errors.New("unknown candidate")
+
+// Explanation breaks down the compability between a viewer and a candidate.
+type Explanation struct {
+	UserID      string              `json:"user_id"`
+	Compability float64             `json:"compability"`
+	Scorer      string              `json:"scorer"`
+	DistanceKm  float64             `json:"distance_km"`
+	Components  []Component         `json:"components"`
+	Shared      map[string][]string `json:"shared"`      // category -> descriptions of shared preferences
+	ExcludedBy  *string             `json:"excluded_by"` // filter that keeps the candidate out of the recommendations
+}
+
+// Explain scores a single candidate for the viewer the same way Recompute
+// does, but keeps every intermediate value.
+func Explain(db *sql.DB, viewerID, candidateID string) (Explanation, error) {
+	e := Explanation{UserID: candidateID}
+
+	weights, err := LoadWeights(db, viewerID)
+	if err != nil {
+		return e, err
+	}
+	filters, err := LoadFilters(db, viewerID)
+	if err != nil {
+		return e, err
+	}
+	viewer, err := loadProfile(db, viewerID)
+	if err != nil {
+		return e, err
+	}
+
+	// Load the candidate without filters so the failing one can be named
+	candidates, err := loadCandidates(db, viewerID, Filters{}, &candidateID)
+	if err != nil {
+		return e, err
+	}
+	if len(candidates) == 0 {
+		return e, ErrUnknownCandidate
+	}
+	candidate := candidates[0]
+
+	e.Scorer = current.Name()
+	e.Components = current.Components(weights, viewer, candidate)
+	e.Compability = Score(current, weights, viewer, candidate)
+	e.DistanceKm = math.Round(candidate.DistanceKm*10) / 10
+	if rejected := Rejects(filters, candidate); rejected != "" {
+		e.ExcludedBy = &rejected
+	} else if candidate.Completeness < MatchableCompleteness {
+		incomplete := "incomplete_profile"
+		e.ExcludedBy = &incomplete
+	}
+
+	e.Shared = map[string][]string{}
+	for _, category := range Categories {
+		var shared []string
+		inViewer := unique(viewer.Prefs[category])
+		for code := range unique(candidate.Prefs[category]) {
+			if inViewer[code] {
+				shared = append(shared, code)
+			}
+		}
+		descriptions, err := describe(db, category, shared)
+		if err != nil {
+			return e, err
+		}
+		e.Shared[category] = descriptions
+	}
+	return e, nil
+}
+
+// describe looks up the descriptions of preference codes in the pref_* table of the category.
+func describe(db *sql.DB, category string, codes []string) ([]string, error) {
+	descriptions := []string{}
+	if len(codes) == 0 {
+		return descriptions, nil
+	}
+
+	query := fmt.Sprintf("SELECT %[1]s_description FROM pref_%[1]s WHERE %[1]s_code = ANY($1) ORDER BY %[1]s_code", category)
+	rows, err := db.Query(query, pq.Array(codes))
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s descriptions: %v", category, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var description string
+		if err := rows.Scan(&description); err != nil {
+			return nil, fmt.Errorf("error scanning %s description: %v", category, err)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions, rows.Err()
+}
@@ -0,0 +1,38 @@
+package matching
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Location modes a user can choose between for matching.
+const (
+	LocationModeHome    = "home"
+	LocationModeCurrent = "current"
+)
+
+// BrowserLocationMaxAge is how long a browser position is trusted. Older
+// positions are ignored and the home city is used instead.
+const BrowserLocationMaxAge = 24 * time.Hour
+
+// BrowserLocationPrecision is the number of decimals browser coordinates are
+// rounded to before they are stored, two decimals is roughly one kilometre.
+const BrowserLocationPrecision = 2
+
+// Coarsen rounds a coordinate to BrowserLocationPrecision decimals.
+func Coarsen(coordinate float64) float64 {
+	scale := math.Pow(10, BrowserLocationPrecision)
+	return math.Round(coordinate*scale) / scale
+}
+
+// LocationSQL returns the SQL expression for the location a user_data row is
+// matched by: the browser location when the user chose current-location
+// matching and the position is fresh, the registered home city otherwise.
+func LocationSQL(alias string) string {
+	return fmt.Sprintf(`(CASE WHEN %[1]s.location_mode = '%[2]s'
+		AND %[1]s.browser_location IS NOT NULL
+		AND %[1]s.browser_location_at > now() - interval '%[3]d seconds'
+		THEN %[1]s.browser_location ELSE %[1]s.register_location END)`,
+		alias, LocationModeCurrent, int(BrowserLocationMaxAge.Seconds()))
+}
@@ -0,0 +1,503 @@
+package matching
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"match_me_module/events"
+	"math"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Categories lists the preference categories in the order they are scored.
+var Categories = []string{"food", "hobby", "music"}
+
+// Weights mirrors a row of the weights table.
+type Weights struct {
+	Distance float64 `json:"distance"`
+	Age      float64 `json:"age"`
+	Food     float64 `json:"food"`
+	Hobbies  float64 `json:"hobbies"`
+	Music    float64 `json:"music"`
+}
+
+// Filters mirrors a row of the match_filters table. Nil pointers mean the
+// filter is not set.
+type Filters struct {
+	MinAge        *int
+	MaxAge        *int
+	MaxDistanceKm *float64
+	Required      map[string][]string // category -> codes, at least one must be shared
+	Excluded      map[string][]string // category -> codes, none may be present
+	MinHeight     *int
+	MaxHeight     *int
+	Languages     []string // at least one must be shared
+	Goals         []string // the relationship goal must be one of these
+}
+
+// Profile holds the data the engine needs about a single user.
+type Profile struct {
+	UserID     string
+	Age        *int
+	DistanceKm float64 // distance to the viewer, zero for the viewer itself
+	Prefs      map[string][]string
+	HeightCm   *int
+	Languages  []string
+	Goal       string
+
+	Completeness int // stored profile completeness, see ProfileCompleteness
+}
+
+// Recommendation is a scored candidate for a viewer.
+type Recommendation struct {
+	UserID      string
+	Compability float64
+	DistanceKm  float64
+}
+
+// SplitCodes turns a comma separated code list as stored in profile_info into a slice.
+func SplitCodes(data sql.NullString) []string {
+	if !data.Valid || data.String == "" {
+		return nil
+	}
+	return strings.Split(data.String, ",")
+}
+
+// LoadWeights reads the weights of a user.
+func LoadWeights(db *sql.DB, userID string) (Weights, error) {
+	var w Weights
+	err := db.QueryRow(`
+		SELECT weigh_distance, weigh_age, weigh_food, weigh_hobbies, weigh_music
+		FROM weights
+		WHERE user_uuid = $1`, userID).Scan(&w.Distance, &w.Age, &w.Food, &w.Hobbies, &w.Music)
+	if err != nil {
+		return w, fmt.Errorf("error loading weights: %v", err)
+	}
+	return w, nil
+}
+
+// filterColumns are the match_filters columns scanned by filterRow, in order.
+var filterColumns = []string{"min_age", "max_age", "max_distance_km",
+	"food_required", "food_excluded",
+	"hobby_required", "hobby_excluded",
+	"music_required", "music_excluded",
+	"min_height", "max_height", "languages_required", "goals_required"}
+
+// filterSelect returns the filterColumns of the match_filters alias as a select list.
+func filterSelect(alias string) string {
+	columns := make([]string, len(filterColumns))
+	for i, column := range filterColumns {
+		columns[i] = alias + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// filterRow receives the filterColumns of a match_filters row. Every column
+// is nullable, so a missing row scans the same as one without filters.
+type filterRow struct {
+	minAge, maxAge, minHeight, maxHeight                                   sql.NullInt64
+	maxDistance                                                            sql.NullFloat64
+	foodReq, foodExc, hobbyReq, hobbyExc, musicReq, musicExc, langs, goals sql.NullString
+}
+
+func (r *filterRow) dest() []interface{} {
+	return []interface{}{&r.minAge, &r.maxAge, &r.maxDistance,
+		&r.foodReq, &r.foodExc, &r.hobbyReq, &r.hobbyExc, &r.musicReq, &r.musicExc,
+		&r.minHeight, &r.maxHeight, &r.langs, &r.goals}
+}
+
+func (r *filterRow) filters() Filters {
+	f := Filters{Required: map[string][]string{}, Excluded: map[string][]string{}}
+	if r.minAge.Valid {
+		v := int(r.minAge.Int64)
+		f.MinAge = &v
+	}
+	if r.maxAge.Valid {
+		v := int(r.maxAge.Int64)
+		f.MaxAge = &v
+	}
+	if r.maxDistance.Valid {
+		v := r.maxDistance.Float64
+		f.MaxDistanceKm = &v
+	}
+	f.Required["food"], f.Excluded["food"] = SplitCodes(r.foodReq), SplitCodes(r.foodExc)
+	f.Required["hobby"], f.Excluded["hobby"] = SplitCodes(r.hobbyReq), SplitCodes(r.hobbyExc)
+	f.Required["music"], f.Excluded["music"] = SplitCodes(r.musicReq), SplitCodes(r.musicExc)
+	if r.minHeight.Valid {
+		v := int(r.minHeight.Int64)
+		f.MinHeight = &v
+	}
+	if r.maxHeight.Valid {
+		v := int(r.maxHeight.Int64)
+		f.MaxHeight = &v
+	}
+	f.Languages, f.Goals = SplitCodes(r.langs), SplitCodes(r.goals)
+	return f
+}
+
+// LoadFilters reads the match filters of a user. A user without a
+// match_filters row has no filters.
+func LoadFilters(db *sql.DB, userID string) (Filters, error) {
+	var row filterRow
+	err := db.QueryRow("SELECT "+filterSelect("f")+" FROM match_filters f WHERE f.user_uuid = $1", userID).Scan(row.dest()...)
+	if err == sql.ErrNoRows {
+		return row.filters(), nil
+	}
+	if err != nil {
+		return Filters{}, fmt.Errorf("error loading match filters: %v", err)
+	}
+	return row.filters(), nil
+}
+
+// loadProfile reads the profile of a single user, with a zero distance.
+func loadProfile(db *sql.DB, userID string) (Profile, error) {
+	p := Profile{UserID: userID}
+	var age, height sql.NullInt64
+	var food, hobby, music, languages sql.NullString
+
+	err := db.QueryRow(`
+		SELECT `+AgeSQL("i.birthdate")+`,
+		       p.food_myvariabledata, p.hobbies_myvariabledata, p.music_myvariabledata,
+		       p.height_cm, p.languages, coalesce(p.relationship_goal, ''),
+		       coalesce(p.completeness, 0)
+		FROM user_info i
+		JOIN profile_info p ON p.user_uuid = i.user_uuid
+		WHERE i.user_uuid = $1`, userID).Scan(&age, &food, &hobby, &music, &height, &languages, &p.Goal, &p.Completeness)
+	if err != nil {
+		return p, fmt.Errorf("error loading profile: %v", err)
+	}
+
+	if age.Valid {
+		v := int(age.Int64)
+		p.Age = &v
+	}
+	if height.Valid {
+		v := int(height.Int64)
+		p.HeightCm = &v
+	}
+	p.Prefs = map[string][]string{"food": SplitCodes(food), "hobby": SplitCodes(hobby), "music": SplitCodes(music)}
+	p.Languages = SplitCodes(languages)
+	return p, nil
+}
+
+// loadCandidates returns every other user, or only the given one, that passes
+// the viewer's age and distance filters. Preference filters are applied
+// afterwards by Rejects.
+func loadCandidates(db *sql.DB, userID string, f Filters, only *string) ([]Profile, error) {
+	var maxDistanceMeters *float64
+	if f.MaxDistanceKm != nil {
+		v := *f.MaxDistanceKm * 1000
+		maxDistanceMeters = &v
+	}
+
+	query := fmt.Sprintf(`
+		SELECT i.user_uuid,
+		       ST_Distance(%[1]s, me.location) / 1000,
+		       %[6]s,
+		       p.food_myvariabledata, p.hobbies_myvariabledata, p.music_myvariabledata,
+		       p.height_cm, p.languages, coalesce(p.relationship_goal, ''),
+		       coalesce(p.completeness, 0)
+		FROM user_info i
+		JOIN user_data d ON d.user_uuid = i.user_uuid
+		JOIN profile_info p ON p.user_uuid = i.user_uuid
+		CROSS JOIN (SELECT %[2]s AS location FROM user_data m WHERE m.user_uuid = $1) me
+		WHERE i.user_uuid <> $1
+		  AND ($2::int IS NULL OR %[6]s >= $2)
+		  AND ($3::int IS NULL OR %[6]s <= $3)
+		  AND ($4::float8 IS NULL OR ST_DWithin(%[1]s, me.location, $4))
+		  AND ($5::uuid IS NULL OR i.user_uuid = $5)
+		  AND ($5::uuid IS NOT NULL OR coalesce(p.completeness, 0) >= %[5]d)
+		  AND %[3]s
+		  AND %[4]s`,
+		LocationSQL("d"), LocationSQL("m"), NotBlockedSQL("$1::uuid", "i.user_uuid"), ActiveAccountSQL("i.user_uuid"),
+		MatchableCompleteness, AgeSQL("i.birthdate"))
+
+	rows, err := db.Query(query, userID, f.MinAge, f.MaxAge, maxDistanceMeters, only)
+	if err != nil {
+		return nil, fmt.Errorf("error querying candidates: %v", err)
+	}
+	defer rows.Close()
+
+	var candidates []Profile
+	for rows.Next() {
+		var c Profile
+		var distance sql.NullFloat64
+		var age, height sql.NullInt64
+		var food, hobby, music, languages sql.NullString
+		if err := rows.Scan(&c.UserID, &distance, &age, &food, &hobby, &music, &height, &languages, &c.Goal, &c.Completeness); err != nil {
+			return nil, fmt.Errorf("error scanning candidate: %v", err)
+		}
+		c.DistanceKm = distance.Float64
+		if age.Valid {
+			v := int(age.Int64)
+			c.Age = &v
+		}
+		if height.Valid {
+			v := int(height.Int64)
+			c.HeightCm = &v
+		}
+		c.Prefs = map[string][]string{"food": SplitCodes(food), "hobby": SplitCodes(hobby), "music": SplitCodes(music)}
+		c.Languages = SplitCodes(languages)
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// Rejects reports the name of the first filter the candidate fails, or an
+// empty string when the candidate passes all of them.
+func Rejects(f Filters, c Profile) string {
+	if f.MinAge != nil && (c.Age == nil || *c.Age < *f.MinAge) {
+		return "min_age"
+	}
+	if f.MaxAge != nil && (c.Age == nil || *c.Age > *f.MaxAge) {
+		return "max_age"
+	}
+	if f.MaxDistanceKm != nil && c.DistanceKm > *f.MaxDistanceKm {
+		return "max_distance_km"
+	}
+	if f.MinHeight != nil && (c.HeightCm == nil || *c.HeightCm < *f.MinHeight) {
+		return "min_height"
+	}
+	if f.MaxHeight != nil && (c.HeightCm == nil || *c.HeightCm > *f.MaxHeight) {
+		return "max_height"
+	}
+	if len(f.Languages) > 0 && overlap(f.Languages, c.Languages) == 0 {
+		return "languages_required"
+	}
+	if len(f.Goals) > 0 && !unique(f.Goals)[c.Goal] {
+		return "goals_required"
+	}
+	for _, category := range Categories {
+		if required := f.Required[category]; len(required) > 0 && overlap(required, c.Prefs[category]) == 0 {
+			return category + "_required"
+		}
+		if overlap(f.Excluded[category], c.Prefs[category]) > 0 {
+			return category + "_excluded"
+		}
+	}
+	return ""
+}
+
+// overlap counts the distinct codes present in both lists.
+func overlap(a, b []string) int {
+	inB := unique(b)
+	count := 0
+	for code := range unique(a) {
+		if inB[code] {
+			count++
+		}
+	}
+	return count
+}
+
+func unique(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if code != "" {
+			set[code] = true
+		}
+	}
+	return set
+}
+
+// Recompute rebuilds the reccomendations rows of a user, applying their match
+// filters as hard constraints and their weights to the remaining candidates.
+func Recompute(db *sql.DB, userID string) error {
+	weights, err := LoadWeights(db, userID)
+	if err != nil {
+		return err
+	}
+	filters, err := LoadFilters(db, userID)
+	if err != nil {
+		return err
+	}
+	viewer, err := loadProfile(db, userID)
+	if err != nil {
+		return err
+	}
+	candidates, err := loadCandidates(db, userID, filters, nil)
+	if err != nil {
+		return err
+	}
+
+	var recs []Recommendation
+	for _, c := range candidates {
+		if Rejects(filters, c) != "" {
+			continue
+		}
+		recs = append(recs, Recommendation{
+			UserID:      c.UserID,
+			Compability: Score(current, weights, viewer, c),
+			DistanceKm:  c.DistanceKm,
+		})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Remember what was recommended before so new recommendations can be announced
+	previous, err := deleteReturning(tx, "DELETE FROM reccomendations WHERE user_uuid_of = $1 RETURNING user_uuid_with", userID)
+	if err != nil {
+		return fmt.Errorf("error clearing recommendations: %v", err)
+	}
+
+	added := []string{}
+	for _, rec := range recs {
+		_, err := tx.Exec("INSERT INTO reccomendations (user_uuid_of, user_uuid_with, compability, distance) VALUES ($1, $2, $3, $4)",
+			userID, rec.UserID, rec.Compability, math.Round(rec.DistanceKm*10)/10)
+		if err != nil {
+			return fmt.Errorf("error saving recommendation: %v", err)
+		}
+		if !previous[rec.UserID] {
+			added = append(added, rec.UserID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(added) > 0 {
+		return events.Publish(db, userID, events.TypeNewRecommendation, map[string]interface{}{"user_ids": added})
+	}
+	return nil
+}
+
+// RecomputeUser refreshes every row a change to the user's profile can
+// affect: the user's own recommendations and the user's row in the
+// recommendations of everybody else. The rows of the other viewers are read
+// and replaced with one query each, however many users there are.
+func RecomputeUser(db *sql.DB, userID string) error {
+	// Whether the user can be recommended at all depends on their completeness
+	if err := UpdateCompleteness(db, userID); err != nil {
+		return err
+	}
+	if err := Recompute(db, userID); err != nil {
+		return err
+	}
+
+	candidate, err := loadProfile(db, userID)
+	if err != nil {
+		return err
+	}
+
+	// Every viewer the user can be recommended to, with what scoring needs.
+	// No rows come back when the user cannot be recommended to anyone.
+	query := fmt.Sprintf(`
+		SELECT i.user_uuid,
+		       ST_Distance(%[1]s, %[2]s) / 1000,
+		       %[3]s,
+		       p.food_myvariabledata, p.hobbies_myvariabledata, p.music_myvariabledata,
+		       w.weigh_distance, w.weigh_age, w.weigh_food, w.weigh_hobbies, w.weigh_music,
+		       %[4]s
+		FROM user_info i
+		JOIN user_data d ON d.user_uuid = i.user_uuid
+		JOIN profile_info p ON p.user_uuid = i.user_uuid
+		JOIN weights w ON w.user_uuid = i.user_uuid
+		LEFT JOIN match_filters f ON f.user_uuid = i.user_uuid
+		CROSS JOIN (SELECT * FROM user_data WHERE user_uuid = $1) c
+		WHERE i.user_uuid <> $1
+		  AND $2::int >= %[5]d
+		  AND %[6]s
+		  AND %[7]s`,
+		LocationSQL("c"), LocationSQL("d"), AgeSQL("i.birthdate"), filterSelect("f"),
+		MatchableCompleteness, NotBlockedSQL("i.user_uuid", "$1::uuid"), ActiveAccountSQL("$1::uuid"))
+
+	rows, err := db.Query(query, userID, candidate.Completeness)
+	if err != nil {
+		return fmt.Errorf("error querying viewers: %v", err)
+	}
+	var viewers []string
+	var scores, distances []float64
+	for rows.Next() {
+		viewer := Profile{}
+		var distance sql.NullFloat64
+		var age sql.NullInt64
+		var food, hobby, music sql.NullString
+		var w Weights
+		var f filterRow
+		dest := append([]interface{}{&viewer.UserID, &distance, &age, &food, &hobby, &music,
+			&w.Distance, &w.Age, &w.Food, &w.Hobbies, &w.Music}, f.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning viewer: %v", err)
+		}
+		if age.Valid {
+			v := int(age.Int64)
+			viewer.Age = &v
+		}
+		viewer.Prefs = map[string][]string{"food": SplitCodes(food), "hobby": SplitCodes(hobby), "music": SplitCodes(music)}
+
+		c := candidate
+		c.DistanceKm = distance.Float64
+		if Rejects(f.filters(), c) != "" {
+			continue
+		}
+		viewers = append(viewers, viewer.UserID)
+		scores = append(scores, Score(current, w, viewer, c))
+		distances = append(distances, math.Round(c.DistanceKm*10)/10)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading viewers: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	previous, err := deleteReturning(tx, "DELETE FROM reccomendations WHERE user_uuid_with = $1 AND user_uuid_of <> $1 RETURNING user_uuid_of", userID)
+	if err != nil {
+		return fmt.Errorf("error clearing recommendations: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO reccomendations (user_uuid_of, user_uuid_with, compability, distance)
+		SELECT v.viewer, $1, v.compability, v.distance
+		FROM unnest($2::uuid[], $3::float8[], $4::float8[]) AS v(viewer, compability, distance)`,
+		userID, pq.Array(viewers), pq.Array(scores), pq.Array(distances))
+	if err != nil {
+		return fmt.Errorf("error saving recommendations: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// A failed announcement does not undo the recommendations, so it is not
+	// worth retrying the job for
+	for _, viewer := range viewers {
+		if previous[viewer] {
+			continue
+		}
+		err := events.Publish(db, viewer, events.TypeNewRecommendation, map[string]interface{}{"user_ids": []string{userID}})
+		if err != nil {
+			log.Printf("Error announcing recommendation of %s to %s: %v", userID, viewer, err)
+		}
+	}
+	return nil
+}
+
+// deleteReturning runs a DELETE returning one user_uuid column and collects
+// the deleted IDs.
+func deleteReturning(tx *sql.Tx, query string, args ...interface{}) (map[string]bool, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		deleted[id] = true
+	}
+	return deleted, rows.Err()
+}
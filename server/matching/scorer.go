@@ -0,0 +1,246 @@
+package matching
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Scorer splits the match between a viewer and a candidate into weighted
+// components. Implementations differ in how components are scored and
+// combined, the weights always come from the viewer's weights row.
+type Scorer interface {
+	Name() string
+	Components(w Weights, viewer, candidate Profile) []Component
+}
+
+// Component is one part of a compability score.
+type Component struct {
+	Name         string  `json:"name"`
+	Score        float64 `json:"score"`        // 0 to 1
+	Weight       float64 `json:"weight"`       // the viewer's weight for this component
+	Weighted     float64 `json:"weighted"`     // Score multiplied by Weight
+	Contribution float64 `json:"contribution"` // points added to the 0 to 100 compability
+}
+
+// Score combines the components of a scorer into a compability between 0 and 100.
+func Score(s Scorer, w Weights, viewer, c Profile) float64 {
+	var total float64
+	for _, p := range s.Components(w, viewer, c) {
+		total += p.Contribution
+	}
+	return math.Round(total*100) / 100
+}
+
+// OverlapFunc scores how similar two preference code lists are, from 0 to 1.
+type OverlapFunc func(a, b []string) float64
+
+// DecayFunc scores a distance in kilometres, from 1 for the same spot down to 0.
+type DecayFunc func(km float64) float64
+
+// Overlaps are the available preference similarity measures by name.
+var Overlaps = map[string]OverlapFunc{
+	"jaccard": Jaccard,
+	"cosine":  Cosine,
+}
+
+// Decays are the available distance-decay curves by name.
+var Decays = map[string]DecayFunc{
+	"hyperbolic":  HyperbolicDecay,
+	"exponential": ExponentialDecay,
+	"linear":      LinearDecay,
+	"gaussian":    GaussianDecay,
+}
+
+// DefaultOverlap is the overlap measure used when none is configured.
+const DefaultOverlap = "jaccard"
+
+// Distance at which the decay curves are scaled, in kilometres.
+const decayScaleKm = 50
+
+// current is the scorer used by Recompute and Explain.
+var current Scorer = weightedSumScorer{DefaultOverlap, Jaccard}
+
+// SetScorer replaces the scorer used for recommendations. It is meant to be
+// called once on startup, before any recommendations are computed.
+func SetScorer(s Scorer) {
+	current = s
+}
+
+// CurrentScorer returns the scorer used for recommendations.
+func CurrentScorer() Scorer {
+	return current
+}
+
+// NewScorer returns the weighted sum scorer with the given preference
+// overlap measure, or the distance-decay scorer when a decay curve is named
+// too. An empty overlap selects the default.
+func NewScorer(overlap, decay string) (Scorer, error) {
+	if overlap == "" {
+		overlap = DefaultOverlap
+	}
+	overlapFunc, ok := Overlaps[overlap]
+	if !ok {
+		return nil, fmt.Errorf("unknown overlap measure %q", overlap)
+	}
+	if decay == "" {
+		return weightedSumScorer{overlap, overlapFunc}, nil
+	}
+	decayFunc, ok := Decays[decay]
+	if !ok {
+		return nil, fmt.Errorf("unknown distance decay %q", decay)
+	}
+	return distanceDecayScorer{overlap, decay, overlapFunc, decayFunc}, nil
+}
+
+// AllScorers returns the weighted sum scorer of every overlap measure and the
+// distance-decay scorer of every combination with a decay curve, sorted by
+// name.
+func AllScorers() []Scorer {
+	var scorers []Scorer
+	for overlap := range Overlaps {
+		s, _ := NewScorer(overlap, "")
+		scorers = append(scorers, s)
+		for decay := range Decays {
+			s, _ := NewScorer(overlap, decay)
+			scorers = append(scorers, s)
+		}
+	}
+	sort.Slice(scorers, func(i, j int) bool { return scorers[i].Name() < scorers[j].Name() })
+	return scorers
+}
+
+// weightedSumScorer is the baseline: a weighted sum of a distance, an age
+// and three preference overlap components. Distance scores as it always
+// has, dropping to 0.5 at 50 km.
+type weightedSumScorer struct {
+	overlapName string
+	overlap     OverlapFunc
+}
+
+func (s weightedSumScorer) Name() string {
+	return s.overlapName
+}
+
+func (s weightedSumScorer) Components(w Weights, viewer, c Profile) []Component {
+	parts := append([]Component{
+		{Name: "distance", Weight: w.Distance, Score: HyperbolicDecay(c.DistanceKm)},
+	}, profileComponents(s.overlap, w, viewer, c)...)
+
+	var weightSum float64
+	for _, p := range parts {
+		weightSum += p.Weight
+	}
+	for i := range parts {
+		parts[i].Weighted = parts[i].Weight * parts[i].Score
+		if weightSum > 0 {
+			parts[i].Contribution = parts[i].Weighted / weightSum * 100
+		}
+	}
+	return parts
+}
+
+// distanceDecayScorer scales the weighted sum of the age and preference
+// components by how far away the candidate is, instead of adding distance as
+// one more component. A candidate close by keeps its points, a distant one
+// loses part of all of them however well it fits. The viewer's distance weight
+// sets how much: with its share d of all weights the factor is
+// 1 - d + d*decay(km). The distance component adds no points of its own
+// unless it is the only one weighted.
+type distanceDecayScorer struct {
+	overlapName string
+	decayName   string
+	overlap     OverlapFunc
+	decay       DecayFunc
+}
+
+func (s distanceDecayScorer) Name() string {
+	return s.overlapName + "/" + s.decayName
+}
+
+func (s distanceDecayScorer) Components(w Weights, viewer, c Profile) []Component {
+	decay := s.decay(c.DistanceKm)
+	distance := Component{Name: "distance", Weight: w.Distance, Score: decay, Weighted: w.Distance * decay}
+	rest := profileComponents(s.overlap, w, viewer, c)
+
+	var restSum float64
+	for _, p := range rest {
+		restSum += p.Weight
+	}
+	if restSum+w.Distance <= 0 {
+		return append([]Component{distance}, rest...)
+	}
+	share := w.Distance / (restSum + w.Distance)
+	if restSum == 0 {
+		distance.Contribution = decay * 100
+	}
+
+	factor := 1 - share + share*decay
+	for i := range rest {
+		rest[i].Weighted = rest[i].Weight * rest[i].Score
+		if restSum > 0 {
+			rest[i].Contribution = rest[i].Weighted / restSum * 100 * factor
+		}
+	}
+	return append([]Component{distance}, rest...)
+}
+
+// profileComponents scores the age and preference parts of a match, leaving
+// Weighted and Contribution to the scorer.
+func profileComponents(overlap OverlapFunc, w Weights, viewer, c Profile) []Component {
+	return []Component{
+		{Name: "age", Weight: w.Age, Score: AgeScore(viewer.Age, c.Age)},
+		{Name: "food", Weight: w.Food, Score: overlap(viewer.Prefs["food"], c.Prefs["food"])},
+		{Name: "hobby", Weight: w.Hobbies, Score: overlap(viewer.Prefs["hobby"], c.Prefs["hobby"])},
+		{Name: "music", Weight: w.Music, Score: overlap(viewer.Prefs["music"], c.Prefs["music"])},
+	}
+}
+
+// HyperbolicDecay drops to 0.5 at 50 km and has a long tail.
+func HyperbolicDecay(km float64) float64 {
+	return 1 / (1 + km/decayScaleKm)
+}
+
+// ExponentialDecay halves every 50 km.
+func ExponentialDecay(km float64) float64 {
+	return math.Pow(2, -km/decayScaleKm)
+}
+
+// LinearDecay falls in a straight line and reaches 0 at 200 km.
+func LinearDecay(km float64) float64 {
+	return math.Max(0, 1-km/(4*decayScaleKm))
+}
+
+// GaussianDecay stays high close by and drops sharply beyond 50 km.
+func GaussianDecay(km float64) float64 {
+	return math.Exp(-(km * km) / (2 * decayScaleKm * decayScaleKm))
+}
+
+// AgeScore is 1 for the same age and drops to 0.5 at 5 years of difference.
+// Unknown ages score 0.
+func AgeScore(a, b *int) float64 {
+	if a == nil || b == nil {
+		return 0
+	}
+	return 1 / (1 + math.Abs(float64(*a-*b))/5)
+}
+
+// Jaccard returns the size of the intersection divided by the size of the union.
+func Jaccard(a, b []string) float64 {
+	shared := overlap(a, b)
+	union := len(unique(a)) + len(unique(b)) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// Cosine treats both code lists as binary preference vectors and returns the
+// cosine of the angle between them.
+func Cosine(a, b []string) float64 {
+	sizeA, sizeB := len(unique(a)), len(unique(b))
+	if sizeA == 0 || sizeB == 0 {
+		return 0
+	}
+	return float64(overlap(a, b)) / math.Sqrt(float64(sizeA*sizeB))
+}
@@ -0,0 +1,192 @@
+package matching
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether two scores agree to well below what a score is rounded to.
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestDecays(t *testing.T) {
+	tests := []struct {
+		name string
+		km   float64
+		want float64
+	}{
+		{"hyperbolic", 0, 1},
+		{"hyperbolic", 50, 0.5},
+		{"hyperbolic", 150, 0.25},
+		{"exponential", 0, 1},
+		{"exponential", 50, 0.5},
+		{"exponential", 100, 0.25},
+		{"linear", 0, 1},
+		{"linear", 50, 0.75},
+		{"linear", 200, 0},
+		{"linear", 500, 0},
+		{"gaussian", 0, 1},
+		{"gaussian", 50, math.Exp(-0.5)},
+		{"gaussian", 100, math.Exp(-2)},
+	}
+	for _, tt := range tests {
+		if got := Decays[tt.name](tt.km); !near(got, tt.want) {
+			t.Errorf("%s decay at %v km: got %v, want %v", tt.name, tt.km, got, tt.want)
+		}
+	}
+
+	// Every curve falls with distance and stays between 0 and 1
+	for name, decay := range Decays {
+		previous := decay(0)
+		for km := 1.0; km <= 1000; km++ {
+			got := decay(km)
+			if got > previous || got < 0 || got > 1 {
+				t.Errorf("%s decay at %v km: got %v after %v", name, km, got, previous)
+				break
+			}
+			previous = got
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    []string
+		jaccard float64
+		cosine  float64
+	}{
+		{"both empty", nil, nil, 0, 0},
+		{"one empty", []string{"a"}, nil, 0, 0},
+		{"identical", []string{"a", "b"}, []string{"b", "a"}, 1, 1},
+		{"disjoint", []string{"a", "b"}, []string{"c"}, 0, 0},
+		{"partial", []string{"a", "b"}, []string{"b", "c"}, 1.0 / 3, 0.5},
+		{"subset", []string{"a"}, []string{"a", "b", "c", "d"}, 0.25, 0.5},
+		{"duplicates and blanks", []string{"a", "a", ""}, []string{"a", ""}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Jaccard(tt.a, tt.b); !near(got, tt.jaccard) {
+				t.Errorf("Jaccard: got %v, want %v", got, tt.jaccard)
+			}
+			if got := Cosine(tt.a, tt.b); !near(got, tt.cosine) {
+				t.Errorf("Cosine: got %v, want %v", got, tt.cosine)
+			}
+		})
+	}
+}
+
+func TestAgeScore(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *int
+		want float64
+	}{
+		{"unknown", nil, intPtr(30), 0},
+		{"same age", intPtr(30), intPtr(30), 1},
+		{"5 years apart", intPtr(30), intPtr(25), 0.5},
+		{"15 years apart", intPtr(20), intPtr(35), 0.25},
+	}
+	for _, tt := range tests {
+		if got := AgeScore(tt.a, tt.b); !near(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScorers(t *testing.T) {
+	viewer := Profile{Age: intPtr(30), Prefs: map[string][]string{"food": {"a", "b"}, "hobby": {"x"}, "music": {"m"}}}
+	candidate := func(km float64) Profile {
+		return Profile{Age: intPtr(30), DistanceKm: km, Prefs: map[string][]string{"food": {"b", "c"}, "hobby": {"x"}, "music": {"n"}}}
+	}
+	weightedSum, err := NewScorer("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decay, err := NewScorer("jaccard", "linear")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Age 1, food 1/3, hobby 1, music 0 with a weight of 1 each
+	even := Weights{Distance: 1, Age: 1, Food: 1, Hobbies: 1, Music: 1}
+	tests := []struct {
+		name   string
+		scorer Scorer
+		w      Weights
+		km     float64
+		want   float64
+	}{
+		// Distance is one of five equal parts, 0.5 at 50 km
+		{"weighted sum, same spot", weightedSum, even, 0, (1 + 1 + 1.0/3 + 1) / 5 * 100},
+		{"weighted sum, 50 km", weightedSum, even, 50, (0.5 + 1 + 1.0/3 + 1) / 5 * 100},
+		{"weighted sum, distance only", weightedSum, Weights{Distance: 1}, 50, 50},
+		{"weighted sum, no weights", weightedSum, Weights{}, 0, 0},
+
+		// The rest is scaled by 1 - 1/5 + 1/5 * decay, the linear decay is 0.75 at 50 km
+		{"decay, same spot", decay, even, 0, (1 + 1.0/3 + 1) / 4 * 100},
+		{"decay, 50 km", decay, even, 50, (1 + 1.0/3 + 1) / 4 * 100 * (0.8 + 0.2*0.75)},
+		{"decay, out of reach", decay, even, 500, (1 + 1.0/3 + 1) / 4 * 100 * 0.8},
+		{"decay, distance ignored", decay, Weights{Age: 1, Food: 1, Hobbies: 1, Music: 1}, 500, (1 + 1.0/3 + 1) / 4 * 100},
+		{"decay, distance only", decay, Weights{Distance: 1}, 50, 75},
+		{"decay, no weights", decay, Weights{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := math.Round(tt.want*100) / 100
+			if got := Score(tt.scorer, tt.w, viewer, candidate(tt.km)); got != want {
+				t.Errorf("Score: got %v, want %v", got, want)
+			}
+
+			// The explanation adds up to the score
+			var total float64
+			for _, p := range tt.scorer.Components(tt.w, viewer, candidate(tt.km)) {
+				total += p.Contribution
+			}
+			if !near(total, tt.want) {
+				t.Errorf("Contributions: got %v, want %v", total, tt.want)
+			}
+		})
+	}
+
+	// A perfect match in the same spot scores the same with both
+	if a, b := Score(weightedSum, even, viewer, viewer), Score(decay, even, viewer, viewer); a != b {
+		t.Errorf("Perfect match: weighted sum %v, decay %v", a, b)
+	}
+}
+
+func TestNewScorer(t *testing.T) {
+	for _, tt := range []struct {
+		overlap, decay, name string
+	}{
+		{"", "", DefaultOverlap},
+		{"cosine", "", "cosine"},
+		{"", "gaussian", DefaultOverlap + "/gaussian"},
+		{"cosine", "exponential", "cosine/exponential"},
+	} {
+		s, err := NewScorer(tt.overlap, tt.decay)
+		if err != nil || s.Name() != tt.name {
+			t.Errorf("NewScorer(%q, %q): got %v, %v, want %s", tt.overlap, tt.decay, s, err, tt.name)
+		}
+	}
+	for _, invalid := range [][2]string{{"dice", ""}, {"jaccard", "cubic"}} {
+		if _, err := NewScorer(invalid[0], invalid[1]); err == nil {
+			t.Errorf("NewScorer(%q, %q) was accepted", invalid[0], invalid[1])
+		}
+	}
+
+	scorers := AllScorers()
+	if want := len(Overlaps) * (len(Decays) + 1); len(scorers) != want {
+		t.Fatalf("AllScorers: got %d, want %d", len(scorers), want)
+	}
+	for i := 1; i < len(scorers); i++ {
+		if scorers[i-1].Name() >= scorers[i].Name() {
+			t.Errorf("AllScorers not sorted or repeated: %s before %s", scorers[i-1].Name(), scorers[i].Name())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package matching
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// PrefColumns maps a preference category to its profile_info column.
+var PrefColumns = map[string]string{
+	"food":  "food_myvariabledata",
+	"hobby": "hobbies_myvariabledata",
+	"music": "music_myvariabledata",
+}
+
+// NotBlockedSQL returns a condition that is true when neither user has
+// blocked the other. Both arguments are SQL expressions yielding a user_uuid.
+func NotBlockedSQL(viewer, other string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM blocks b
+		WHERE (b.blocker_uuid = %[1]s AND b.blocked_uuid = %[2]s)
+		   OR (b.blocker_uuid = %[2]s AND b.blocked_uuid = %[1]s))`, viewer, other)
+}
+
+// ActiveAccountSQL returns a condition that is true when the account of the
+// user is neither banned nor suspended. The argument is an SQL expression
+// yielding a user_uuid.
+func ActiveAccountSQL(user string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM user_table t
+		WHERE t.user_uuid = %s
+		  AND (coalesce(t.account_status, 'active') = 'active'
+		       OR (t.account_status = 'suspended' AND t.suspended_until <= now())))`, user)
+}
+
+// PreferenceFilterSQL returns the conditions enforcing the required and
+// excluded preference codes and the profile field filters of f against the
+// profile_info alias, starting at placeholder $next, together with the
+// arguments for those placeholders. They agree with Rejects.
+func PreferenceFilterSQL(f Filters, alias string, next int) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	for _, category := range Categories {
+		codes := fmt.Sprintf("coalesce(string_to_array(%s.%s, ','), '{}')", alias, PrefColumns[category])
+		if required := f.Required[category]; len(required) > 0 {
+			clauses = append(clauses, fmt.Sprintf("%s && $%d::text[]", codes, next))
+			args = append(args, pq.Array(required))
+			next++
+		}
+		if excluded := f.Excluded[category]; len(excluded) > 0 {
+			clauses = append(clauses, fmt.Sprintf("NOT (%s && $%d::text[])", codes, next))
+			args = append(args, pq.Array(excluded))
+			next++
+		}
+	}
+
+	if f.MinHeight != nil {
+		clauses = append(clauses, fmt.Sprintf("%s.height_cm >= $%d", alias, next))
+		args = append(args, *f.MinHeight)
+		next++
+	}
+	if f.MaxHeight != nil {
+		clauses = append(clauses, fmt.Sprintf("%s.height_cm <= $%d", alias, next))
+		args = append(args, *f.MaxHeight)
+		next++
+	}
+	if len(f.Languages) > 0 {
+		clauses = append(clauses, fmt.Sprintf("coalesce(string_to_array(%s.languages, ','), '{}') && $%d::text[]", alias, next))
+		args = append(args, pq.Array(f.Languages))
+		next++
+	}
+	if len(f.Goals) > 0 {
+		clauses = append(clauses, fmt.Sprintf("%s.relationship_goal = ANY($%d::text[])", alias, next))
+		args = append(args, pq.Array(f.Goals))
+		next++
+	}
+
+	if len(clauses) == 0 {
+		return "TRUE", nil
+	}
+	return strings.Join(clauses, " AND "), args
+}
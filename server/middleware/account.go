@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles a user can have
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusBanned    = "banned"
+
+	// Deletion was requested and can still be undone until the job removes the data
+	StatusPendingDeletion = "pending_deletion"
+	StatusDeleted         = "deleted"
+)
+
+// Account is the access related part of a user_table row.
+type Account struct {
+	Role              string
+	Status            string
+	SuspendedUntil    *time.Time
+	MustResetPassword bool
+}
+
+// LoadAccount reads the account of a user.
+func LoadAccount(userID string) (Account, error) {
+	var a Account
+	var suspendedUntil sql.NullTime
+	err := databaseSetup.GetDB().QueryRow(`
+		SELECT coalesce(role, 'user'), coalesce(account_status, 'active'), suspended_until, coalesce(must_reset_password, false)
+		FROM user_table WHERE user_uuid = $1`, userID).Scan(&a.Role, &a.Status, &suspendedUntil, &a.MustResetPassword)
+	if err == sql.ErrNoRows {
+		return a, fmt.Errorf("account not found")
+	}
+	if err != nil {
+		return a, err
+	}
+	if suspendedUntil.Valid {
+		a.SuspendedUntil = &suspendedUntil.Time
+	}
+	return a, nil
+}
+
+// Usable returns an error when the account is banned, still suspended or (being) deleted.
+func (a Account) Usable() error {
+	switch a.Status {
+	case StatusBanned:
+		return fmt.Errorf("account is banned")
+	case StatusPendingDeletion:
+		return fmt.Errorf("account is scheduled for deletion")
+	case StatusDeleted:
+		return fmt.Errorf("account is deleted")
+	case StatusSuspended:
+		if a.SuspendedUntil == nil || a.SuspendedUntil.After(time.Now()) {
+			return fmt.Errorf("account is suspended")
+		}
+	}
+	return nil
+}
+
+// accountCacheTTL is how long a request that only reads trusts the account
+// loaded for an earlier request of the same user, so a client polling or
+// reconnecting does not cost a user_table lookup every time. A ban,
+// suspension, deletion or role change reaches such requests up to this much
+// later when made on another instance, this instance forgets the account
+// when it changes it. Requests that change something and the admin routes
+// always load the account.
+const accountCacheTTL = 30 * time.Second
+
+// Expired accounts are dropped at most this often
+const accountCachePruneInterval = time.Minute
+
+type accountCache struct {
+	mu        sync.Mutex
+	entries   map[string]cachedAccount
+	lastPrune time.Time
+}
+
+type cachedAccount struct {
+	account Account
+	expires time.Time
+}
+
+var accounts = &accountCache{entries: map[string]cachedAccount{}}
+
+// get returns the cached account of a user, or loads and caches it when it
+// is missing, expired or fresh is set. Failed loads are not cached.
+func (c *accountCache) get(userID string, fresh bool, now time.Time, load func(string) (Account, error)) (Account, error) {
+	c.mu.Lock()
+	if now.Sub(c.lastPrune) >= accountCachePruneInterval {
+		for id, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, id)
+			}
+		}
+		c.lastPrune = now
+	}
+	entry, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && !fresh && now.Before(entry.expires) {
+		return entry.account, nil
+	}
+
+	account, err := load(userID)
+	if err != nil {
+		return account, err
+	}
+	c.mu.Lock()
+	c.entries[userID] = cachedAccount{account, now.Add(accountCacheTTL)}
+	c.mu.Unlock()
+	return account, nil
+}
+
+func (c *accountCache) forget(userID string) {
+	c.mu.Lock()
+	delete(c.entries, userID)
+	c.mu.Unlock()
+}
+
+// ForgetAccount drops the cached account of a user. It is called after the
+// role, status or password reset flag of the user changed.
+func ForgetAccount(userID string) {
+	accounts.forget(userID)
+}
+
+// checkAccount makes sure the account behind a token can still be used and
+// that its role has not changed since the token was issued. Unless fresh is
+// set the account may come from the cache.
+func checkAccount(claims jwt.MapClaims, fresh bool) error {
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return fmt.Errorf("missing user_id")
+	}
+	account, err := accounts.get(userID, fresh, time.Now(), LoadAccount)
+	if err != nil {
+		return err
+	}
+	if err := account.Usable(); err != nil {
+		return err
+	}
+	if account.MustResetPassword {
+		return fmt.Errorf("password reset required, log in again")
+	}
+
+	// Tokens issued before roles existed carry none and belong to plain users
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = RoleUser
+	}
+	if role != account.Role {
+		return fmt.Errorf("role changed, log in again")
+	}
+	return nil
+}
+
+type contextKey string
+
+const userIDKey contextKey = "user_id"
+
+// RequireRole only lets requests with a valid token of the given role through
+// to next. The caller's user ID is available to next through UserID.
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// A demoted admin loses access right away, also to what only reads
+		token, err := validateToken(r, true)
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			log.Printf("Error in authorizing: %v", err)
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok || !token.Valid {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			log.Println("Invalid token")
+			return
+		}
+
+		if claims["role"] != role {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			log.Printf("User %v without role %s tried %s %s", claims["user_id"], role, r.Method, r.URL.Path)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userIDKey, claims["user_id"])))
+	}
+}
+
+// UserID returns the user ID stored by RequireRole.
+func UserID(r *http.Request) string {
+	userID, _ := r.Context().Value(userIDKey).(string)
+	return userID
+}
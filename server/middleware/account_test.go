@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAccountCache(t *testing.T) {
+	cache := &accountCache{entries: map[string]cachedAccount{}}
+	start := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+
+	loads := 0
+	status := StatusActive
+	load := func(userID string) (Account, error) {
+		loads++
+		if userID == "missing" {
+			return Account{}, fmt.Errorf("account not found")
+		}
+		return Account{Role: RoleUser, Status: status}, nil
+	}
+	get := func(fresh bool, at time.Time) Account {
+		t.Helper()
+		account, err := cache.get("a", fresh, at, load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return account
+	}
+
+	// Reads within the TTL share one lookup
+	get(false, start)
+	status = StatusBanned
+	if account := get(false, start.Add(accountCacheTTL-time.Second)); account.Status != StatusActive || loads != 1 {
+		t.Errorf("Within the TTL: got %s after %d loads, want the cached account", account.Status, loads)
+	}
+
+	// A fresh read loads it again and updates the cache
+	if account := get(true, start.Add(time.Second)); account.Status != StatusBanned || loads != 2 {
+		t.Errorf("Fresh: got %s after %d loads", account.Status, loads)
+	}
+	status = StatusActive
+	if account := get(false, start.Add(2*time.Second)); account.Status != StatusBanned {
+		t.Errorf("After a fresh read: got %s, want the account it loaded", account.Status)
+	}
+
+	// It expires, or is forgotten when the account changes
+	if account := get(false, start.Add(time.Second+accountCacheTTL)); account.Status != StatusActive || loads != 3 {
+		t.Errorf("After the TTL: got %s after %d loads", account.Status, loads)
+	}
+	cache.forget("a")
+	get(false, start.Add(time.Second+accountCacheTTL))
+	if loads != 4 {
+		t.Errorf("After forgetting: got %d loads, want 4", loads)
+	}
+
+	// Failures are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := cache.get("missing", false, start, load); err == nil {
+			t.Error("Missing account was found")
+		}
+	}
+	if loads != 6 {
+		t.Errorf("Failed loads: got %d loads, want 6", loads)
+	}
+
+	// Expired accounts are dropped once the cache prunes
+	cache.get("b", false, start.Add(time.Hour), load)
+	if len(cache.entries) != 1 {
+		t.Errorf("Accounts after pruning: got %d, want 1", len(cache.entries))
+	}
+}
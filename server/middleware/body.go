@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// JSONBody serves next with a request body of at most maxBytes, reading
+// past it fails with an *http.MaxBytesError. A request that has a body has
+// to declare it as application/json, anything else is answered with 415
+// Unsupported Media Type before the handler runs.
+func JSONBody(maxBytes int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+			next(w, r)
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.ContentLength > maxBytes {
+			http.Error(w, fmt.Sprintf("Request body is larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next(w, r)
+	}
+}
+
+// SecurityHeaders adds the headers that keep browsers from sniffing,
+// framing or leaking the API's responses. The API only serves JSON and
+// images, so no content of its own may be loaded by them.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		header.Set("Referrer-Policy", "no-referrer")
+		if r.TLS != nil {
+			header.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// In the cookie auth mode logging in puts the access token in an HttpOnly
+// cookie the client's scripts cannot read, so it does not have to be kept in
+// localStorage. The browser sends the cookie along by itself, also on
+// requests another site makes it send, so every request that changes
+// something has to repeat the CSRF cookie in the CSRF header (double
+// submit). Another site can make the browser send the cookie but cannot read
+// it to fill in the header. The CSRF token is also a claim of the access
+// token, a CSRF cookie planted from elsewhere does not match it.
+const (
+	TokenCookie = "match_me_token"
+	CSRFCookie  = "match_me_csrf"
+	CSRFHeader  = "X-CSRF-Token"
+)
+
+// CookieAuth reports whether logging in issues the token as a cookie
+// instead of in the response body, set with AUTH_MODE=cookie. Tokens are
+// accepted from either place in both modes.
+func CookieAuth() bool {
+	return os.Getenv("AUTH_MODE") == "cookie"
+}
+
+// NewCSRFToken returns a random token for the double submit check.
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SetSessionCookies stores the access token in an HttpOnly cookie and the
+// CSRF token in one the client can read, both expiring with the token.
+func SetSessionCookies(w http.ResponseWriter, token, csrf string, expires time.Time) {
+	http.SetCookie(w, sessionCookie(TokenCookie, token, true, expires))
+	http.SetCookie(w, sessionCookie(CSRFCookie, csrf, false, expires))
+}
+
+// ClearSessionCookies makes the browser drop the cookies of a session.
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(TokenCookie, "", true, time.Unix(0, 0)))
+	http.SetCookie(w, sessionCookie(CSRFCookie, "", false, time.Unix(0, 0)))
+}
+
+// sessionCookie applies AUTH_COOKIE_SAMESITE (strict by default, lax or
+// none) and AUTH_COOKIE_SECURE, which only local development over plain
+// HTTP sets to false.
+func sessionCookie(name, value string, httpOnly bool, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: httpOnly,
+		Secure:   os.Getenv("AUTH_COOKIE_SECURE") != "false",
+		SameSite: http.SameSiteStrictMode,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	switch strings.ToLower(os.Getenv("AUTH_COOKIE_SAMESITE")) {
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "none":
+		// Browsers only send SameSite=None cookies over HTTPS
+		cookie.SameSite = http.SameSiteNoneMode
+		cookie.Secure = true
+	}
+	return cookie
+}
+
+// requestToken returns the token of the Authorization header, or else the
+// one of the token cookie and true.
+func requestToken(r *http.Request) (string, bool, error) {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		// Extract the token from the Authorization header: "Bearer <token>"
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return "", false, fmt.Errorf("invalid token format")
+		}
+		return parts[1], false, nil
+	}
+	if cookie, err := r.Cookie(TokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true, nil
+	}
+	return "", false, fmt.Errorf("missing authorization header")
+}
+
+// checkCSRF lets a request authorized by the token cookie through if it only
+// reads, or if its CSRF header matches both the CSRF cookie and the token.
+func checkCSRF(r *http.Request, claims jwt.MapClaims) error {
+	if safeMethod(r.Method) {
+		return nil
+	}
+
+	header := r.Header.Get(CSRFHeader)
+	cookie, err := r.Cookie(CSRFCookie)
+	if header == "" || err != nil || !equalTokens(header, cookie.Value) {
+		return fmt.Errorf("missing or mismatched %s header", CSRFHeader)
+	}
+	if claim, _ := claims["csrf"].(string); claim == "" || !equalTokens(header, claim) {
+		return fmt.Errorf("CSRF token does not belong to the session")
+	}
+	return nil
+}
+
+// safeMethod reports whether requests of the method only read.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func equalTokens(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		cookie     string
+		want       string
+		fromCookie bool
+		wantErr    bool
+	}{
+		{"header", "Bearer abc", "", "abc", false, false},
+		{"header wins", "Bearer abc", "def", "abc", false, false},
+		{"cookie", "", "def", "def", true, false},
+		{"invalid header", "Token abc", "def", "", false, true},
+		{"nothing", "", "", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.Header.Set("Cookie", TokenCookie+"="+tt.cookie)
+			}
+			got, fromCookie, err := requestToken(r)
+			if (err != nil) != tt.wantErr || got != tt.want || fromCookie != tt.fromCookie {
+				t.Errorf("got %q, %v, %v", got, fromCookie, err)
+			}
+		})
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	claims := jwt.MapClaims{"csrf": "secret"}
+	tests := []struct {
+		name    string
+		method  string
+		header  string
+		cookie  string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{"read", "GET", "", "", claims, false},
+		{"matching", "PUT", "secret", "secret", claims, false},
+		{"no header", "POST", "", "secret", claims, true},
+		{"no cookie", "POST", "secret", "", claims, true},
+		{"header differs from cookie", "DELETE", "other", "secret", claims, true},
+		{"planted cookie", "PUT", "planted", "planted", claims, true},
+		{"token without claim", "PUT", "secret", "secret", jwt.MapClaims{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				r.Header.Set("Cookie", CSRFCookie+"="+tt.cookie)
+			}
+			if err := checkCSRF(r, tt.claims); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
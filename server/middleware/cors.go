@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"os"
+	"strings"
+)
+
+// The React client of local development, allowed when CORS_ORIGINS is not set
+const defaultOrigin = "http://localhost:3000"
+
+// AllowedOrigins returns the origins of the web clients that may call the
+// API from a browser, the comma separated list in CORS_ORIGINS. They are
+// sent credentials, so there is no wildcard.
+func AllowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return []string{defaultOrigin}
+	}
+	return origins
+}
+
+// OriginAllowed reports whether a request's Origin header names one of the
+// allowed origins.
+func OriginAllowed(origin string) bool {
+	for _, allowed := range AllowedOrigins() {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
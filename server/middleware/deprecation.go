@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Calls of deprecated routes since the server started, by "METHOD path"
+var (
+	deprecatedMu    sync.Mutex
+	deprecatedCalls = map[string]int64{}
+)
+
+// Deprecated serves next on a route that has a successor and is going away.
+// Every response announces it with the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers and links the successor, and every call is counted so
+// the route can be retired once nobody uses it anymore.
+func Deprecated(route, successor string, deprecatedAt, sunset time.Time, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecatedAt.Unix()))
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+
+		deprecatedMu.Lock()
+		deprecatedCalls[route]++
+		calls := deprecatedCalls[route]
+		deprecatedMu.Unlock()
+		log.Printf("Deprecated route %s called (%d calls since start), use %s", route, calls, successor)
+
+		next(w, r)
+	}
+}
+
+// DeprecatedCalls returns how often each deprecated route was called since
+// the server started.
+func DeprecatedCalls() map[string]int64 {
+	deprecatedMu.Lock()
+	defer deprecatedMu.Unlock()
+	calls := make(map[string]int64, len(deprecatedCalls))
+	for route, n := range deprecatedCalls {
+		calls[route] = n
+	}
+	return calls
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tokens are signed with one private key of the keyset and carry its key id
+// in the kid header. Every key of the keyset verifies the tokens it signed,
+// so a new signing key can be added without logging anybody out: the old
+// key stays until its last token expired. Other services verify tokens with
+// the public keys published as a JWK Set.
+//
+// A keyset is a folder of PEM files named after their key id. <kid>.pem is
+// an RSA (RS256) or Ed25519 (EdDSA) private key, <kid>.pub.pem the public
+// key of a key that only verifies anymore.
+
+// RSA keys shorter than this are refused
+const minRSABits = 2048
+
+// Key ids of generated keys start with the date, so the newest sorts last
+const generatedKIDLayout = "2006-01-02"
+
+// KeySet holds the key tokens are signed with and the keys they are
+// verified with, along with the issuer and audience of every token.
+type KeySet struct {
+	signingKID string
+	signingKey crypto.Signer
+	verifying  map[string]verifyingKey
+	issuer     string
+	audience   string
+}
+
+type verifyingKey struct {
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// LoadKeySet reads the keys in dir. Tokens are signed with the private key
+// named signingKID, or with the last private key by name when it is empty.
+func LoadKeySet(dir, signingKID, issuer, audience string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	ks := &KeySet{verifying: map[string]verifyingKey{}, issuer: issuer, audience: audience}
+	var private []string
+	signers := map[string]crypto.Signer{}
+	for _, file := range files {
+		name := filepath.Base(file)
+		kid := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+		if _, ok := ks.verifying[kid]; ok {
+			return nil, fmt.Errorf("key %q is in the keyset twice", kid)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", name, err)
+		}
+
+		public := key
+		if signer, ok := key.(crypto.Signer); ok {
+			if strings.HasSuffix(name, ".pub.pem") {
+				return nil, fmt.Errorf("key %s: private key in a public key file", name)
+			}
+			signers[kid] = signer
+			private = append(private, kid)
+			public = signer.Public()
+		}
+		method, err := signingMethod(public)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", name, err)
+		}
+		ks.verifying[kid] = verifyingKey{method: method, key: public}
+	}
+
+	if signingKID == "" && len(private) > 0 {
+		signingKID = private[len(private)-1]
+	}
+	signer, ok := signers[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("no private key %q in %s", signingKID, dir)
+	}
+	ks.signingKID, ks.signingKey = signingKID, signer
+	return ks, nil
+}
+
+// parseKey reads a PKCS #8 or PKCS #1 private key, or a PKIX public key.
+func parseKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// signingMethod picks the algorithm of a public key.
+func signingMethod(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key has %d bits, at least %d are needed", k.N.BitLen(), minRSABits)
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", key)
+}
+
+// GenerateKey writes a new Ed25519 private key into dir and returns its key id.
+func GenerateKey(dir string, now time.Time) (string, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	kid := fmt.Sprintf("%s-%x", now.UTC().Format(generatedKIDLayout), suffix)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		return "", err
+	}
+	return kid, nil
+}
+
+// Sign adds the issuer, audience and time of issue to claims and signs them
+// with the signing key.
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = ks.issuer
+	claims["aud"] = ks.audience
+	claims["iat"] = time.Now().Unix()
+
+	token := jwt.NewWithClaims(ks.verifying[ks.signingKID].method, claims)
+	token.Header["kid"] = ks.signingKID
+	return token.SignedString(ks.signingKey)
+}
+
+// Parse verifies a token with the key named by its kid header, and checks
+// that it was issued by us for us, has a time of issue and has not expired.
+func (ks *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, ks.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithAudience(ks.audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || claims["iat"] == nil {
+		return nil, fmt.Errorf("token has no iat claim")
+	}
+	return token, nil
+}
+
+func (ks *KeySet) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.verifying[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// JWK is a public key as RFC 7517 writes it.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // Ed25519
+	X         string `json:"x,omitempty"`   // Ed25519 public key
+}
+
+// JWKSet is the document of the /.well-known/jwks.json endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verifying key, sorted by key id.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for kid, key := range ks.verifying {
+		jwk := JWK{KeyID: kid, Use: "sig", Algorithm: key.method.Alg()}
+		switch k := key.key.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadKeys(t *testing.T, dir, signingKID string) *KeySet {
+	t.Helper()
+	ks, err := LoadKeySet(dir, signingKID, "issuer", "audience")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return ks
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKID, err := GenerateKey(dir, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := loadKeys(t, dir, "")
+	token, err := old.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := old.Parse(token)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if parsed.Header["kid"] != oldKID || parsed.Method != jwt.SigningMethodEdDSA {
+		t.Errorf("Header: got %v", parsed.Header)
+	}
+
+	// A newer RSA key signs, the old key still verifies
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "2026-02-01-rsa.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	rotated := loadKeys(t, dir, "")
+	if _, err := rotated.Parse(token); err != nil {
+		t.Errorf("Old token after rotation: %v", err)
+	}
+	token, err = rotated.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err := rotated.Parse(token); err != nil || parsed.Header["kid"] != "2026-02-01-rsa" || parsed.Method != jwt.SigningMethodRS256 {
+		t.Errorf("New token: got %v, %v", parsed, err)
+	}
+	if _, err := old.Parse(token); err == nil {
+		t.Errorf("Keyset without the new key accepted its token")
+	}
+
+	// JWT_SIGNING_KEY picks the signing key
+	if ks := loadKeys(t, dir, oldKID); ks.signingKID != oldKID {
+		t.Errorf("Signing key: got %s, want %s", ks.signingKID, oldKID)
+	}
+
+	// Only the public half of the old key is left
+	private, err := os.ReadFile(filepath.Join(dir, oldKID+".pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parseKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.(crypto.Signer).Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, oldKID+".pem"))
+	writePEM(t, filepath.Join(dir, oldKID+".pub.pem"), "PUBLIC KEY", der)
+	oldToken, _ := old.Sign(claims())
+	if _, err := loadKeys(t, dir, "").Parse(oldToken); err != nil {
+		t.Errorf("Old token verified by the public key: %v", err)
+	}
+	if _, err := LoadKeySet(dir, oldKID, "issuer", "audience"); err == nil {
+		t.Errorf("A public key was accepted as the signing key")
+	}
+
+	set := rotated.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].KeyID != oldKID || set.Keys[0].KeyType != "OKP" || set.Keys[0].X == "" ||
+		set.Keys[1].KeyType != "RSA" || set.Keys[1].Algorithm != "RS256" || set.Keys[1].E != "AQAB" {
+		t.Errorf("JWKS: got %+v", set)
+	}
+}
+
+func TestLoadKeySetRejects(t *testing.T) {
+	dir := t.TempDir()
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "short.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(short))
+	if _, err := LoadKeySet(dir, "", "issuer", "audience"); err == nil {
+		t.Errorf("1024 bit RSA key was accepted")
+	}
+	if _, err := LoadKeySet(t.TempDir(), "", "issuer", "audience"); err == nil {
+		t.Errorf("Empty keyset was accepted")
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateKey(dir, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ks := loadKeys(t, dir, "")
+
+	other := t.TempDir()
+	if _, err := GenerateKey(other, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	otherKeys := loadKeys(t, other, "")
+
+	sign := func(edit func(token *jwt.Token)) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"iss": "issuer", "aud": "audience", "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = ks.signingKID
+		edit(token)
+		signed, err := token.SignedString(ks.signingKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	hs256 := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	hs256.Header["kid"] = ks.signingKID
+	secret, _ := hs256.SignedString([]byte("secret"))
+	foreign, _ := otherKeys.Sign(claims())
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong issuer", sign(func(token *jwt.Token) { token.Claims.(jwt.MapClaims)["iss"] = "someone" })},
+		{"wrong audience", sign(func(token *jwt.Token) { token.Claims.(jwt.MapClaims)["aud"] = "another-api" })},
+		{"no iat", sign(func(token *jwt.Token) { delete(token.Claims.(jwt.MapClaims), "iat") })},
+		{"issued in the future", sign(func(token *jwt.Token) { token.Claims.(jwt.MapClaims)["iat"] = time.Now().Add(time.Hour).Unix() })},
+		{"no exp", sign(func(token *jwt.Token) { delete(token.Claims.(jwt.MapClaims), "exp") })},
+		{"expired", sign(func(token *jwt.Token) { token.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(-time.Hour).Unix() })},
+		{"no kid", sign(func(token *jwt.Token) { delete(token.Header, "kid") })},
+		{"unknown kid", foreign},
+		{"HS256", secret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ks.Parse(tt.token); err == nil {
+				t.Errorf("token was accepted")
+			}
+		})
+	}
+	if _, err := ks.Parse(sign(func(*jwt.Token) {})); err != nil {
+		t.Errorf("Valid token: %v", err)
+	}
+}
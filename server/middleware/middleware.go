@@ -1,73 +1,133 @@
 package middleware
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 )
 
-// jwtSecretKey holds the JWT secret key
-var jwtSecretKey []byte
+// Defaults for the settings of config.env that are left empty
+const (
+	defaultKeysDir  = "../server/keys"
+	defaultIssuer   = "match-me"
+	defaultAudience = "match-me-api"
+)
+
+// keySet holds the keys tokens are signed and verified with
+var (
+	keySetMu sync.Mutex
+	keySet   *KeySet
+)
 
-// LoadJWTSecretKey loads the JWT secret key from environment variables or .env file
-func LoadJWTSecretKey() []byte {
+// LoadKeys loads the keyset in JWT_KEYS_DIR from environment variables or
+// .env file. A folder without any key gets a new Ed25519 key, so a
+// development server starts without setup.
+func LoadKeys() *KeySet {
 	// Load environment variables from .env file (optional)
 	err := godotenv.Load("../server/config.env")
 	if err != nil {
 		log.Printf("Error loading config.env file: %v", err)
 	}
 
-	// Get JWT_SECRET_KEY from environment variables
-	jwtSecretKeyEnv := os.Getenv("JWT_SECRET_KEY")
-	if jwtSecretKeyEnv == "" {
-		log.Fatal("JWT_SECRET_KEY is not set in environment variables")
+	dir := envOr("JWT_KEYS_DIR", defaultKeysDir)
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.pem")); len(files) == 0 {
+		kid, err := GenerateKey(dir, time.Now())
+		if err != nil {
+			log.Fatalf("Error generating a JWT signing key: %v", err)
+		}
+		log.Printf("No JWT keys in %s, generated the signing key %s", dir, kid)
+	}
+
+	ks, err := LoadKeySet(dir, os.Getenv("JWT_SIGNING_KEY"), envOr("JWT_ISSUER", defaultIssuer), envOr("JWT_AUDIENCE", defaultAudience))
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
 	}
+	log.Printf("Signing tokens with key %s", ks.signingKID)
 
-	// Set and return the secret key
-	jwtSecretKey = []byte(jwtSecretKeyEnv)
-	return jwtSecretKey
+	SetKeys(ks)
+	return ks
 }
 
-// GetJWTSecretKey provides access to the loaded JWT secret key
-func GetJWTSecretKey() []byte {
-	if jwtSecretKey == nil {
-		LoadJWTSecretKey()
+// GetKeys provides access to the loaded keyset, loading it on first use.
+func GetKeys() *KeySet {
+	keySetMu.Lock()
+	ks := keySet
+	keySetMu.Unlock()
+	if ks == nil {
+		ks = LoadKeys()
 	}
-	return jwtSecretKey
+	return ks
 }
 
-// ValidateToken validates the JWT token from the Authorization header.
-func ValidateToken(r *http.Request) (*jwt.Token, error) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return nil, fmt.Errorf("missing authorization header")
+// SetKeys replaces the keyset, tests use one of their own.
+func SetKeys(ks *KeySet) {
+	keySetMu.Lock()
+	keySet = ks
+	keySetMu.Unlock()
+}
+
+// SignToken signs claims with the signing key of the keyset.
+func SignToken(claims jwt.MapClaims) (string, error) {
+	return GetKeys().Sign(claims)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
 	}
+	return fallback
+}
 
-	// Extract the token from the Authorization header: "Bearer <token>"
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return nil, fmt.Errorf("invalid token format")
+// ValidateToken validates the JWT token from the Authorization header, or
+// from the token cookie when there is no header. A token from the cookie
+// also needs the CSRF header on requests that change something.
+func ValidateToken(r *http.Request) (*jwt.Token, error) {
+	return validateToken(r, !safeMethod(r.Method))
+}
+
+// validateToken is ValidateToken, loading the account instead of taking it
+// from the cache when fresh is set.
+func validateToken(r *http.Request, fresh bool) (*jwt.Token, error) {
+	token, fromCookie, err := parseToken(r)
+	if err != nil {
+		return nil, err
 	}
 
-	tokenString := parts[1]
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if fromCookie {
+			if err := checkCSRF(r, claims); err != nil {
+				return nil, err
+			}
+		}
 
-	// Parse the token and validate it with the secret key
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate token signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
+		// Banned, suspended and demoted users lose access before their token expires
+		if err := checkAccount(claims, fresh); err != nil {
+			return nil, err
 		}
-		return jwtSecretKey, nil
-	})
+	}
 
+	return token, nil
+}
+
+// parseToken checks the signature and expiry of the request's token, without
+// looking at the account it belongs to. It reports whether the token came
+// from the cookie.
+func parseToken(r *http.Request) (*jwt.Token, bool, error) {
+	tokenString, fromCookie, err := requestToken(r)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return token, nil
+	// Verify the token with the key it names
+	token, err := GetKeys().Parse(tokenString)
+	if err != nil {
+		return nil, false, err
+	}
+	return token, fromCookie, nil
 }
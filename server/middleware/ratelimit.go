@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Limit is a token bucket: a client may send Requests at once and gets them
+// back evenly over Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads a limit written as requests/period, like "10/1m".
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, want requests/period", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid number of requests in rate limit %q", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in rate limit %q", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// perSecond is how many requests the bucket gets back every second.
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// RateStore keeps the token buckets of the rate limiter. The memory store
+// serves a single server, several servers behind one address need a store
+// they share.
+type RateStore interface {
+	// Take removes a token from the bucket of key. It reports whether there
+	// was one, and if not how long until the next one is back.
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// Idle buckets are dropped at most this often
+const rateStorePruneInterval = time.Minute
+
+// MemoryRateStore keeps the buckets in the server process. Buckets that
+// filled up again are forgotten, a client that comes back starts full anyway.
+type MemoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket is full again if nothing is taken
+}
+
+// NewMemoryRateStore returns an empty store.
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{buckets: map[string]*bucket{}}
+}
+
+// Take refills the bucket for the time since it was last used before taking
+// a token. A new key starts with a full bucket.
+func (s *MemoryRateStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPrune) >= rateStorePruneInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	rate := limit.perSecond()
+	capacity := float64(limit.Requests)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	} else if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed.Seconds()*rate)
+		b.updated = now
+	}
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = b.updated.Add(secondsDuration((capacity - b.tokens) / rate))
+	if allowed {
+		return true, 0, nil
+	}
+	return false, secondsDuration((1 - b.tokens) / rate), nil
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimiter limits how fast each client calls the routes of a group. A
+// client is the user of a valid token, or the IP address of a request
+// without one. A nil RateLimiter lets every request through.
+type RateLimiter struct {
+	store   RateStore
+	limits  map[string]Limit
+	trusted []*net.IPNet
+}
+
+// DefaultRateGroup is the group of every route that is not put in another one
+const DefaultRateGroup = "default"
+
+// NewRateLimiter limits each group to its limit, a group without one falls
+// back to the limit of DefaultRateGroup. X-Forwarded-For is only believed
+// when the request comes from one of the trusted proxies, given as addresses
+// or CIDR ranges.
+func NewRateLimiter(store RateStore, limits map[string]Limit, trustedProxies []string) (*RateLimiter, error) {
+	if _, ok := limits[DefaultRateGroup]; !ok {
+		return nil, fmt.Errorf("no rate limit for the %q group", DefaultRateGroup)
+	}
+	l := &RateLimiter{store: store, limits: limits}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		l.trusted = append(l.trusted, network)
+	}
+	return l, nil
+}
+
+// RateLimiterFromEnv builds the rate limiter configured in config.env. The
+// limit of a group is read from RATE_LIMIT_<GROUP>, the defaults are used
+// for the groups that are not set.
+func RateLimiterFromEnv(defaults map[string]Limit) (*RateLimiter, error) {
+	limits := make(map[string]Limit, len(defaults))
+	for group, limit := range defaults {
+		if value := os.Getenv("RATE_LIMIT_" + strings.ToUpper(group)); value != "" {
+			var err error
+			if limit, err = ParseLimit(value); err != nil {
+				return nil, err
+			}
+		}
+		limits[group] = limit
+	}
+
+	var store RateStore
+	switch kind := os.Getenv("RATE_LIMIT_STORE"); kind {
+	case "", "memory":
+		store = NewMemoryRateStore()
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", kind)
+	}
+
+	return NewRateLimiter(store, limits, strings.Split(os.Getenv("TRUSTED_PROXIES"), ","))
+}
+
+// RateLimit serves next while the client has requests left in the group,
+// and answers 429 Too Many Requests with a Retry-After header otherwise.
+func (l *RateLimiter) RateLimit(group string, next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	limit, ok := l.limits[group]
+	if !ok {
+		limit = l.limits[DefaultRateGroup]
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := group + ":" + l.client(r)
+		allowed, retryAfter, err := l.store.Take(key, limit, time.Now())
+		if err != nil {
+			// A broken store must not take the whole API down with it
+			log.Printf("Error checking rate limit of %s: %v", key, err)
+			next(w, r)
+			return
+		}
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// client names who sent the request. The token is only checked for its
+// signature, an account that may no longer use it is turned away by the
+// handler after the limit was counted.
+func (l *RateLimiter) client(r *http.Request) string {
+	if token, _, err := parseToken(r); err == nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if userID, ok := claims["user_id"].(string); ok && userID != "" {
+				return "user:" + userID
+			}
+		}
+	}
+	return "ip:" + l.clientIP(r)
+}
+
+// clientIP is the address the request came from. Behind trusted proxies it
+// is the last address in X-Forwarded-For that is not one of them, the ones
+// before it could have been made up by the client.
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !l.isTrusted(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !l.isTrusted(hop) {
+			break
+		}
+	}
+	return host
+}
+
+func (l *RateLimiter) isTrusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateStore(t *testing.T) {
+	store := NewMemoryRateStore()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	start := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := store.Take("a", limit, start); !ok {
+			t.Fatalf("Request %d of a full bucket was refused", i+1)
+		}
+	}
+	ok, retryAfter, _ := store.Take("a", limit, start)
+	if ok {
+		t.Fatal("Request of an empty bucket was allowed")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("Retry after: got %v, want %v", retryAfter, time.Second)
+	}
+
+	// Other keys have their own bucket
+	if ok, _, _ := store.Take("b", limit, start); !ok {
+		t.Error("Request of another key was refused")
+	}
+
+	// A token is back after a third of the period
+	if ok, _, _ := store.Take("a", limit, start.Add(time.Second)); !ok {
+		t.Error("Request after the refill was refused")
+	}
+	if ok, _, _ := store.Take("a", limit, start.Add(time.Second)); ok {
+		t.Error("Second request after a single refill was allowed")
+	}
+
+	// Full buckets are forgotten once the store prunes
+	store.Take("c", limit, start.Add(time.Hour))
+	if len(store.buckets) != 1 {
+		t.Errorf("Buckets after pruning: got %d, want 1", len(store.buckets))
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10/1m")
+	if err != nil || limit != (Limit{Requests: 10, Period: time.Minute}) {
+		t.Errorf("ParseLimit(10/1m): got %+v, %v", limit, err)
+	}
+	for _, invalid := range []string{"", "10", "0/1m", "x/1m", "10/0s", "10/minute"} {
+		if _, err := ParseLimit(invalid); err == nil {
+			t.Errorf("ParseLimit(%q) was accepted", invalid)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	limiter, err := NewRateLimiter(NewMemoryRateStore(), map[string]Limit{DefaultRateGroup: {1, time.Minute}}, []string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"untrusted proxy", "203.0.113.5:4000", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:4000", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "192.0.2.7:4000", "198.51.100.1, 10.0.0.1", "198.51.100.1"},
+		{"made up hops", "10.1.2.3:4000", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+		{"garbage", "10.1.2.3:4000", "not-an-ip", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := limiter.clientIP(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter, err := NewRateLimiter(NewMemoryRateStore(), map[string]Limit{
+		DefaultRateGroup: {1, time.Minute},
+		"auth":           {2, time.Minute},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	auth := limiter.RateLimit("auth", ok)
+	other := limiter.RateLimit("unknown", ok)
+
+	call := func(handler http.HandlerFunc, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := call(auth, "203.0.113.5:4000"); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: got status %d", i+1, w.Code)
+		}
+	}
+	w := call(auth, "203.0.113.5:4000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Request over the limit: got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After: got %q, want 30", got)
+	}
+
+	// Other clients and groups are counted apart, unknown groups get the default
+	if w := call(auth, "203.0.113.6:4000"); w.Code != http.StatusOK {
+		t.Errorf("Another client: got status %d", w.Code)
+	}
+	if w := call(other, "203.0.113.5:4000"); w.Code != http.StatusOK {
+		t.Errorf("Another group: got status %d", w.Code)
+	}
+	if w := call(other, "203.0.113.5:4000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Default limit: got status %d", w.Code)
+	}
+
+	var nilLimiter *RateLimiter
+	if w := call(nilLimiter.RateLimit("auth", ok), "203.0.113.5:4000"); w.Code != http.StatusOK {
+		t.Errorf("Without a limiter: got status %d", w.Code)
+	}
+}
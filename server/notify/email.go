@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends a plain text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// MailerFromEnv creates the mailer selected by MAILER. Only "file" is
+// supported so far, it writes into MAIL_DIR.
+func MailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Match Me <no-reply@localhost>"
+	}
+	switch kind := os.Getenv("MAILER"); kind {
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir, from)
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+}
+
+// FileMailer writes every email as an .eml file into a directory instead of
+// sending it, for development and tests.
+type FileMailer struct {
+	dir  string
+	from string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewFileMailer creates the directory if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating mail directory: %v", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	// Header values must not be able to add headers of their own
+	header := strings.NewReplacer("\r", "", "\n", "")
+	to, subject = header.Replace(to), header.Replace(subject)
+
+	now := time.Now().UTC()
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		m.from, to, subject, now.Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	name := fmt.Sprintf("%s-%04d.eml", now.Format("20060102T150405.000000000"), seq)
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(message), 0o644)
+}
+
+// Email sends notifications to the address of the user.
+type Email struct {
+	mailer Mailer
+}
+
+func NewEmail(mailer Mailer) Email {
+	return Email{mailer: mailer}
+}
+
+func (Email) Channel() string { return ChannelEmail }
+
+func (e Email) Notify(db *sql.DB, n *Notification) error {
+	var address, firstName string
+	var actorName sql.NullString
+	err := db.QueryRow(`
+		SELECT i.email, i.first_name, (SELECT a.first_name FROM user_info a WHERE a.user_uuid::text = $2)
+		FROM user_info i WHERE i.user_uuid = $1`, n.UserID, n.ActorID).Scan(&address, &firstName, &actorName)
+	if err != nil {
+		return fmt.Errorf("error looking up email address: %v", err)
+	}
+	if address == "" {
+		return nil
+	}
+
+	subject, text := emailText(n.Kind, actorName.String)
+	body := fmt.Sprintf("Hi %s,\n\n%s\n\nYou can change which emails you get in your notification settings.", firstName, text)
+	return e.mailer.Send(address, subject, body)
+}
+
+// emailText returns the subject and main sentence of the email for a kind.
+func emailText(kind, actor string) (string, string) {
+	if actor == "" {
+		actor = "Someone"
+	}
+	switch kind {
+	case KindConnectionRequest:
+		return "New connection request", actor + " would like to connect with you."
+	case KindConnectionAccepted:
+		return "Connection accepted", actor + " accepted your connection request."
+	case KindMatch:
+		return "It's a match", "You and " + actor + " like each other."
+	case KindMessage:
+		return "New message", actor + " sent you a message."
+	}
+	return "New notification", "You have a new notification."
+}
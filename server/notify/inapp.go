@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// InApp stores notifications in the notifications table, where the
+// notification endpoints list them.
+type InApp struct{}
+
+func (InApp) Channel() string { return ChannelInApp }
+
+func (InApp) Notify(db *sql.DB, n *Notification) error {
+	payload, err := json.Marshal(n.Payload)
+	if err != nil {
+		return fmt.Errorf("error encoding payload: %v", err)
+	}
+	var actor *string
+	if n.ActorID != "" {
+		actor = &n.ActorID
+	}
+	err = db.QueryRow(`
+		INSERT INTO notifications (user_uuid, kind, actor_uuid, payload, datetime_created)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, n.UserID, n.Kind, actor, payload, n.CreatedAt).Scan(&n.ID)
+	if err != nil {
+		return fmt.Errorf("error saving notification: %v", err)
+	}
+	return nil
+}
+
+// List returns the newest notifications of a user with an ID below before,
+// or the newest ones when before is zero.
+func List(db *sql.DB, userID string, unreadOnly bool, before int64, limit int) ([]Notification, error) {
+	rows, err := db.Query(`
+		SELECT id, kind, coalesce(actor_uuid::text, ''), payload, datetime_created, read_at
+		FROM notifications
+		WHERE user_uuid = $1
+		  AND (NOT $2 OR read_at IS NULL)
+		  AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4`, userID, unreadOnly, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying notifications: %v", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		n := Notification{UserID: userID}
+		var payload []byte
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.Kind, &n.ActorID, &payload, &n.CreatedAt, &readAt); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %v", err)
+		}
+		if err := json.Unmarshal(payload, &n.Payload); err != nil {
+			return nil, fmt.Errorf("error decoding notification %d: %v", n.ID, err)
+		}
+		if readAt.Valid {
+			t := readAt.Time
+			n.ReadAt = &t
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadCount counts the unread notifications of a user.
+func UnreadCount(db *sql.DB, userID string) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM notifications WHERE user_uuid = $1 AND read_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting notifications: %v", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks notifications of a user as read, all of them when ids is
+// empty. It returns how many changed.
+func MarkRead(db *sql.DB, userID string, ids []int64, at time.Time) (int64, error) {
+	query := "UPDATE notifications SET read_at = $2 WHERE user_uuid = $1 AND read_at IS NULL"
+	args := []interface{}{userID, at}
+	if len(ids) > 0 {
+		query += " AND id = ANY($3)"
+		args = append(args, pq.Array(ids))
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error marking notifications read: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,146 @@
+// Package notify tells users about things that happened to them, such as a
+// new connection request or a mutual match. A Center fans every notification
+// out to the channels the user enabled for its kind.
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Notification kinds
+const (
+	KindConnectionRequest  = "connection_request"
+	KindConnectionAccepted = "connection_accepted"
+	KindMatch              = "match"
+	KindMessage            = "message"
+)
+
+// Kinds lists every notification kind users have preferences for.
+var Kinds = []string{KindConnectionRequest, KindConnectionAccepted, KindMatch, KindMessage}
+
+// Delivery channels
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+// Channels lists every delivery channel in the order they are tried.
+var Channels = []string{ChannelInApp, ChannelEmail, ChannelPush}
+
+// Notification is a single event for a user.
+type Notification struct {
+	ID        int64                  `json:"id"`
+	UserID    string                 `json:"-"`
+	Kind      string                 `json:"kind"`
+	ActorID   string                 `json:"actor_id,omitempty"` // the user who caused it, if any
+	Payload   map[string]interface{} `json:"payload"`
+	CreatedAt time.Time              `json:"created_at"`
+	ReadAt    *time.Time             `json:"read_at"`
+}
+
+// Notifier delivers notifications over one channel. The in-app notifier
+// stores the notification and sets its ID, it runs before the others.
+type Notifier interface {
+	Channel() string
+	Notify(db *sql.DB, n *Notification) error
+}
+
+// Preferences maps a kind to the channels enabled for it.
+type Preferences map[string]map[string]bool
+
+// DefaultPreferences are used for every kind a user has not configured.
+// Connection requests are frequent, so they are not emailed unless asked for.
+func DefaultPreferences() Preferences {
+	prefs := Preferences{}
+	for _, kind := range Kinds {
+		prefs[kind] = map[string]bool{ChannelInApp: true, ChannelEmail: kind != KindConnectionRequest, ChannelPush: true}
+	}
+	return prefs
+}
+
+// LoadPreferences reads the notification preferences of a user, filling in
+// the defaults for kinds without a row.
+func LoadPreferences(db *sql.DB, userID string) (Preferences, error) {
+	prefs := DefaultPreferences()
+	rows, err := db.Query("SELECT kind, in_app, email, push FROM notification_prefs WHERE user_uuid = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying notification preferences: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var inApp, email, push bool
+		if err := rows.Scan(&kind, &inApp, &email, &push); err != nil {
+			return nil, fmt.Errorf("error scanning notification preferences: %v", err)
+		}
+		if _, known := prefs[kind]; known {
+			prefs[kind] = map[string]bool{ChannelInApp: inApp, ChannelEmail: email, ChannelPush: push}
+		}
+	}
+	return prefs, rows.Err()
+}
+
+// SavePreferences stores the channels of one kind for a user.
+func SavePreferences(db *sql.DB, userID, kind string, channels map[string]bool) error {
+	_, err := db.Exec(`
+		INSERT INTO notification_prefs (user_uuid, kind, in_app, email, push)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_uuid, kind) DO UPDATE
+		SET in_app = EXCLUDED.in_app, email = EXCLUDED.email, push = EXCLUDED.push`,
+		userID, kind, channels[ChannelInApp], channels[ChannelEmail], channels[ChannelPush])
+	if err != nil {
+		return fmt.Errorf("error saving notification preferences: %v", err)
+	}
+	return nil
+}
+
+// Center sends notifications through a set of notifiers.
+type Center struct {
+	notifiers []Notifier
+}
+
+// NewCenter creates a Center, the in-app notifier is moved to the front so
+// the other channels see the stored ID.
+func NewCenter(notifiers ...Notifier) *Center {
+	c := &Center{}
+	for _, n := range notifiers {
+		if n.Channel() == ChannelInApp {
+			c.notifiers = append([]Notifier{n}, c.notifiers...)
+		} else {
+			c.notifiers = append(c.notifiers, n)
+		}
+	}
+	return c
+}
+
+// Send delivers n on every channel the user enabled for its kind. A failing
+// channel is logged and does not stop the others.
+func (c *Center) Send(db *sql.DB, n Notification) error {
+	prefs, err := LoadPreferences(db, n.UserID)
+	if err != nil {
+		return err
+	}
+	channels, known := prefs[n.Kind]
+	if !known {
+		return fmt.Errorf("unknown notification kind %q", n.Kind)
+	}
+	if n.Payload == nil {
+		n.Payload = map[string]interface{}{}
+	}
+	n.CreatedAt = time.Now().UTC()
+
+	for _, notifier := range c.notifiers {
+		if !channels[notifier.Channel()] {
+			continue
+		}
+		if err := notifier.Notify(db, &n); err != nil {
+			log.Printf("Error delivering %s notification to %s over %s: %v", n.Kind, n.UserID, notifier.Channel(), err)
+		}
+	}
+	return nil
+}
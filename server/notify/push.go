@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Connections a single user can keep open, the oldest is closed beyond that.
+	maxSocketsPerUser = 5
+
+	// Messages waiting for a slow client before it is disconnected.
+	sendBuffer = 16
+
+	writeTimeout = 10 * time.Second
+	pongTimeout  = 60 * time.Second
+	pingInterval = pongTimeout * 9 / 10
+)
+
+// Hub keeps the open WebSocket connections of every user of this server
+// process. A user connected to another instance does not get pushes from here.
+type Hub struct {
+	mu      sync.Mutex
+	sockets map[string][]*socket
+}
+
+type socket struct {
+	conn *websocket.Conn
+	send chan []byte
+	done chan struct{} // closed to make the writer hang up
+	once sync.Once
+}
+
+func (s *socket) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func NewHub() *Hub {
+	return &Hub{sockets: map[string][]*socket{}}
+}
+
+// Serve pushes to conn until the client goes away. It blocks, so it is
+// called from the handler that upgraded the connection.
+func (h *Hub) Serve(conn *websocket.Conn, userID string) {
+	s := &socket{conn: conn, send: make(chan []byte, sendBuffer), done: make(chan struct{})}
+
+	h.mu.Lock()
+	sockets := append(h.sockets[userID], s)
+	if len(sockets) > maxSocketsPerUser {
+		sockets[0].close()
+		sockets = sockets[1:]
+	}
+	h.sockets[userID] = sockets
+	h.mu.Unlock()
+
+	defer h.remove(userID, s)
+	go h.read(s)
+	h.write(s)
+}
+
+// read drops everything the client sends, it is only needed to handle pongs
+// and notice a closed connection.
+func (h *Hub) read(s *socket) {
+	defer s.close()
+	s.conn.SetReadLimit(512)
+	s.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	for {
+		if _, _, err := s.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (h *Hub) write(s *socket) {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	defer s.conn.Close()
+
+	for {
+		select {
+		case <-s.done:
+			s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case message := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := s.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ping.C:
+			s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) remove(userID string, s *socket) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sockets := h.sockets[userID]
+	for i, other := range sockets {
+		if other == s {
+			sockets = append(sockets[:i:i], sockets[i+1:]...)
+			break
+		}
+	}
+	if len(sockets) == 0 {
+		delete(h.sockets, userID)
+	} else {
+		h.sockets[userID] = sockets
+	}
+	s.close()
+}
+
+// Publish queues a message for every connection of a user. A connection that
+// cannot keep up is closed rather than blocking the sender.
+func (h *Hub) Publish(userID string, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.sockets[userID] {
+		select {
+		case s.send <- message:
+		default:
+			s.close()
+		}
+	}
+}
+
+// Push sends notifications to the open WebSocket connections of the user.
+type Push struct {
+	hub *Hub
+}
+
+func NewPush(hub *Hub) Push {
+	return Push{hub: hub}
+}
+
+func (Push) Channel() string { return ChannelPush }
+
+func (p Push) Notify(db *sql.DB, n *Notification) error {
+	message, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+	p.hub.Publish(n.UserID, message)
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package photo turns uploaded images into the variants stored for a profile.
+// Decoding and encoding again drops EXIF and every other kind of metadata,
+// the EXIF orientation is applied to the pixels first so photos stay upright.
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxUploadBytes is the largest file accepted for upload.
+	MaxUploadBytes = 10 << 20
+
+	// Images with more pixels are refused before decoding to protect the server's memory.
+	maxPixels = 40_000_000
+
+	// Smallest side an uploaded photo may have.
+	minSide = 200
+
+	jpegQuality = 85
+)
+
+// Sizes are the variants stored for every photo, with the longest side they are scaled down to.
+var Sizes = map[string]int{
+	"full":  1600,
+	"thumb": 320,
+}
+
+var (
+	ErrUnsupportedType = errors.New("only JPEG, PNG, GIF and WebP images are accepted")
+	ErrTooLarge        = errors.New("image is too large")
+	ErrTooSmall        = fmt.Errorf("image must be at least %d pixels on each side", minSide)
+)
+
+// Variant is an encoded image ready to be stored.
+type Variant struct {
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// Processed holds every variant of an upload, they share one content type.
+type Processed struct {
+	ContentType string
+	Extension   string
+	Variants    map[string]Variant
+}
+
+// Process checks the real type of an upload from its content, never from the
+// name or header the client sent, and produces the stored variants. PNG stays
+// PNG to keep transparency, everything else becomes JPEG.
+func Process(data []byte) (Processed, error) {
+	var p Processed
+
+	sniffed := http.DetectContentType(data)
+	switch sniffed {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return p, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return p, ErrUnsupportedType
+	}
+	if config.Width*config.Height > maxPixels {
+		return p, ErrTooLarge
+	}
+	if config.Width < minSide || config.Height < minSide {
+		return p, ErrTooSmall
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return p, fmt.Errorf("error decoding image: %v", err)
+	}
+	if sniffed == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	encode := func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return buf.Bytes(), err
+	}
+	p.ContentType, p.Extension = "image/jpeg", "jpg"
+	if sniffed == "image/png" {
+		encode = func(img image.Image) ([]byte, error) {
+			var buf bytes.Buffer
+			err := png.Encode(&buf, img)
+			return buf.Bytes(), err
+		}
+		p.ContentType, p.Extension = "image/png", "png"
+	}
+
+	p.Variants = make(map[string]Variant, len(Sizes))
+	for name, longest := range Sizes {
+		scaled := fit(img, longest)
+		encoded, err := encode(scaled)
+		if err != nil {
+			return p, fmt.Errorf("error encoding %s image: %v", name, err)
+		}
+		p.Variants[name] = Variant{Data: encoded, Width: scaled.Bounds().Dx(), Height: scaled.Bounds().Dy()}
+	}
+	return p, nil
+}
+
+// fit scales img down so its longest side is at most longest pixels. Smaller
+// images keep their size but are still copied, which also flattens GIF palettes.
+func fit(img image.Image, longest int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > longest || height > longest {
+		if width >= height {
+			width, height = longest, max(1, height*longest/width)
+		} else {
+			width, height = max(1, width*longest/height), longest
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// orient rotates and mirrors img according to an EXIF orientation value.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// Orientations 5 to 8 swap width and height
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = width-1-x, y
+			case 3: // rotated 180
+				sx, sy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, height-1-y
+			case 5: // mirrored along the top-left diagonal
+				sx, sy = y, x
+			case 6: // needs a clockwise turn
+				sx, sy = y, height-1-x
+			case 7: // mirrored along the top-right diagonal
+				sx, sy = width-1-y, height-1-x
+			case 8: // needs a counter-clockwise turn
+				sx, sy = width-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads the orientation tag from the EXIF block of a JPEG,
+// returning 1 (upright) when there is none.
+func exifOrientation(data []byte) int {
+	const orientationTag = 0x0112
+
+	// Walk the JPEG segments until the APP1 segment holding EXIF
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA { // start of scan, no more metadata follows
+			return 1
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		i += 2 + length
+
+		if marker != 0xE1 || len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+			continue
+		}
+
+		tiff := segment[6:]
+		var u16 func([]byte) int
+		var u32 func([]byte) int
+		switch string(tiff[:2]) {
+		case "II":
+			u16 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 }
+			u32 = func(b []byte) int { return u16(b) | u16(b[2:])<<16 }
+		case "MM":
+			u16 = func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+			u32 = func(b []byte) int { return u16(b)<<16 | u16(b[2:]) }
+		default:
+			return 1
+		}
+
+		ifd := u32(tiff[4:])
+		if ifd < 8 || ifd+2 > len(tiff) {
+			return 1
+		}
+		entries := u16(tiff[ifd:])
+		for e := 0; e < entries; e++ {
+			entry := ifd + 2 + e*12
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			if u16(tiff[entry:]) == orientationTag {
+				return u16(tiff[entry+8:])
+			}
+		}
+		return 1
+	}
+	return 1
+}
@@ -0,0 +1,257 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gradient is an image whose every pixel differs, so rotations can be told apart.
+func gradient(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifSegment is an APP1 segment holding a single orientation tag, in Intel
+// (II) or Motorola (MM) byte order.
+func exifSegment(order string, orientation uint16) []byte {
+	var byteOrder binary.AppendByteOrder = binary.LittleEndian
+	if order == "MM" {
+		byteOrder = binary.BigEndian
+	}
+	tiff := []byte(order)
+	tiff = byteOrder.AppendUint16(tiff, 42)
+	tiff = byteOrder.AppendUint32(tiff, 8)      // offset of the first IFD
+	tiff = byteOrder.AppendUint16(tiff, 1)      // one entry
+	tiff = byteOrder.AppendUint16(tiff, 0x0112) // orientation
+	tiff = byteOrder.AppendUint16(tiff, 3)      // SHORT
+	tiff = byteOrder.AppendUint32(tiff, 1)      // one value
+	tiff = byteOrder.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)              // padding of the value
+	tiff = byteOrder.AppendUint32(tiff, 0) // no next IFD
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withExif inserts an EXIF segment right after the start of a JPEG.
+func withExif(jpegData, segment []byte) []byte {
+	data := append([]byte{}, jpegData[:2]...)
+	data = append(data, segment...)
+	return append(data, jpegData[2:]...)
+}
+
+// withSize rewrites the dimensions in the header of a PNG, leaving the pixel
+// data as it was.
+func withSize(t *testing.T, pngData []byte, width, height uint32) []byte {
+	t.Helper()
+	data := append([]byte{}, pngData...)
+	// Signature (8), IHDR length (4) and type (4), then width and height
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcess(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, gradient(400, 300), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		width       int
+		height      int
+	}{
+		{"png stays png", encodePNG(t, gradient(400, 300)), "image/png", 400, 300},
+		{"jpeg", encodeJPEG(t, gradient(300, 400)), "image/jpeg", 300, 400},
+		{"gif becomes jpeg", gifData.Bytes(), "image/jpeg", 400, 300},
+		{"large image is scaled down", encodePNG(t, image.NewGray(image.Rect(0, 0, 3200, 800))), "image/png", 1600, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Process(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.ContentType != tt.contentType {
+				t.Errorf("Content type: got %s, want %s", p.ContentType, tt.contentType)
+			}
+			full := p.Variants["full"]
+			if full.Width != tt.width || full.Height != tt.height {
+				t.Errorf("Full size: got %dx%d, want %dx%d", full.Width, full.Height, tt.width, tt.height)
+			}
+			thumb := p.Variants["thumb"]
+			if max(thumb.Width, thumb.Height) != Sizes["thumb"] {
+				t.Errorf("Thumbnail size: got %dx%d", thumb.Width, thumb.Height)
+			}
+
+			// The stored bytes are what the content type says
+			for size, v := range p.Variants {
+				config, format, err := image.DecodeConfig(bytes.NewReader(v.Data))
+				if err != nil || "image/"+format != p.ContentType || config.Width != v.Width || config.Height != v.Height {
+					t.Errorf("%s variant decodes as %s %dx%d (%v)", size, format, config.Width, config.Height, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	valid := encodePNG(t, gradient(300, 200))
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"text", []byte("hello, this is not an image"), ErrUnsupportedType},
+		{"html", []byte("<html><body><img src=x></body></html>"), ErrUnsupportedType},
+		{"png signature only", valid[:20], ErrUnsupportedType},
+		{"too small", encodePNG(t, gradient(300, 199)), ErrTooSmall},
+		{"too many pixels", withSize(t, valid, 8000, 8000), ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Process: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A valid header with the pixel data cut off fails while decoding
+	if _, err := Process(valid[:len(valid)/2]); err == nil {
+		t.Error("Process of a truncated png succeeded")
+	}
+}
+
+func TestProcessOrientationAndStripping(t *testing.T) {
+	// Stored sideways with an orientation telling viewers to turn it clockwise
+	data := withExif(encodeJPEG(t, gradient(300, 200)), exifSegment("II", 6))
+	if exifOrientation(data) != 6 {
+		t.Fatal("The fixture has no orientation")
+	}
+
+	p, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := p.Variants["full"]
+	if full.Width != 200 || full.Height != 300 {
+		t.Errorf("Turned photo: got %dx%d, want 200x300", full.Width, full.Height)
+	}
+	for size, v := range p.Variants {
+		if bytes.Contains(v.Data, []byte("Exif")) {
+			t.Errorf("%s variant still holds EXIF data", size)
+		}
+		if exifOrientation(v.Data) != 1 {
+			t.Errorf("%s variant still has an orientation", size)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	plain := encodeJPEG(t, gradient(20, 20))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", plain, 1},
+		{"intel byte order", withExif(plain, exifSegment("II", 3)), 3},
+		{"motorola byte order", withExif(plain, exifSegment("MM", 8)), 8},
+		{"unknown byte order", withExif(plain, exifSegment("XX", 6)), 1},
+		{"truncated", withExif(plain, exifSegment("II", 6))[:20], 1},
+		{"not a jpeg", []byte("GIF89a"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		if got := exifOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := gradient(3, 2)
+	// Where the top-left pixel of the stored image ends up, and the size after turning
+	tests := []struct {
+		orientation   int
+		x, y          int
+		width, height int
+	}{
+		{1, 0, 0, 3, 2},
+		{2, 2, 0, 3, 2},
+		{3, 2, 1, 3, 2},
+		{4, 0, 1, 3, 2},
+		{5, 0, 0, 2, 3},
+		{6, 1, 0, 2, 3},
+		{7, 1, 2, 2, 3},
+		{8, 0, 2, 2, 3},
+		{9, 0, 0, 3, 2}, // invalid values are ignored
+	}
+	want := src.At(0, 0)
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		if b := dst.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("Orientation %d: got %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.width, tt.height)
+			continue
+		}
+		if got := color.NRGBAModel.Convert(dst.At(tt.x, tt.y)); got != want {
+			t.Errorf("Orientation %d: pixel at %d,%d is %v, want the top-left %v", tt.orientation, tt.x, tt.y, got, want)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height int
+		longest       int
+		wantW, wantH  int
+	}{
+		{3200, 800, 1600, 1600, 400},
+		{800, 3200, 1600, 400, 1600},
+		{400, 300, 1600, 400, 300},
+		{2000, 1, 320, 320, 1},
+	}
+	for _, tt := range tests {
+		b := fit(image.NewGray(image.Rect(0, 0, tt.width, tt.height)), tt.longest).Bounds()
+		if b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("fit(%dx%d, %d): got %dx%d, want %dx%d", tt.width, tt.height, tt.longest, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
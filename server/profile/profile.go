@@ -0,0 +1,177 @@
+// Package profile validates and cleans the free text and structured fields
+// users fill in about themselves.
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Length limits in characters, they match the column sizes.
+const (
+	MaxAboutMe    = 1000
+	MaxOccupation = 100
+	MaxQuestion   = 200
+	MaxAnswer     = 300
+)
+
+const (
+	// MaxAnswers is how many prompts a user can answer on their profile.
+	MaxAnswers = 3
+
+	// MaxLanguages is how many languages a user can list.
+	MaxLanguages = 10
+
+	MinHeightCm = 100
+	MaxHeightCm = 250
+
+	// At most this many empty lines are kept in a row
+	maxBlankLines = 1
+)
+
+// RelationshipGoals are the accepted values of the relationship goal field.
+var RelationshipGoals = []string{"long_term", "short_term", "friendship", "casual", "not_sure"}
+
+var (
+	ErrEmpty            = errors.New("text cannot be empty")
+	ErrHeight           = fmt.Errorf("height must be between %d and %d cm", MinHeightCm, MaxHeightCm)
+	ErrGoal             = fmt.Errorf("relationship goal must be one of %s", strings.Join(RelationshipGoals, ", "))
+	ErrTooManyLanguages = fmt.Errorf("at most %d languages can be listed", MaxLanguages)
+	ErrTooManyAnswers   = fmt.Errorf("at most %d prompts can be answered", MaxAnswers)
+)
+
+// TooLongError is returned for text longer than its limit after cleaning.
+type TooLongError struct {
+	Max int
+}
+
+func (e TooLongError) Error() string {
+	return fmt.Sprintf("text cannot be longer than %d characters", e.Max)
+}
+
+// Clean prepares user text for storage. Entities are decoded and HTML tags
+// removed, since the text is shown as plain text, it is normalized to NFC so
+// visually equal strings compare and count equal, control and invisible
+// formatting characters are dropped and whitespace is tidied up. The limit is
+// checked on the result, in characters rather than bytes.
+func Clean(text string, max int) (string, error) {
+	text = strings.ToValidUTF8(text, "")
+	text = stripTags(html.UnescapeString(text))
+	text = norm.NFC.String(text)
+
+	var cleaned strings.Builder
+	blank := 0
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.Map(func(r rune) rune {
+			switch {
+			case unicode.IsSpace(r):
+				return ' '
+			case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+				return -1
+			}
+			return r
+		}, line))
+		line = strings.Join(strings.Fields(line), " ")
+
+		if line == "" {
+			blank++
+			if blank > maxBlankLines {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		if i > 0 {
+			cleaned.WriteByte('\n')
+		}
+		cleaned.WriteString(line)
+	}
+
+	result := strings.TrimSpace(cleaned.String())
+	if utf8.RuneCountInString(result) > max {
+		return "", TooLongError{Max: max}
+	}
+	return result, nil
+}
+
+// CleanRequired is Clean for text that cannot be left empty.
+func CleanRequired(text string, max int) (string, error) {
+	cleaned, err := Clean(text, max)
+	if err == nil && cleaned == "" {
+		return "", ErrEmpty
+	}
+	return cleaned, err
+}
+
+// stripTags removes anything that looks like an HTML tag, comment or
+// declaration. A lone "<" as in "a < b" is kept.
+func stripTags(text string) string {
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(text, '<')
+		if start < 0 || start+1 >= len(text) {
+			out.WriteString(text)
+			return out.String()
+		}
+		next := rune(text[start+1])
+		if !unicode.IsLetter(next) && next != '/' && next != '!' && next != '?' {
+			out.WriteString(text[:start+1])
+			text = text[start+1:]
+			continue
+		}
+		out.WriteString(text[:start])
+		end := strings.IndexByte(text[start:], '>')
+		if end < 0 {
+			// An unterminated tag swallows the rest, like a browser would
+			return out.String()
+		}
+		text = text[start+end+1:]
+	}
+}
+
+// ValidHeight checks a height in centimeters.
+func ValidHeight(cm int) error {
+	if cm < MinHeightCm || cm > MaxHeightCm {
+		return ErrHeight
+	}
+	return nil
+}
+
+// ValidGoal checks a relationship goal.
+func ValidGoal(goal string) error {
+	for _, g := range RelationshipGoals {
+		if goal == g {
+			return nil
+		}
+	}
+	return ErrGoal
+}
+
+// Languages checks a list of ISO 639 language codes and returns them as
+// lower case two letter codes where one exists, without duplicates.
+func Languages(codes []string) ([]string, error) {
+	if len(codes) > MaxLanguages {
+		return nil, ErrTooManyLanguages
+	}
+	seen := map[string]bool{}
+	languages := []string{}
+	for _, code := range codes {
+		base, err := language.ParseBase(strings.TrimSpace(code))
+		if err != nil {
+			return nil, fmt.Errorf("unknown language code %q", code)
+		}
+		normalized := base.String()
+		if !seen[normalized] {
+			seen[normalized] = true
+			languages = append(languages, normalized)
+		}
+	}
+	return languages, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	middleware "match_me_module/middleware"
+	"match_me_module/routes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Every route is served under this prefix, a breaking change gets a new one
+const apiPrefix = "/api/v1"
+
+// The unversioned routes are deprecated since the versioned API was added and
+// removed at the sunset, once the client no longer uses them
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+type apiRoute struct {
+	method  string
+	path    string // below apiPrefix
+	handler http.HandlerFunc
+	legacy  string // "METHOD path" of the route it replaces from before the API was versioned, if any
+}
+
+// Rate limit groups of the routes, each one counted apart
+const (
+	rateGroupAuth        = "auth"
+	rateGroupPreferences = "preferences"
+)
+
+// rateLimits are the limits of the groups unless config.env sets others. A
+// client has its own bucket in every group, the legacy route shares the
+// bucket of its successor.
+var rateLimits = map[string]middleware.Limit{
+	rateGroupAuth:               {Requests: 10, Period: time.Minute},
+	rateGroupPreferences:        {Requests: 60, Period: time.Minute},
+	middleware.DefaultRateGroup: {Requests: 300, Period: time.Minute},
+}
+
+// rateGroup puts a route in its rate limit group: registering, logging in and
+// restoring an account are guarded most, the preference, weight and filter
+// changes are the toggles a client is most likely to fire in a loop.
+func rateGroup(route apiRoute) string {
+	switch {
+	case route.method == "POST" && (route.path == "/users" || route.path == "/sessions" || route.path == "/me/restore"):
+		return rateGroupAuth
+	case route.method != "GET" && (strings.HasPrefix(route.path, "/me/preferences/") ||
+		strings.HasPrefix(route.path, "/me/weights/") || strings.HasPrefix(route.path, "/me/filters/")):
+		return rateGroupPreferences
+	}
+	return middleware.DefaultRateGroup
+}
+
+// Request bodies are JSON of at most this size. Photo uploads are multipart
+// and limited by their handler instead.
+const maxJSONBody = 64 << 10
+
+// Routes whose body is not JSON, by "METHOD path" below apiPrefix
+var nonJSONRoutes = map[string]bool{
+	"POST /me/photos": true,
+}
+
+// admin checks the role before the handler runs
+func admin(handler http.HandlerFunc) http.HandlerFunc {
+	return middleware.RequireRole(middleware.RoleAdmin, handler)
+}
+
+var apiRoutes = []apiRoute{
+	{"GET", "/openapi.json", routes.OpenAPI, ""},
+
+	// Account
+	{"POST", "/users", routes.Register, "POST /api/register"},
+	{"POST", "/sessions", routes.Login, "POST /api/login"},
+	{"DELETE", "/sessions", routes.Logout, ""},
+	{"GET", "/me", routes.UserInfo, "GET /api/user"},
+	{"DELETE", "/me", routes.DeleteMe, ""},
+	{"POST", "/me/restore", routes.RestoreMe, ""},
+	{"GET", "/me/export", routes.ExportMe, ""},
+	{"GET", "/me/onboarding", routes.Onboarding, ""},
+	{"PUT", "/me/username", routes.EditUsername, "POST /api/edit/user"},
+	{"PUT", "/me/email", routes.EditEmail, "POST /api/edit/email"},
+	{"PUT", "/me/first-name", routes.EditFirst, "POST /api/edit/first"},
+	{"PUT", "/me/middle-name", routes.EditMiddle, "POST /api/edit/middle"},
+	{"PUT", "/me/last-name", routes.EditLast, "POST /api/edit/last"},
+	{"PUT", "/me/password", routes.EditPassword, "POST /api/edit/pass"},
+	{"PUT", "/me/city", routes.EditCity, "POST /api/edit/city"},
+
+	// Profile
+	{"GET", "/me/about", routes.AboutYouGet, "GET /api/biog/aboutget"},
+	{"PUT", "/me/about", routes.AboutYou, "POST /api/biog/about"},
+	{"GET", "/me/birthdate", routes.BirthdayGet, "GET /api/biog/birthdayget"},
+	{"PUT", "/me/birthdate", routes.Birthday, "POST /api/biog/birthday"},
+	{"PUT", "/me/birthdate/privacy", routes.BirthdatePrivacy, ""},
+	{"GET", "/me/fields", routes.ProfileFieldsGet, ""},
+	{"PUT", "/me/fields", routes.ProfileFields, ""},
+	{"GET", "/me/answers", routes.PromptAnswersGet, ""},
+	{"PUT", "/me/answers", routes.PromptAnswers, ""},
+	{"GET", "/prompts", routes.PromptList, ""},
+	{"GET", "/users/{uuid}/profile", routes.ProfileGet, ""},
+
+	// Preferences, weights and filters
+	{"GET", "/preferences", routes.PrefMappingGet, "GET /api/pref/mapget"},
+	{"GET", "/me/preferences", routes.PrefGet, "GET /api/pref/get"},
+	{"POST", "/me/preferences/food", routes.FoodPref, "POST /api/pref/food"},
+	{"POST", "/me/preferences/hobby", routes.HobbyPref, "POST /api/pref/hobby"},
+	{"POST", "/me/preferences/music", routes.MusicPref, "POST /api/pref/music"},
+	{"GET", "/me/weights", routes.WeightGet, "GET /api/wigh/get"},
+	{"PUT", "/me/weights/distance", routes.WeightDistance, "POST /api/wigh/dist"},
+	{"PUT", "/me/weights/age", routes.WeightAge, "POST /api/wigh/age"},
+	{"PUT", "/me/weights/food", routes.WeightFood, "POST /api/wigh/food"},
+	{"PUT", "/me/weights/hobby", routes.WeightHobbies, "POST /api/wigh/hobby"},
+	{"PUT", "/me/weights/music", routes.WeightMusic, "POST /api/wigh/music"},
+	{"GET", "/me/filters", routes.FilterGet, ""},
+	{"PUT", "/me/filters/age", routes.FilterAge, ""},
+	{"PUT", "/me/filters/distance", routes.FilterDistance, ""},
+	{"PUT", "/me/filters/height", routes.FilterHeight, ""},
+	{"PUT", "/me/filters/languages", routes.FilterLanguage, ""},
+	{"PUT", "/me/filters/goals", routes.FilterGoal, ""},
+	{"POST", "/me/filters/food", routes.FilterFood, ""},
+	{"POST", "/me/filters/hobby", routes.FilterHobby, ""},
+	{"POST", "/me/filters/music", routes.FilterMusic, ""},
+
+	// Matching
+	{"GET", "/recommendations", routes.RecommendationGet, ""},
+	{"GET", "/recommendations/{uuid}/explanation", routes.RecommendationExplain, ""},
+	{"GET", "/feed", routes.FeedGet, ""},
+	{"PUT", "/feed/{uuid}/decision", routes.FeedDecide, ""},
+	{"GET", "/users/nearby", routes.Nearby, ""},
+
+	// Location
+	{"GET", "/me/location", routes.LocationGet, ""},
+	{"PUT", "/me/location", routes.LocationUpdate, ""},
+	{"PUT", "/me/location/mode", routes.LocationMode, ""},
+	{"GET", "/cities", routes.GeoAutocomplete, ""},
+	{"GET", "/cities/by-name", routes.GeoResolve, ""},
+	{"GET", "/cities/nearest", routes.GeoReverse, ""},
+
+	// Safety
+	{"GET", "/me/blocks", routes.BlockList, ""},
+	{"PUT", "/me/blocks/{uuid}", routes.BlockUser, ""},
+	{"DELETE", "/me/blocks/{uuid}", routes.UnblockUser, ""},
+	{"POST", "/users/{uuid}/reports", routes.ReportUser, ""},
+
+	// Live updates and notifications
+	{"GET", "/events", routes.Events, ""},
+	{"GET", "/notifications", routes.NotificationList, ""},
+	{"POST", "/notifications/read", routes.NotificationRead, ""},
+	{"GET", "/notifications/preferences", routes.NotificationPrefsGet, ""},
+	{"PUT", "/notifications/preferences", routes.NotificationPrefs, ""},
+	{"GET", "/notifications/ws", routes.NotificationSocket, ""},
+	{"POST", "/me/stream-tickets", routes.StreamTicket, ""},
+
+	// Photos
+	{"GET", "/me/photos", routes.PhotoList, ""},
+	{"POST", "/me/photos", routes.PhotoUpload, ""},
+	{"PUT", "/me/photos/order", routes.PhotoOrder, ""},
+	{"PUT", "/me/photos/{id}/primary", routes.PhotoPrimary, ""},
+	{"DELETE", "/me/photos/{id}", routes.PhotoDelete, ""},
+	{"GET", "/users/{uuid}/photos", routes.PhotoList, ""},
+	{"GET", "/photos/{id}/{size}", routes.PhotoGet, ""},
+
+	// Administration
+	{"GET", "/admin/users", admin(routes.AdminUsers), ""},
+	{"PUT", "/admin/users/{uuid}/status", admin(routes.AdminUserStatus), ""},
+	{"POST", "/admin/users/{uuid}/password-reset", admin(routes.AdminPasswordReset), ""},
+	{"GET", "/admin/reports", admin(routes.AdminReports), ""},
+	{"PUT", "/admin/reports/{id}/status", admin(routes.AdminReportStatus), ""},
+	{"PUT", "/admin/preferences/{category}", admin(routes.AdminPrefSave), ""},
+	{"DELETE", "/admin/preferences/{category}/{code}", admin(routes.AdminPrefDelete), ""},
+	{"GET", "/admin/prompts", admin(routes.AdminPrompts), ""},
+	{"POST", "/admin/prompts", admin(routes.AdminPromptCreate), ""},
+	{"PATCH", "/admin/prompts/{id}", admin(routes.AdminPromptUpdate), ""},
+	{"GET", "/admin/audit-log", admin(routes.AdminAudit), ""},
+	{"GET", "/admin/deprecations", admin(routes.AdminDeprecations), ""},
+}
+
+// newRouter registers every route of the API behind the rate limiter, nil
+// serves them without limits. It is kept apart from main so tests can serve
+// the same handlers.
+func newRouter(limiter *middleware.RateLimiter) *mux.Router {
+	// Create the router
+	r := mux.NewRouter()
+	v1 := r.PathPrefix(apiPrefix).Subrouter()
+
+	for _, route := range apiRoutes {
+		handler := route.handler
+		if !nonJSONRoutes[route.method+" "+route.path] {
+			handler = middleware.JSONBody(maxJSONBody, handler)
+		}
+		handler = limiter.RateLimit(rateGroup(route), handler)
+		v1.HandleFunc(route.path, handler).Methods(route.method)
+
+		// The old route keeps working until the sunset, pointing to the new one
+		if route.legacy != "" {
+			method, path, _ := strings.Cut(route.legacy, " ")
+			deprecated := middleware.Deprecated(route.legacy, apiPrefix+route.path, legacyDeprecatedAt, legacySunset, handler)
+			r.HandleFunc(path, deprecated).Methods(method)
+		}
+	}
+
+	// Other services look for the keys at the well-known path, not under the API
+	r.HandleFunc("/.well-known/jwks.json", limiter.RateLimit(middleware.DefaultRateGroup, routes.JWKS)).Methods("GET")
+
+	r.Use(middleware.SecurityHeaders)
+	return r
+}
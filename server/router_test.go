@@ -0,0 +1,66 @@
+package main
+
+import (
+	"match_me_module/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLegacyRoutes(t *testing.T) {
+	router := newRouter(nil)
+	before := middleware.DeprecatedCalls()["GET /api/user"]
+
+	// No token is sent, the handler answers before touching the database
+	legacy := httptest.NewRecorder()
+	router.ServeHTTP(legacy, httptest.NewRequest("GET", "/api/user", nil))
+	if legacy.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /api/user: got status %d, want %d", legacy.Code, http.StatusUnauthorized)
+	}
+	if got := legacy.Header().Get("Deprecation"); got != "@1792368000" {
+		t.Errorf("Deprecation header: got %q", got)
+	}
+	if got := legacy.Header().Get("Sunset"); got != "Mon, 19 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Sunset header: got %q", got)
+	}
+	if got := legacy.Header().Get("Link"); got != `</api/v1/me>; rel="successor-version"` {
+		t.Errorf("Link header: got %q", got)
+	}
+	if after := middleware.DeprecatedCalls()["GET /api/user"]; after != before+1 {
+		t.Errorf("Calls of GET /api/user: got %d, want %d", after, before+1)
+	}
+
+	current := httptest.NewRecorder()
+	router.ServeHTTP(current, httptest.NewRequest("GET", "/api/v1/me", nil))
+	if current.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /api/v1/me: got status %d, want %d", current.Code, http.StatusUnauthorized)
+	}
+	if current.Header().Get("Deprecation") != "" || current.Header().Get("Sunset") != "" {
+		t.Error("The versioned route is marked as deprecated")
+	}
+	if got := current.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options header: got %q", got)
+	}
+}
+
+func TestJSONBodies(t *testing.T) {
+	router := newRouter(nil)
+
+	// Checked before the handler, so no database is needed
+	form := httptest.NewRequest("POST", "/api/v1/sessions", strings.NewReader("username=alice"))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, form)
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Form body: got status %d, want %d", recorder.Code, http.StatusUnsupportedMediaType)
+	}
+
+	large := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username": "`+strings.Repeat("a", maxJSONBody)+`"}`))
+	large.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, large)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Large body: got status %d, want %d", recorder.Code, http.StatusRequestEntityTooLarge)
+	}
+}
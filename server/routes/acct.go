@@ -0,0 +1,454 @@
+package routes
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/jobs"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// How long a deleted account can still be restored
+const DeletionGracePeriod = 14 * 24 * time.Hour
+
+func DeleteMe(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// The password is asked again so a stolen token cannot delete the account
+	var requestBody struct {
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	var storedHash string
+	if err := db.QueryRow("SELECT password_hash FROM user_table WHERE user_uuid = $1", userID).Scan(&storedHash); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		log.Printf("Error retrieving password hash for user_id %s: %v", userID, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(requestBody.Password)); err != nil {
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	// The account disappears right away, its data is removed when the grace
+	// period ends. Both happen together, without the job the data would never
+	// be removed.
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	requestedAt := time.Now()
+	_, err = tx.Exec("UPDATE user_table SET account_status = $1, deletion_requested_at = $2 WHERE user_uuid = $3",
+		middleware.StatusPendingDeletion, requestedAt, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		log.Printf("Error marking user_id %s for deletion: %v", userID, err)
+		return
+	}
+
+	purgeAt := requestedAt.Add(DeletionGracePeriod)
+	if err := jobs.EnqueueAt(tx, jobs.KindAccountDeletion, userID, purgeAt); err != nil {
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		log.Printf("Error scheduling deletion of user_id %s: %v", userID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		log.Printf("Error committing deletion of user_id %s: %v", userID, err)
+		return
+	}
+	middleware.ForgetAccount(userID)
+
+	// Drop the user from everyone's recommendations
+	profileChanged(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Account scheduled for deletion",
+		"restorable": true,
+		"purge_at":   purgeAt,
+	})
+}
+
+func RestoreMe(w http.ResponseWriter, r *http.Request) {
+	// Tokens stop working once deletion is requested, so this logs in again
+	var loginReq struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &loginReq) {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	var userID, status string
+	var storedHash sql.NullString
+	err := db.QueryRow(`
+		SELECT t.user_uuid, t.password_hash, coalesce(t.account_status, 'active')
+		FROM user_table t JOIN user_info i ON i.user_uuid = t.user_uuid
+		WHERE i.username = $1`, loginReq.Username).Scan(&userID, &storedHash, &status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		log.Printf("Error retrieving account of %s: %v", loginReq.Username, err)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedHash.String), []byte(loginReq.Password)); err != nil {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if status != middleware.StatusPendingDeletion {
+		http.Error(w, "Account is not scheduled for deletion", http.StatusConflict)
+		return
+	}
+
+	// The purge job and the status go together, one without the other would
+	// leave an account that is neither restored nor ever purged
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to restore account", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE user_table SET account_status = $1, deletion_requested_at = NULL WHERE user_uuid = $2 AND account_status = $3",
+		middleware.StatusActive, userID, middleware.StatusPendingDeletion)
+	if err != nil {
+		http.Error(w, "Failed to restore account", http.StatusInternalServerError)
+		log.Printf("Error restoring user_id %s: %v", userID, err)
+		return
+	}
+	if restored, _ := result.RowsAffected(); restored == 0 {
+		// Purged or restored in the meantime
+		http.Error(w, "Account is not scheduled for deletion", http.StatusConflict)
+		return
+	}
+	if err := jobs.Cancel(tx, jobs.KindAccountDeletion, userID); err != nil {
+		http.Error(w, "Failed to restore account", http.StatusInternalServerError)
+		log.Printf("Error cancelling deletion of user_id %s: %v", userID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to restore account", http.StatusInternalServerError)
+		log.Printf("Error committing restore of user_id %s: %v", userID, err)
+		return
+	}
+	middleware.ForgetAccount(userID)
+
+	// Bring the user back into everyone's recommendations
+	profileChanged(userID)
+
+	w.Write([]byte("Account restored successfully"))
+}
+
+// PurgeAccount removes the data of an account whose deletion grace period is
+// over. It runs as a job and does nothing when the account was restored.
+func PurgeAccount(db *sql.DB, userID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var due bool
+	err = tx.QueryRow(`
+		SELECT account_status = $2 AND deletion_requested_at <= now() - $3 * interval '1 second'
+		FROM user_table WHERE user_uuid = $1 FOR UPDATE`,
+		userID, middleware.StatusPendingDeletion, int(DeletionGracePeriod.Seconds())).Scan(&due)
+	if err == sql.ErrNoRows || (err == nil && !due) {
+		log.Printf("Skipping deletion of user_id %s, it was restored or is not due", userID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking account: %v", err)
+	}
+
+	// The photo files are removed once the rows are gone
+	photos, err := ownPhotos(tx, userID)
+	if err != nil {
+		return fmt.Errorf("error reading photos: %v", err)
+	}
+
+	queries := []string{
+		// Rows owned by the user
+		"DELETE FROM user_info WHERE user_uuid = $1",
+		"DELETE FROM user_data WHERE user_uuid = $1",
+		"DELETE FROM sessions WHERE user_uuid = $1",
+		"DELETE FROM profile_info WHERE user_uuid = $1",
+		"DELETE FROM profile_prompts WHERE user_uuid = $1",
+		"DELETE FROM weights WHERE user_uuid = $1",
+		"DELETE FROM match_filters WHERE user_uuid = $1",
+		"DELETE FROM notification_prefs WHERE user_uuid = $1",
+		"DELETE FROM photos WHERE user_uuid = $1",
+		"DELETE FROM jobs WHERE user_uuid = $1 AND status = 'pending'",
+
+		// Rows linking the user to others, in both directions
+		"DELETE FROM pending_connections WHERE user_uuid_of = $1 OR user_uuid_with = $1",
+		"DELETE FROM real_connections WHERE user_uuid_of = $1 OR user_uuid_with = $1",
+		"DELETE FROM reccomendations WHERE user_uuid_of = $1 OR user_uuid_with = $1",
+		"DELETE FROM decisions WHERE user_uuid_of = $1 OR user_uuid_with = $1",
+		"DELETE FROM feed_impressions WHERE user_uuid_of = $1 OR user_uuid_with = $1",
+		"DELETE FROM blocks WHERE blocker_uuid = $1 OR blocked_uuid = $1",
+		"DELETE FROM notifications WHERE user_uuid = $1 OR actor_uuid = $1",
+		"DELETE FROM event_log WHERE user_uuid = $1 OR data->>'user_id' = $1::text",
+
+		// The user_table row stays without credentials so references to the UUID still resolve
+		"UPDATE user_table SET password_hash = NULL, role = 'user', account_status = 'deleted', suspended_until = NULL, must_reset_password = false WHERE user_uuid = $1",
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("error running %q: %v", query, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	middleware.ForgetAccount(userID)
+
+	for _, p := range photos {
+		deletePhotoBlobs(userID, p.id, p.extension)
+	}
+	return nil
+}
+
+type ownPhoto struct {
+	id        string
+	extension string
+}
+
+// ownPhotos lists the photo ids and file extensions of a user.
+func ownPhotos(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, userID string) ([]ownPhoto, error) {
+	rows, err := q.Query("SELECT photo_uuid, extension FROM photos WHERE user_uuid = $1 ORDER BY position, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var photos []ownPhoto
+	for rows.Next() {
+		var p ownPhoto
+		if err := rows.Scan(&p.id, &p.extension); err != nil {
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+	return photos, rows.Err()
+}
+
+// Every file of a data export with the query filling it
+var exportFiles = []struct {
+	name  string
+	query string
+}{
+	{"account.json", `SELECT user_uuid, role, account_status, deletion_requested_at, datetime_created FROM user_table WHERE user_uuid = $1`},
+	{"user_info.json", `SELECT username, email, first_name, middle_name, last_name, birthdate FROM user_info WHERE user_uuid = $1`},
+	{"user_data.json", `
+		SELECT user_city,
+		       ST_Y(register_location::geometry) AS register_latitude, ST_X(register_location::geometry) AS register_longitude,
+		       ST_Y(browser_location::geometry) AS browser_latitude, ST_X(browser_location::geometry) AS browser_longitude,
+		       browser_location_at, browser_accuracy, location_mode
+		FROM user_data WHERE user_uuid = $1`},
+	{"sessions.json", `SELECT session_guid, email FROM sessions WHERE user_uuid = $1`},
+	{"profile_info.json", `
+		SELECT about_me, food_myvariabledata, hobbies_myvariabledata, music_myvariabledata, show_birthdate,
+		       height_cm, occupation, languages, relationship_goal
+		FROM profile_info WHERE user_uuid = $1`},
+	{"profile_prompts.json", `
+		SELECT p.question, a.answer, a.position
+		FROM profile_prompts a JOIN prompts p ON p.id = a.prompt_id
+		WHERE a.user_uuid = $1 ORDER BY a.position`},
+	{"weights.json", `SELECT weigh_distance, weigh_age, weigh_food, weigh_hobbies, weigh_music FROM weights WHERE user_uuid = $1`},
+	{"match_filters.json", `
+		SELECT min_age, max_age, max_distance_km, food_required, food_excluded,
+		       hobby_required, hobby_excluded, music_required, music_excluded,
+		       min_height, max_height, languages_required, goals_required
+		FROM match_filters WHERE user_uuid = $1`},
+	{"pending_connections.json", `
+		SELECT user_uuid_of, user_uuid_with, user_uuid_of = $1 AS sent
+		FROM pending_connections WHERE user_uuid_of = $1 OR user_uuid_with = $1`},
+	{"real_connections.json", `SELECT user_uuid_with FROM real_connections WHERE user_uuid_of = $1`},
+	{"recommendations.json", `SELECT user_uuid_with, compability, distance FROM reccomendations WHERE user_uuid_of = $1`},
+	{"decisions.json", `SELECT user_uuid_with, decision, datetime_created FROM decisions WHERE user_uuid_of = $1`},
+	{"blocks.json", `SELECT blocked_uuid, datetime_created FROM blocks WHERE blocker_uuid = $1`},
+	{"reports.json", `SELECT reported_uuid, category, details, status, datetime_created FROM reports WHERE reporter_uuid = $1`},
+	{"notifications.json", `SELECT kind, actor_uuid, payload, read_at, datetime_created FROM notifications WHERE user_uuid = $1 ORDER BY id`},
+	{"notification_prefs.json", `SELECT kind, in_app, email, push FROM notification_prefs WHERE user_uuid = $1`},
+	{"photos.json", `SELECT photo_uuid, position, is_primary, content_type, width, height, datetime_created FROM photos WHERE user_uuid = $1 ORDER BY position`},
+}
+
+func ExportMe(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Everything is read before writing so a failure can still send an error
+	contents := make([][]map[string]interface{}, len(exportFiles))
+	for i, file := range exportFiles {
+		contents[i], err = exportRows(db, file.query, userID)
+		if err != nil {
+			http.Error(w, "Failed to export data", http.StatusInternalServerError)
+			log.Printf("Error exporting %s for user_id %s: %v", file.name, userID, err)
+			return
+		}
+	}
+
+	// The photos themselves go into the archive at full size
+	photos, err := ownPhotos(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to export data", http.StatusInternalServerError)
+		log.Printf("Error exporting photos for user_id %s: %v", userID, err)
+		return
+	}
+	photoFiles := make([][]byte, len(photos))
+	for i, p := range photos {
+		blob, err := blobStore.Get(photoKey(userID, p.id, "full", p.extension))
+		if err == nil {
+			photoFiles[i], err = io.ReadAll(blob)
+			blob.Close()
+		}
+		if err != nil {
+			http.Error(w, "Failed to export data", http.StatusInternalServerError)
+			log.Printf("Error exporting photo %s for user_id %s: %v", p.id, userID, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="match-me-export.zip"`)
+
+	archive := zip.NewWriter(w)
+	for i, file := range exportFiles {
+		entry, err := archive.Create(file.name)
+		if err != nil {
+			log.Printf("Error writing %s to export of user_id %s: %v", file.name, userID, err)
+			return
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(contents[i]); err != nil {
+			log.Printf("Error writing %s to export of user_id %s: %v", file.name, userID, err)
+			return
+		}
+	}
+	for i, p := range photos {
+		entry, err := archive.Create("photos/" + p.id + "." + p.extension)
+		if err == nil {
+			_, err = entry.Write(photoFiles[i])
+		}
+		if err != nil {
+			log.Printf("Error writing photo %s to export of user_id %s: %v", p.id, userID, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Error finishing export of user_id %s: %v", userID, err)
+	}
+}
+
+// exportRows reads every row of a query into maps keyed by column name.
+func exportRows(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			// UUIDs, numerics and text arrive as bytes
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestDeleteMe(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, DeleteMe, []handlerTest{
+		{"no token", "DELETE", "/api/v1/me", "", nil, map[string]string{"password": alice.Password}, http.StatusUnauthorized},
+		{"invalid body", "DELETE", "/api/v1/me", alice.Token, nil, "{", http.StatusBadRequest},
+		{"wrong password", "DELETE", "/api/v1/me", alice.Token, nil, map[string]string{"password": "wrong"}, http.StatusUnauthorized},
+		{"deleted", "DELETE", "/api/v1/me", alice.Token, nil, map[string]string{"password": alice.Password}, http.StatusOK},
+		{"token no longer works", "DELETE", "/api/v1/me", alice.Token, nil, map[string]string{"password": alice.Password}, http.StatusUnauthorized},
+	})
+
+	// The data stays until the grace period is over
+	if err := PurgeAccount(db.DB, alice.ID); err != nil {
+		t.Fatalf("Error purging account: %v", err)
+	}
+	var users int
+	if err := db.QueryRow("SELECT count(*) FROM user_info WHERE user_uuid = $1", alice.ID).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Error("The account was purged before the grace period ended")
+	}
+}
+
+func TestRestoreMe(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	login := func(password string) map[string]string {
+		return map[string]string{"username": "alice", "password": password}
+	}
+
+	runHandlerTests(t, RestoreMe, []handlerTest{
+		{"invalid body", "POST", "/api/v1/me/restore", "", nil, "{", http.StatusBadRequest},
+		{"unknown user", "POST", "/api/v1/me/restore", "", nil, map[string]string{"username": "nobody", "password": "password"}, http.StatusUnauthorized},
+		{"wrong password", "POST", "/api/v1/me/restore", "", nil, login("wrong"), http.StatusUnauthorized},
+		{"not deleted", "POST", "/api/v1/me/restore", "", nil, login(alice.Password), http.StatusConflict},
+	})
+
+	serve(t, DeleteMe, "DELETE", "/api/v1/me", alice.Token, nil, map[string]string{"password": alice.Password})
+	runHandlerTests(t, RestoreMe, []handlerTest{
+		{"restored", "POST", "/api/v1/me/restore", "", nil, login(alice.Password), http.StatusOK},
+		{"already restored", "POST", "/api/v1/me/restore", "", nil, login(alice.Password), http.StatusConflict},
+	})
+	if recorder := serve(t, UserInfo, "GET", "/api/v1/me", alice.Token, nil, nil); recorder.Code != http.StatusOK {
+		t.Errorf("Token after restoring: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestExportMe(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	db.Preferences(t, alice, "food", "A1", "B1")
+
+	runHandlerTests(t, ExportMe, []handlerTest{
+		{"no token", "GET", "/api/v1/me/export", "", nil, nil, http.StatusUnauthorized},
+		{"exported", "GET", "/api/v1/me/export", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	recorder := serve(t, ExportMe, "GET", "/api/v1/me/export", alice.Token, nil, nil)
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if err != nil {
+		t.Fatalf("The export is not a zip archive: %v", err)
+	}
+	files := map[string]bool{}
+	for _, f := range archive.File {
+		files[f.Name] = true
+	}
+	for _, file := range exportFiles {
+		if !files[file.name] {
+			t.Errorf("%s is missing from the export", file.name)
+		}
+	}
+}
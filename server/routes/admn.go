@@ -0,0 +1,795 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"match_me_module/profile"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// The admin handlers are wrapped in middleware.RequireRole, which has
+// already checked the token and role of the caller.
+
+// Statuses a report moves through
+var reportStatuses = map[string]bool{
+	"open":      true,
+	"reviewed":  true,
+	"dismissed": true,
+	"actioned":  true,
+}
+
+const (
+	defaultAdminLimit = 50
+	maxAdminLimit     = 200
+	maxSuspensionDays = 365
+)
+
+var prefCodePattern = regexp.MustCompile(`^[A-Z0-9]{2}$`)
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// audit appends an admin action to the audit log. Mutations pass their
+// transaction so the action and its log entry are saved together.
+func audit(e execer, actorID, action, target string, details map[string]interface{}) error {
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec("INSERT INTO audit_log (actor_uuid, action, target, details) VALUES ($1, $2, $3, $4)",
+		actorID, action, target, string(encoded))
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %v", err)
+	}
+	return nil
+}
+
+// pageParams reads ?limit= and ?offset= and writes the error response itself.
+func pageParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit, offset := defaultAdminLimit, 0
+	var err error
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAdminLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit: must be between 1 and %d", maxAdminLimit), http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+func AdminUsers(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	if err := audit(db, adminID, "list_users", "", map[string]interface{}{"q": search, "limit": limit, "offset": offset}); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	// The search matches any part of the username, email or names
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+	rows, err := db.Query(`
+		SELECT t.user_uuid, i.username, i.email, i.first_name, i.last_name,
+		       coalesce(t.role, 'user'), coalesce(t.account_status, 'active'), t.suspended_until,
+		       coalesce(t.must_reset_password, false), t.datetime_created
+		FROM user_table t
+		JOIN user_info i ON i.user_uuid = t.user_uuid
+		WHERE $1 = '' OR i.username ILIKE $2 OR i.email ILIKE $2 OR i.first_name ILIKE $2 OR i.last_name ILIKE $2
+		ORDER BY t.datetime_created DESC, t.user_uuid
+		LIMIT $3 OFFSET $4`, search, pattern, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to query users", http.StatusInternalServerError)
+		log.Printf("Error querying users: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type adminUser struct {
+		UserID            string     `json:"user_id"`
+		Username          string     `json:"username"`
+		Email             string     `json:"email"`
+		FirstName         string     `json:"first_name"`
+		LastName          string     `json:"last_name"`
+		Role              string     `json:"role"`
+		Status            string     `json:"status"`
+		SuspendedUntil    *time.Time `json:"suspended_until"`
+		MustResetPassword bool       `json:"must_reset_password"`
+		Created           time.Time  `json:"datetime_created"`
+	}
+	users := []adminUser{}
+	for rows.Next() {
+		var u adminUser
+		var suspendedUntil sql.NullTime
+		err := rows.Scan(&u.UserID, &u.Username, &u.Email, &u.FirstName, &u.LastName,
+			&u.Role, &u.Status, &suspendedUntil, &u.MustResetPassword, &u.Created)
+		if err != nil {
+			http.Error(w, "Failed to read users", http.StatusInternalServerError)
+			log.Printf("Error scanning user: %v", err)
+			return
+		}
+		if suspendedUntil.Valid {
+			u.SuspendedUntil = &suspendedUntil.Time
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read users", http.StatusInternalServerError)
+		log.Printf("Error reading users: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func AdminReports(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && !reportStatuses[status] {
+		http.Error(w, "Invalid report status", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	if err := audit(db, adminID, "list_reports", "", map[string]interface{}{"status": status, "limit": limit, "offset": offset}); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT r.id, r.reporter_uuid, coalesce(a.username, ''), r.reported_uuid, coalesce(b.username, ''),
+		       r.category, coalesce(r.details, ''), coalesce(r.status, 'open'), r.datetime_created
+		FROM reports r
+		LEFT JOIN user_info a ON a.user_uuid = r.reporter_uuid
+		LEFT JOIN user_info b ON b.user_uuid = r.reported_uuid
+		WHERE $1 = '' OR r.status = $1
+		ORDER BY r.datetime_created DESC, r.id DESC
+		LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to query reports", http.StatusInternalServerError)
+		log.Printf("Error querying reports: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type report struct {
+		ID               int       `json:"id"`
+		ReporterID       string    `json:"reporter_id"`
+		ReporterUsername string    `json:"reporter_username"`
+		ReportedID       string    `json:"reported_id"`
+		ReportedUsername string    `json:"reported_username"`
+		Category         string    `json:"category"`
+		Details          string    `json:"details"`
+		Status           string    `json:"status"`
+		Created          time.Time `json:"datetime_created"`
+	}
+	reports := []report{}
+	for rows.Next() {
+		var rep report
+		err := rows.Scan(&rep.ID, &rep.ReporterID, &rep.ReporterUsername, &rep.ReportedID, &rep.ReportedUsername,
+			&rep.Category, &rep.Details, &rep.Status, &rep.Created)
+		if err != nil {
+			http.Error(w, "Failed to read reports", http.StatusInternalServerError)
+			log.Printf("Error scanning report: %v", err)
+			return
+		}
+		reports = append(reports, rep)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read reports", http.StatusInternalServerError)
+		log.Printf("Error reading reports: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+func AdminReportStatus(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	reportID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid report id", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body for the new status
+	var requestBody struct {
+		Status string `json:"status"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	if !reportStatuses[requestBody.Status] {
+		http.Error(w, "Invalid report status", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow("SELECT coalesce(status, 'open') FROM reports WHERE id = $1 FOR UPDATE", reportID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error reading report %d: %v", reportID, err)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE reports SET status = $1 WHERE id = $2", requestBody.Status, reportID); err != nil {
+		http.Error(w, "Failed to update report", http.StatusInternalServerError)
+		log.Printf("Error updating report %d: %v", reportID, err)
+		return
+	}
+	details := map[string]interface{}{"from": previous, "to": requestBody.Status}
+	if err := audit(tx, adminID, "report_status", strconv.Itoa(reportID), details); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update report", http.StatusInternalServerError)
+		log.Printf("Error committing report %d: %v", reportID, err)
+		return
+	}
+
+	w.Write([]byte("Report updated successfully"))
+}
+
+func AdminUserStatus(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	userID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	if userID == adminID {
+		http.Error(w, "Cannot change your own status", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body for the new status, days only apply to suspensions
+	var requestBody struct {
+		Status string `json:"status"`
+		Days   int    `json:"days"`
+		Reason string `json:"reason"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	var suspendedUntil *time.Time
+	switch requestBody.Status {
+	case middleware.StatusActive, middleware.StatusBanned:
+	case middleware.StatusSuspended:
+		if requestBody.Days < 1 || requestBody.Days > maxSuspensionDays {
+			http.Error(w, fmt.Sprintf("Suspensions last between 1 and %d days", maxSuspensionDays), http.StatusBadRequest)
+			return
+		}
+		until := time.Now().Add(time.Duration(requestBody.Days) * 24 * time.Hour)
+		suspendedUntil = &until
+	default:
+		http.Error(w, "Status must be active, suspended or banned", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var current, role string
+	err = tx.QueryRow("SELECT coalesce(account_status, 'active'), coalesce(role, 'user') FROM user_table WHERE user_uuid = $1 FOR UPDATE", userID).
+		Scan(&current, &role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error reading status of %s: %v", userID, err)
+		return
+	}
+	// Admins are moderated by taking away their role first
+	if role == middleware.RoleAdmin {
+		http.Error(w, "Cannot change the status of another admin", http.StatusForbidden)
+		return
+	}
+	// Reactivating would cancel a deletion the user asked for, or revive a
+	// purged account
+	if current == middleware.StatusPendingDeletion || current == middleware.StatusDeleted {
+		http.Error(w, "Account is being deleted", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE user_table SET account_status = $1, suspended_until = $2 WHERE user_uuid = $3",
+		requestBody.Status, suspendedUntil, userID)
+	if err != nil {
+		http.Error(w, "Failed to update status", http.StatusInternalServerError)
+		log.Printf("Error updating status of %s: %v", userID, err)
+		return
+	}
+
+	details := map[string]interface{}{"status": requestBody.Status, "suspended_until": suspendedUntil, "reason": requestBody.Reason}
+	if err := audit(tx, adminID, "user_status", userID, details); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update status", http.StatusInternalServerError)
+		log.Printf("Error committing status of %s: %v", userID, err)
+		return
+	}
+	middleware.ForgetAccount(userID)
+
+	// Banned and suspended users drop out of everyone's recommendations, and
+	// suspended ones come back when the suspension ends
+	profileChanged(userID)
+	if suspendedUntil != nil {
+		profileChangesAt(userID, *suspendedUntil)
+	}
+
+	w.Write([]byte("Status updated successfully"))
+}
+
+func AdminPasswordReset(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	userID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Existing tokens stop working and the next login has to set a new password
+	result, err := tx.Exec("UPDATE user_table SET must_reset_password = true WHERE user_uuid = $1", userID)
+	if err != nil {
+		http.Error(w, "Failed to force password reset", http.StatusInternalServerError)
+		log.Printf("Error forcing password reset of %s: %v", userID, err)
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := audit(tx, adminID, "password_reset", userID, map[string]interface{}{}); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to force password reset", http.StatusInternalServerError)
+		log.Printf("Error committing password reset of %s: %v", userID, err)
+		return
+	}
+	middleware.ForgetAccount(userID)
+
+	w.Write([]byte("Password reset forced successfully"))
+}
+
+// prefCategory reads the preference category from the path and writes the error response itself.
+func prefCategory(w http.ResponseWriter, r *http.Request) (string, bool) {
+	category := mux.Vars(r)["category"]
+	if _, ok := matching.PrefColumns[category]; !ok {
+		http.Error(w, "Category must be food, hobby or music", http.StatusBadRequest)
+		return "", false
+	}
+	return category, true
+}
+
+func AdminPrefSave(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	category, ok := prefCategory(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse the request body for the mapping
+	var requestBody struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	description := strings.TrimSpace(requestBody.Description)
+	if !prefCodePattern.MatchString(requestBody.Code) {
+		http.Error(w, "Code must be two upper case letters or digits", http.StatusBadRequest)
+		return
+	}
+	if description == "" || len([]rune(description)) > 50 {
+		http.Error(w, "Description must be between 1 and 50 characters", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		INSERT INTO pref_%[1]s (%[1]s_code, %[1]s_description) VALUES ($1, $2)
+		ON CONFLICT (%[1]s_code) DO UPDATE SET %[1]s_description = EXCLUDED.%[1]s_description`, category)
+	if _, err := tx.Exec(query, requestBody.Code, description); err != nil {
+		http.Error(w, "Failed to save mapping", http.StatusInternalServerError)
+		log.Printf("Error saving %s mapping %s: %v", category, requestBody.Code, err)
+		return
+	}
+
+	details := map[string]interface{}{"category": category, "code": requestBody.Code, "description": description}
+	if err := audit(tx, adminID, "pref_save", category+"/"+requestBody.Code, details); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to save mapping", http.StatusInternalServerError)
+		log.Printf("Error committing %s mapping %s: %v", category, requestBody.Code, err)
+		return
+	}
+
+	w.Write([]byte("Mapping saved successfully"))
+}
+
+func AdminPrefDelete(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	category, ok := prefCategory(w, r)
+	if !ok {
+		return
+	}
+	code := mux.Vars(r)["code"]
+	if !prefCodePattern.MatchString(code) {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Codes still in a profile or filter would turn into unknown codes
+	var inUse bool
+	inUseQuery := fmt.Sprintf(`
+		SELECT EXISTS (SELECT 1 FROM profile_info WHERE $1 = ANY(string_to_array(%[2]s, ',')))
+		    OR EXISTS (SELECT 1 FROM match_filters
+		               WHERE $1 = ANY(string_to_array(%[1]s_required, ','))
+		                  OR $1 = ANY(string_to_array(%[1]s_excluded, ',')))`, category, matching.PrefColumns[category])
+	if err := tx.QueryRow(inUseQuery, code).Scan(&inUse); err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error checking use of %s code %s: %v", category, code, err)
+		return
+	}
+	if inUse {
+		http.Error(w, "Code is still used by profiles or filters", http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec(fmt.Sprintf("DELETE FROM pref_%[1]s WHERE %[1]s_code = $1", category), code)
+	if err != nil {
+		http.Error(w, "Failed to delete mapping", http.StatusInternalServerError)
+		log.Printf("Error deleting %s mapping %s: %v", category, code, err)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		http.Error(w, "Code not found", http.StatusNotFound)
+		return
+	}
+
+	if err := audit(tx, adminID, "pref_delete", category+"/"+code, map[string]interface{}{"category": category, "code": code}); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete mapping", http.StatusInternalServerError)
+		log.Printf("Error committing deletion of %s mapping %s: %v", category, code, err)
+		return
+	}
+
+	w.Write([]byte("Mapping deleted successfully"))
+}
+
+// AdminPrompts lists every prompt including retired ones.
+func AdminPrompts(w http.ResponseWriter, r *http.Request) {
+	prompts, err := loadPrompts(databaseSetup.GetDB(), false)
+	if err != nil {
+		http.Error(w, "Failed to query prompts", http.StatusInternalServerError)
+		log.Printf("Error querying prompts: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompts)
+}
+
+func AdminPromptCreate(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	// Parse the request body for the question
+	var requestBody struct {
+		Question string `json:"question"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	question, err := profile.CleanRequired(requestBody.Question, profile.MaxQuestion)
+	if err != nil {
+		http.Error(w, "Invalid question: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var promptID int
+	err = tx.QueryRow(`
+		INSERT INTO prompts (question, active, datetime_created) VALUES ($1, true, now())
+		ON CONFLICT (question) DO NOTHING
+		RETURNING id`, question).Scan(&promptID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Prompt already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save prompt", http.StatusInternalServerError)
+		log.Printf("Error saving prompt: %v", err)
+		return
+	}
+
+	details := map[string]interface{}{"question": question}
+	if err := audit(tx, adminID, "prompt_create", strconv.Itoa(promptID), details); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to save prompt", http.StatusInternalServerError)
+		log.Printf("Error committing prompt: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": promptID, "question": question, "active": true})
+}
+
+// AdminPromptUpdate rewords a prompt or retires it. Retired prompts are no
+// longer offered, answers already given stay on profiles.
+func AdminPromptUpdate(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	promptID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid prompt id", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body, missing fields stay unchanged
+	var requestBody struct {
+		Question *string `json:"question"`
+		Active   *bool   `json:"active"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	details := map[string]interface{}{}
+	if requestBody.Question != nil {
+		question, err := profile.CleanRequired(*requestBody.Question, profile.MaxQuestion)
+		if err != nil {
+			http.Error(w, "Invalid question: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		requestBody.Question = &question
+		details["question"] = question
+	}
+	if requestBody.Active != nil {
+		details["active"] = *requestBody.Active
+	}
+	if len(details) == 0 {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE prompts SET question = coalesce($1, question), active = coalesce($2, active)
+		WHERE id = $3`, requestBody.Question, requestBody.Active, promptID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			http.Error(w, "Prompt already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to update prompt", http.StatusInternalServerError)
+		log.Printf("Error updating prompt %d: %v", promptID, err)
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		http.Error(w, "Prompt not found", http.StatusNotFound)
+		return
+	}
+
+	if err := audit(tx, adminID, "prompt_update", strconv.Itoa(promptID), details); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update prompt", http.StatusInternalServerError)
+		log.Printf("Error committing prompt %d: %v", promptID, err)
+		return
+	}
+
+	w.Write([]byte("Prompt updated successfully"))
+}
+
+func AdminAudit(w http.ResponseWriter, r *http.Request) {
+	adminID := middleware.UserID(r)
+
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	if err := audit(db, adminID, "list_audit", "", map[string]interface{}{"limit": limit, "offset": offset}); err != nil {
+		http.Error(w, "Failed to write audit log", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT id, actor_uuid, action, coalesce(target, ''), details, datetime_created
+		FROM audit_log
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		log.Printf("Error querying audit log: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type entry struct {
+		ID      int64           `json:"id"`
+		ActorID string          `json:"actor_id"`
+		Action  string          `json:"action"`
+		Target  string          `json:"target"`
+		Details json.RawMessage `json:"details"`
+		Created time.Time       `json:"datetime_created"`
+	}
+	entries := []entry{}
+	for rows.Next() {
+		var e entry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.Target, &details, &e.Created); err != nil {
+			http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+			log.Printf("Error scanning audit entry: %v", err)
+			return
+		}
+		e.Details = details
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		log.Printf("Error reading audit log: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// AdminDeprecations shows how often each deprecated route was called since
+// the server started, to tell when one can be removed.
+func AdminDeprecations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(middleware.DeprecatedCalls())
+}
@@ -0,0 +1,285 @@
+package routes
+
+import (
+	"encoding/json"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// adminOnly wraps a handler in the role check the router puts in front of it.
+func adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return middleware.RequireRole(middleware.RoleAdmin, handler)
+}
+
+func TestAdminUsers(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+	db.User(t, "bob")
+
+	runHandlerTests(t, adminOnly(AdminUsers), []handlerTest{
+		{"no token", "GET", "/api/v1/admin/users", "", nil, nil, http.StatusUnauthorized},
+		{"not an admin", "GET", "/api/v1/admin/users", alice.Token, nil, nil, http.StatusForbidden},
+		{"limit too small", "GET", "/api/v1/admin/users?limit=0", root.Token, nil, nil, http.StatusBadRequest},
+		{"limit too large", "GET", "/api/v1/admin/users?limit=201", root.Token, nil, nil, http.StatusBadRequest},
+		{"invalid offset", "GET", "/api/v1/admin/users?offset=-1", root.Token, nil, nil, http.StatusBadRequest},
+		{"users", "GET", "/api/v1/admin/users", root.Token, nil, nil, http.StatusOK},
+	})
+
+	var users []struct {
+		UserID string `json:"user_id"`
+	}
+	decode(t, serve(t, adminOnly(AdminUsers), "GET", "/api/v1/admin/users?q=ALI", root.Token, nil, nil), &users)
+	if len(users) != 1 || users[0].UserID != alice.ID {
+		t.Errorf("Users matching ALI: got %v", users)
+	}
+	users = nil
+	decode(t, serve(t, adminOnly(AdminUsers), "GET", "/api/v1/admin/users?limit=2&offset=2", root.Token, nil, nil), &users)
+	if len(users) != 1 {
+		t.Errorf("Last page of users: got %v", users)
+	}
+}
+
+func TestAdminUserStatus(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	admin := db.Admin(t, "admin")
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	if _, err := db.Exec("UPDATE user_table SET account_status = 'pending_deletion' WHERE user_uuid = $1", bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	status := func(status string, days int) map[string]interface{} {
+		return map[string]interface{}{"status": status, "days": days, "reason": "Spam"}
+	}
+	handler := adminOnly(AdminUserStatus)
+	runHandlerTests(t, handler, []handlerTest{
+		{"no token", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", "", user(alice.ID), status("banned", 0), http.StatusUnauthorized},
+		{"not an admin", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", alice.Token, user(alice.ID), status("banned", 0), http.StatusForbidden},
+		{"invalid id", "PUT", "/api/v1/admin/users/alice/status", root.Token, user("alice"), status("banned", 0), http.StatusBadRequest},
+		{"yourself", "PUT", "/api/v1/admin/users/" + root.ID + "/status", root.Token, user(root.ID), status("banned", 0), http.StatusBadRequest},
+		{"invalid body", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", root.Token, user(alice.ID), "{", http.StatusBadRequest},
+		{"unknown status", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", root.Token, user(alice.ID), status("frozen", 0), http.StatusBadRequest},
+		{"suspension without days", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", root.Token, user(alice.ID), status("suspended", 0), http.StatusBadRequest},
+		{"suspension too long", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", root.Token, user(alice.ID), status("suspended", 366), http.StatusBadRequest},
+		{"unknown user", "PUT", "/api/v1/admin/users/" + unknownUser + "/status", root.Token, user(unknownUser), status("banned", 0), http.StatusNotFound},
+		{"another admin", "PUT", "/api/v1/admin/users/" + admin.ID + "/status", root.Token, user(admin.ID), status("banned", 0), http.StatusForbidden},
+		{"pending deletion", "PUT", "/api/v1/admin/users/" + bob.ID + "/status", root.Token, user(bob.ID), status("active", 0), http.StatusConflict},
+		{"suspended", "PUT", "/api/v1/admin/users/" + alice.ID + "/status", root.Token, user(alice.ID), status("suspended", 7), http.StatusOK},
+	})
+
+	// Recommendations are updated now and again when the suspension ends
+	var delayed int
+	err := db.QueryRow(`
+		SELECT count(*) FROM jobs j JOIN user_table u ON u.user_uuid = j.user_uuid
+		WHERE j.user_uuid = $1 AND j.kind = 'profile_changed' AND j.status = 'pending' AND j.run_at = u.suspended_until`, alice.ID).Scan(&delayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delayed != 1 {
+		t.Errorf("Recomputations at the end of the suspension: got %d, want 1", delayed)
+	}
+
+	// A suspended user's token stops working until they are active again
+	if recorder := serve(t, UserInfo, "GET", "/api/v1/me", alice.Token, nil, nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Suspended user: got status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+	serve(t, handler, "PUT", "/api/v1/admin/users/"+alice.ID+"/status", root.Token, user(alice.ID), status("active", 0))
+	if recorder := serve(t, UserInfo, "GET", "/api/v1/me", alice.Token, nil, nil); recorder.Code != http.StatusOK {
+		t.Errorf("Reactivated user: got status %d, want %d", recorder.Code, http.StatusOK)
+	}
+}
+
+func TestAdminPasswordReset(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	runHandlerTests(t, adminOnly(AdminPasswordReset), []handlerTest{
+		{"no token", "POST", "/api/v1/admin/users/" + alice.ID + "/password-reset", "", user(alice.ID), nil, http.StatusUnauthorized},
+		{"not an admin", "POST", "/api/v1/admin/users/" + alice.ID + "/password-reset", alice.Token, user(alice.ID), nil, http.StatusForbidden},
+		{"invalid id", "POST", "/api/v1/admin/users/alice/password-reset", root.Token, user("alice"), nil, http.StatusBadRequest},
+		{"unknown user", "POST", "/api/v1/admin/users/" + unknownUser + "/password-reset", root.Token, user(unknownUser), nil, http.StatusNotFound},
+		{"reset", "POST", "/api/v1/admin/users/" + alice.ID + "/password-reset", root.Token, user(alice.ID), nil, http.StatusOK},
+	})
+
+	// The old token is no longer accepted
+	if recorder := serve(t, UserInfo, "GET", "/api/v1/me", alice.Token, nil, nil); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("User with a forced reset: got status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAdminReports(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	serve(t, ReportUser, "POST", "/api/v1/users/"+bob.ID+"/reports", alice.Token, map[string]string{"uuid": bob.ID},
+		map[string]string{"category": "spam", "details": "Sends links"})
+
+	runHandlerTests(t, adminOnly(AdminReports), []handlerTest{
+		{"no token", "GET", "/api/v1/admin/reports", "", nil, nil, http.StatusUnauthorized},
+		{"not an admin", "GET", "/api/v1/admin/reports", alice.Token, nil, nil, http.StatusForbidden},
+		{"unknown status", "GET", "/api/v1/admin/reports?status=closed", root.Token, nil, nil, http.StatusBadRequest},
+		{"reports", "GET", "/api/v1/admin/reports", root.Token, nil, nil, http.StatusOK},
+	})
+
+	type report struct {
+		ID               int    `json:"id"`
+		ReportedUsername string `json:"reported_username"`
+		Status           string `json:"status"`
+	}
+	var open []report
+	decode(t, serve(t, adminOnly(AdminReports), "GET", "/api/v1/admin/reports?status=open", root.Token, nil, nil), &open)
+	if len(open) != 1 || open[0].ReportedUsername != "bob" {
+		t.Fatalf("Open reports: got %+v", open)
+	}
+
+	id := strconv.Itoa(open[0].ID)
+	reportID := func(id string) map[string]string { return map[string]string{"id": id} }
+	runHandlerTests(t, adminOnly(AdminReportStatus), []handlerTest{
+		{"not an admin", "PUT", "/api/v1/admin/reports/" + id + "/status", alice.Token, reportID(id), map[string]string{"status": "dismissed"}, http.StatusForbidden},
+		{"invalid id", "PUT", "/api/v1/admin/reports/first/status", root.Token, reportID("first"), map[string]string{"status": "dismissed"}, http.StatusBadRequest},
+		{"unknown status", "PUT", "/api/v1/admin/reports/" + id + "/status", root.Token, reportID(id), map[string]string{"status": "closed"}, http.StatusBadRequest},
+		{"unknown report", "PUT", "/api/v1/admin/reports/0/status", root.Token, reportID("0"), map[string]string{"status": "dismissed"}, http.StatusNotFound},
+		{"dismissed", "PUT", "/api/v1/admin/reports/" + id + "/status", root.Token, reportID(id), map[string]string{"status": "dismissed"}, http.StatusOK},
+	})
+
+	open = nil
+	decode(t, serve(t, adminOnly(AdminReports), "GET", "/api/v1/admin/reports?status=open", root.Token, nil, nil), &open)
+	if len(open) != 0 {
+		t.Errorf("Open reports after dismissing: got %+v", open)
+	}
+}
+
+func TestAdminPreferences(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+	db.Preferences(t, alice, "food", "A1")
+
+	category := func(c string) map[string]string { return map[string]string{"category": c} }
+	mapping := func(code, description string) map[string]string {
+		return map[string]string{"code": code, "description": description}
+	}
+	runHandlerTests(t, adminOnly(AdminPrefSave), []handlerTest{
+		{"not an admin", "PUT", "/api/v1/admin/preferences/food", alice.Token, category("food"), mapping("Z9", "Raw food"), http.StatusForbidden},
+		{"unknown category", "PUT", "/api/v1/admin/preferences/drink", root.Token, category("drink"), mapping("Z9", "Raw food"), http.StatusBadRequest},
+		{"invalid body", "PUT", "/api/v1/admin/preferences/food", root.Token, category("food"), "{", http.StatusBadRequest},
+		{"invalid code", "PUT", "/api/v1/admin/preferences/food", root.Token, category("food"), mapping("z9", "Raw food"), http.StatusBadRequest},
+		{"empty description", "PUT", "/api/v1/admin/preferences/food", root.Token, category("food"), mapping("Z9", ""), http.StatusBadRequest},
+		{"description too long", "PUT", "/api/v1/admin/preferences/food", root.Token, category("food"), mapping("Z9", strings.Repeat("a", 51)), http.StatusBadRequest},
+		{"added", "PUT", "/api/v1/admin/preferences/food", root.Token, category("food"), mapping("Z9", "Raw food"), http.StatusOK},
+		{"renamed", "PUT", "/api/v1/admin/preferences/food", root.Token, category("food"), mapping("Z9", "Raw vegan food"), http.StatusOK},
+	})
+
+	var description string
+	if err := db.QueryRow("SELECT food_description FROM pref_food WHERE food_code = 'Z9'").Scan(&description); err != nil {
+		t.Fatal(err)
+	}
+	if description != "Raw vegan food" {
+		t.Errorf("Description of Z9: got %q", description)
+	}
+
+	code := func(c, code string) map[string]string { return map[string]string{"category": c, "code": code} }
+	runHandlerTests(t, adminOnly(AdminPrefDelete), []handlerTest{
+		{"not an admin", "DELETE", "/api/v1/admin/preferences/food/Z9", alice.Token, code("food", "Z9"), nil, http.StatusForbidden},
+		{"unknown category", "DELETE", "/api/v1/admin/preferences/drink/Z9", root.Token, code("drink", "Z9"), nil, http.StatusBadRequest},
+		{"invalid code", "DELETE", "/api/v1/admin/preferences/food/z", root.Token, code("food", "z"), nil, http.StatusBadRequest},
+		{"in use", "DELETE", "/api/v1/admin/preferences/food/A1", root.Token, code("food", "A1"), nil, http.StatusConflict},
+		{"deleted", "DELETE", "/api/v1/admin/preferences/food/Z9", root.Token, code("food", "Z9"), nil, http.StatusOK},
+		{"deleted again", "DELETE", "/api/v1/admin/preferences/food/Z9", root.Token, code("food", "Z9"), nil, http.StatusNotFound},
+	})
+}
+
+func TestAdminPrompts(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+
+	question := func(q string) map[string]string { return map[string]string{"question": q} }
+	runHandlerTests(t, adminOnly(AdminPromptCreate), []handlerTest{
+		{"not an admin", "POST", "/api/v1/admin/prompts", alice.Token, nil, question("My favourite song"), http.StatusForbidden},
+		{"invalid body", "POST", "/api/v1/admin/prompts", root.Token, nil, "{", http.StatusBadRequest},
+		{"empty question", "POST", "/api/v1/admin/prompts", root.Token, nil, question(" "), http.StatusBadRequest},
+		{"question too long", "POST", "/api/v1/admin/prompts", root.Token, nil, question(strings.Repeat("a", 201)), http.StatusBadRequest},
+		{"existing question", "POST", "/api/v1/admin/prompts", root.Token, nil, question("My ideal weekend"), http.StatusConflict},
+	})
+
+	var created prompt
+	decode(t, serve(t, adminOnly(AdminPromptCreate), "POST", "/api/v1/admin/prompts", root.Token, nil, question("My favourite song")), &created)
+	if created.ID == 0 || !created.Active {
+		t.Fatalf("Created prompt: got %+v", created)
+	}
+
+	id := strconv.Itoa(created.ID)
+	promptID := func(id string) map[string]string { return map[string]string{"id": id} }
+	runHandlerTests(t, adminOnly(AdminPromptUpdate), []handlerTest{
+		{"not an admin", "PATCH", "/api/v1/admin/prompts/" + id, alice.Token, promptID(id), map[string]bool{"active": false}, http.StatusForbidden},
+		{"invalid id", "PATCH", "/api/v1/admin/prompts/first", root.Token, promptID("first"), map[string]bool{"active": false}, http.StatusBadRequest},
+		{"nothing to update", "PATCH", "/api/v1/admin/prompts/" + id, root.Token, promptID(id), map[string]string{}, http.StatusBadRequest},
+		{"unknown prompt", "PATCH", "/api/v1/admin/prompts/0", root.Token, promptID("0"), map[string]bool{"active": false}, http.StatusNotFound},
+		{"existing question", "PATCH", "/api/v1/admin/prompts/" + id, root.Token, promptID(id), question("My ideal weekend"), http.StatusConflict},
+		{"retired", "PATCH", "/api/v1/admin/prompts/" + id, root.Token, promptID(id), map[string]bool{"active": false}, http.StatusOK},
+	})
+
+	// Retired prompts are listed for admins but no longer offered to users
+	var all, offered []prompt
+	decode(t, serve(t, adminOnly(AdminPrompts), "GET", "/api/v1/admin/prompts", root.Token, nil, nil), &all)
+	decode(t, serve(t, PromptList, "GET", "/api/v1/prompts", alice.Token, nil, nil), &offered)
+	if len(all) != len(offered)+1 {
+		t.Errorf("Got %d prompts for admins and %d for users, want one retired", len(all), len(offered))
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+	serve(t, adminOnly(AdminPasswordReset), "POST", "/api/v1/admin/users/"+alice.ID+"/password-reset", root.Token, map[string]string{"uuid": alice.ID}, nil)
+
+	runHandlerTests(t, adminOnly(AdminAudit), []handlerTest{
+		{"no token", "GET", "/api/v1/admin/audit-log", "", nil, nil, http.StatusUnauthorized},
+		{"limit too large", "GET", "/api/v1/admin/audit-log?limit=201", root.Token, nil, nil, http.StatusBadRequest},
+		{"audit log", "GET", "/api/v1/admin/audit-log", root.Token, nil, nil, http.StatusOK},
+	})
+
+	// Reading the log is logged too, the newest entry comes first
+	var entries []struct {
+		ActorID string          `json:"actor_id"`
+		Action  string          `json:"action"`
+		Target  string          `json:"target"`
+		Details json.RawMessage `json:"details"`
+	}
+	decode(t, serve(t, adminOnly(AdminAudit), "GET", "/api/v1/admin/audit-log?limit=10", root.Token, nil, nil), &entries)
+	if len(entries) == 0 || entries[0].Action != "list_audit" || entries[0].ActorID != root.ID {
+		t.Fatalf("Audit log: got %+v", entries)
+	}
+	found := false
+	for _, e := range entries {
+		if e.Target == alice.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("The password reset of alice is not in the audit log: %+v", entries)
+	}
+}
+
+func TestAdminDeprecations(t *testing.T) {
+	db := newTestDB(t)
+	root := db.Admin(t, "root")
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, adminOnly(AdminDeprecations), []handlerTest{
+		{"no token", "GET", "/api/v1/admin/deprecations", "", nil, nil, http.StatusUnauthorized},
+		{"not an admin", "GET", "/api/v1/admin/deprecations", alice.Token, nil, nil, http.StatusForbidden},
+		{"calls", "GET", "/api/v1/admin/deprecations", root.Token, nil, nil, http.StatusOK},
+	})
+}
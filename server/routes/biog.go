@@ -3,14 +3,19 @@ package routes
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	databaseSetup "match_me_module/database"
+	"match_me_module/events"
+	"match_me_module/matching"
 	middleware "match_me_module/middleware"
+	"match_me_module/profile"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 func AboutYou(w http.ResponseWriter, r *http.Request) {
@@ -42,18 +47,21 @@ func AboutYou(w http.ResponseWriter, r *http.Request) {
 		AboutYou string `json:"newAbout"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body for user_id %s: %v", userID, err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
-	log.Println(requestBody.AboutYou)
 
-	if requestBody.AboutYou == "" {
+	// Markup and invisible characters are removed before the length is checked
+	aboutYou, err := profile.CleanRequired(requestBody.AboutYou, profile.MaxAboutMe)
+	if err == profile.ErrEmpty {
 		http.Error(w, "About You field cannot be empty", http.StatusBadRequest)
 		log.Println("Attempted to set an empty About You field for user_id", userID)
 		return
 	}
+	if err != nil {
+		http.Error(w, "Invalid About You field: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Connect to the database
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
@@ -87,14 +95,18 @@ func AboutYou(w http.ResponseWriter, r *http.Request) {
 		ON CONFLICT (user_uuid) DO UPDATE 
 		SET about_me = EXCLUDED.about_me
 	`
-	_, err = db.Exec(query, userID, requestBody.AboutYou)
+	_, err = db.Exec(query, userID, aboutYou)
 	if err != nil {
 		http.Error(w, "Failed to update About You field", http.StatusInternalServerError)
 		log.Printf("Error upserting About You field for user_id %s: %v", userID, err)
 		return
 	}
 
+	// The about text counts towards profile completeness
+	profileChanged(userID)
+
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "About You updated successfully",
@@ -187,9 +199,7 @@ func Birthday(w http.ResponseWriter, r *http.Request) {
 		Birthday string `json:"birthday"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body for user_id %s: %v", userID, err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -199,6 +209,14 @@ func Birthday(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The same rules as at registration apply
+	birthdate, err := matching.ParseBirthdate(requestBody.Birthday, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("Invalid birthday for user_id %s: %v", userID, err)
+		return
+	}
+
 	// Connect to the database
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
@@ -209,14 +227,17 @@ func Birthday(w http.ResponseWriter, r *http.Request) {
 		ON CONFLICT (user_uuid) DO UPDATE 
 		SET birthdate = EXCLUDED.birthdate
 	`
-	_, err = db.Exec(query, userID, requestBody.Birthday)
+	_, err = db.Exec(query, userID, birthdate)
 	if err != nil {
 		http.Error(w, "Failed to update Birthday field", http.StatusInternalServerError)
 		log.Printf("Error upserting Birthday field for user_id %s: %v", userID, err)
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Birthday updated successfully",
@@ -250,10 +271,15 @@ func BirthdayGet(w http.ResponseWriter, r *http.Request) {
 	// Connect to the database
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
-	// Use sql.NullString to handle possible NULL values
-	var birthday sql.NullString
-	query := "SELECT birthdate FROM user_info WHERE user_uuid = $1"
-	err = db.QueryRow(query, userID).Scan(&birthday)
+	// Use sql.NullTime to handle possible NULL values
+	var birthday sql.NullTime
+	var showBirthdate bool
+	query := `
+		SELECT i.birthdate, coalesce(p.show_birthdate, false)
+		FROM user_info i
+		LEFT JOIN profile_info p ON p.user_uuid = i.user_uuid
+		WHERE i.user_uuid = $1`
+	err = db.QueryRow(query, userID).Scan(&birthday, &showBirthdate)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Birthdate not found", http.StatusNotFound)
@@ -264,44 +290,174 @@ func BirthdayGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If birthday is NULL, return an empty string or handle it as required
-	if !birthday.Valid {
-		// If birthday is NULL, you can decide how to handle it (e.g., return an empty string or a specific message)
-		birthday.String = ""
+	// An unset birthday is sent as an empty string with age 0
+	var birthdayString string
+	var age int
+	if birthday.Valid {
+		birthdayString = birthday.Time.Format(matching.BirthdateLayout)
+		age = matching.Age(birthday.Time, time.Now())
 	}
 
-	// Debugging: Log the birthday string
-	log.Printf("Fetched birthday: %s", birthday.String)
+	// Send the birthday and age as a JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"birthday":       birthdayString,
+		"age":            age,
+		"show_birthdate": showBirthdate,
+	})
+}
 
-	// Trim any unwanted whitespace from the date string
-	birthdayString := strings.TrimSpace(birthday.String)
+func BirthdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
 
-	// Calculate age from the birthday (assuming birthday is in YYYY-MM-DD format)
-	var age int
-	if birthdayString != "" {
-		// Use the correct layout to handle the timestamp with time
-		birthdayTime, err := time.Parse("2006-01-02T15:04:05Z", birthdayString)
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Others always see the age, this only decides about the exact date
+	var requestBody struct {
+		ShowBirthdate *bool `json:"show_birthdate"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	if requestBody.ShowBirthdate == nil {
+		http.Error(w, "show_birthdate is required", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	_, err = db.Exec("UPDATE profile_info SET show_birthdate = $1 WHERE user_uuid = $2", *requestBody.ShowBirthdate, userID)
+	if err != nil {
+		http.Error(w, "Failed to update birthdate privacy", http.StatusInternalServerError)
+		log.Printf("Error updating birthdate privacy for user_id %s: %v", userID, err)
+		return
+	}
+
+	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Birthdate privacy updated successfully",
+	})
+}
+
+// ProfileGet shows the profile of a user as others see it. The exact
+// birthdate is only included when its owner chose to show it.
+func ProfileGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	profileID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(profileID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Blocked and inactive users look the same as missing ones
+	var view struct {
+		UserID    string  `json:"user_id"`
+		Username  string  `json:"username"`
+		FirstName string  `json:"first_name"`
+		City      *string `json:"city"`
+		Age       *int    `json:"age"`
+		Birthdate *string `json:"birthdate,omitempty"`
+		AboutMe   string  `json:"about_me"`
+		profileFields
+		Prompts []promptAnswer `json:"prompts"`
+	}
+	var birthdate sql.NullTime
+	var showBirthdate bool
+	var aboutMe sql.NullString
+	query := fmt.Sprintf(`
+		SELECT i.user_uuid, i.username, i.first_name, d.user_city, i.birthdate,
+		       coalesce(p.show_birthdate, false), p.about_me
+		FROM user_info i
+		LEFT JOIN user_data d ON d.user_uuid = i.user_uuid
+		LEFT JOIN profile_info p ON p.user_uuid = i.user_uuid
+		WHERE i.user_uuid = $2
+		  AND ($1::uuid = $2::uuid OR (%s AND %s))`,
+		matching.NotBlockedSQL("$1::uuid", "$2::uuid"), matching.ActiveAccountSQL("$2::uuid"))
+	err = db.QueryRow(query, userID, profileID).
+		Scan(&view.UserID, &view.Username, &view.FirstName, &view.City, &birthdate, &showBirthdate, &aboutMe)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch profile", http.StatusInternalServerError)
+		log.Printf("Error fetching profile %s for user_id %s: %v", profileID, userID, err)
+		return
+	}
+
+	// Owners are told who looked at their profile, once an hour per viewer
+	if profileID != userID {
+		err := events.PublishOnce(db, profileID, events.TypeProfileViewed, map[string]string{"user_id": userID}, time.Hour)
 		if err != nil {
-			http.Error(w, "Invalid birthday format", http.StatusInternalServerError)
-			log.Printf("Error parsing birthday for user_id %s: %v", userID, err)
-			return
+			log.Printf("Error publishing profile view of %s by user_id %s: %v", profileID, userID, err)
 		}
+	}
 
-		// Calculate the age by comparing the birthday to today's date
-		currentYear := time.Now().Year()
-		age = currentYear - birthdayTime.Year()
-		if birthdayTime.After(time.Now().AddDate(-age, 0, 0)) {
-			age-- // Adjust age if birthday hasn't occurred yet this year
+	view.AboutMe = aboutMe.String
+	if view.profileFields, err = loadFields(db, profileID); err == nil {
+		view.Prompts, err = loadAnswers(db, profileID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch profile", http.StatusInternalServerError)
+		log.Printf("Error fetching profile %s for user_id %s: %v", profileID, userID, err)
+		return
+	}
+	if birthdate.Valid {
+		age := matching.Age(birthdate.Time, time.Now())
+		view.Age = &age
+		if showBirthdate || profileID == userID {
+			formatted := birthdate.Time.Format(matching.BirthdateLayout)
+			view.Birthdate = &formatted
 		}
-	} else {
-		// If birthday is not set, age calculation can be skipped
-		age = 0 // or handle this case differently if needed
 	}
 
-	// Send the birthday and age as a JSON response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"birthday": birthdayString,
-		"age":      age,
-	})
+	json.NewEncoder(w).Encode(view)
 }
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAboutYou(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, AboutYou, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/about", "", nil, map[string]string{"newAbout": "Hello"}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/about", alice.Token, nil, "{", http.StatusBadRequest},
+		{"empty", "PUT", "/api/v1/me/about", alice.Token, nil, map[string]string{"newAbout": "  "}, http.StatusBadRequest},
+		{"only markup", "PUT", "/api/v1/me/about", alice.Token, nil, map[string]string{"newAbout": "<b></b>"}, http.StatusBadRequest},
+		{"too long", "PUT", "/api/v1/me/about", alice.Token, nil, map[string]string{"newAbout": strings.Repeat("a", 1001)}, http.StatusBadRequest},
+		{"updated", "PUT", "/api/v1/me/about", alice.Token, nil, map[string]string{"newAbout": "I like <i>long</i> walks."}, http.StatusOK},
+	})
+}
+
+func TestAboutYouGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, AboutYouGet, []handlerTest{
+		{"no token", "GET", "/api/v1/me/about", "", nil, nil, http.StatusUnauthorized},
+		{"not written yet", "GET", "/api/v1/me/about", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	serve(t, AboutYou, "PUT", "/api/v1/me/about", alice.Token, nil, map[string]string{"newAbout": "I like <i>long</i> walks."})
+	var about map[string]string
+	decode(t, serve(t, AboutYouGet, "GET", "/api/v1/me/about", alice.Token, nil, nil), &about)
+	if about["about_you"] != "I like long walks." {
+		t.Errorf("About you: got %q", about["about_you"])
+	}
+}
+
+func TestBirthday(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, Birthday, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/birthdate", "", nil, map[string]string{"birthday": "1991-02-03"}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/birthdate", alice.Token, nil, "{", http.StatusBadRequest},
+		{"empty", "PUT", "/api/v1/me/birthdate", alice.Token, nil, map[string]string{"birthday": ""}, http.StatusBadRequest},
+		{"not a date", "PUT", "/api/v1/me/birthdate", alice.Token, nil, map[string]string{"birthday": "03.02.1991"}, http.StatusBadRequest},
+		{"in the future", "PUT", "/api/v1/me/birthdate", alice.Token, nil, map[string]string{"birthday": "2999-01-01"}, http.StatusBadRequest},
+		{"too young", "PUT", "/api/v1/me/birthdate", alice.Token, nil, map[string]string{"birthday": "2015-01-01"}, http.StatusBadRequest},
+		{"updated", "PUT", "/api/v1/me/birthdate", alice.Token, nil, map[string]string{"birthday": "1991-02-03"}, http.StatusOK},
+	})
+}
+
+func TestBirthdayGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, BirthdayGet, []handlerTest{
+		{"no token", "GET", "/api/v1/me/birthdate", "", nil, nil, http.StatusUnauthorized},
+		{"invalid token", "GET", "/api/v1/me/birthdate", "not-a-token", nil, nil, http.StatusUnauthorized},
+		{"birthdate", "GET", "/api/v1/me/birthdate", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var birthday struct {
+		Birthday      string `json:"birthday"`
+		Age           int    `json:"age"`
+		ShowBirthdate bool   `json:"show_birthdate"`
+	}
+	decode(t, serve(t, BirthdayGet, "GET", "/api/v1/me/birthdate", alice.Token, nil, nil), &birthday)
+	if birthday.Birthday != "1990-05-17" || birthday.Age < 18 || birthday.ShowBirthdate {
+		t.Errorf("Unexpected birthday: %+v", birthday)
+	}
+}
+
+func TestBirthdatePrivacy(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, BirthdatePrivacy, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/birthdate/privacy", "", nil, map[string]bool{"show_birthdate": true}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/birthdate/privacy", alice.Token, nil, "{", http.StatusBadRequest},
+		{"missing flag", "PUT", "/api/v1/me/birthdate/privacy", alice.Token, nil, map[string]string{}, http.StatusBadRequest},
+		{"shown", "PUT", "/api/v1/me/birthdate/privacy", alice.Token, nil, map[string]bool{"show_birthdate": true}, http.StatusOK},
+		{"hidden", "PUT", "/api/v1/me/birthdate/privacy", alice.Token, nil, map[string]bool{"show_birthdate": false}, http.StatusOK},
+	})
+}
+
+func TestProfileGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	carol := db.User(t, "carol")
+	if _, err := db.Exec("INSERT INTO blocks (blocker_uuid, blocked_uuid, datetime_created) VALUES ($1, $2, now())", carol.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	profile := func(user string) map[string]string { return map[string]string{"uuid": user} }
+	runHandlerTests(t, ProfileGet, []handlerTest{
+		{"no token", "GET", "/api/v1/users/" + alice.ID + "/profile", "", profile(alice.ID), nil, http.StatusUnauthorized},
+		{"invalid id", "GET", "/api/v1/users/nobody/profile", bob.Token, profile("nobody"), nil, http.StatusBadRequest},
+		{"unknown user", "GET", "/api/v1/users/" + unknownUser + "/profile", bob.Token, profile(unknownUser), nil, http.StatusNotFound},
+		{"own profile", "GET", "/api/v1/users/" + alice.ID + "/profile", alice.Token, profile(alice.ID), nil, http.StatusOK},
+		{"other profile", "GET", "/api/v1/users/" + alice.ID + "/profile", bob.Token, profile(alice.ID), nil, http.StatusOK},
+		{"blocked by them", "GET", "/api/v1/users/" + carol.ID + "/profile", alice.Token, profile(carol.ID), nil, http.StatusNotFound},
+		{"blocked them", "GET", "/api/v1/users/" + alice.ID + "/profile", carol.Token, profile(alice.ID), nil, http.StatusNotFound},
+	})
+
+	// The exact birthdate is only shown to others when its owner allows it
+	var view struct {
+		Age       *int    `json:"age"`
+		Birthdate *string `json:"birthdate"`
+	}
+	decode(t, serve(t, ProfileGet, "GET", "/api/v1/users/"+alice.ID+"/profile", bob.Token, profile(alice.ID), nil), &view)
+	if view.Age == nil || view.Birthdate != nil {
+		t.Errorf("Hidden birthdate: got age %v, birthdate %v", view.Age, view.Birthdate)
+	}
+	serve(t, BirthdatePrivacy, "PUT", "/api/v1/me/birthdate/privacy", alice.Token, nil, map[string]bool{"show_birthdate": true})
+	decode(t, serve(t, ProfileGet, "GET", "/api/v1/users/"+alice.ID+"/profile", bob.Token, profile(alice.ID), nil), &view)
+	if view.Birthdate == nil || *view.Birthdate != "1990-05-17" {
+		t.Errorf("Shown birthdate: got %v", view.Birthdate)
+	}
+}
@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Request bodies are decoded strictly. encoding/json drops fields it does
+// not know and matches names regardless of case, so a misspelt field would
+// silently keep its zero value. Here every field has to be one the handler
+// reads, spelt exactly, and nothing may follow the JSON value.
+
+// fieldError is what is wrong with one field, named by its path in the body
+// like "answers[0].prompt_id".
+type fieldError struct {
+	Field   string
+	Problem string
+}
+
+// bodyError is a request body the client has to correct.
+type bodyError struct {
+	Problem string // about the body as a whole
+	Fields  []fieldError
+}
+
+func (e *bodyError) Error() string {
+	var parts []string
+	if e.Problem != "" {
+		parts = append(parts, e.Problem)
+	}
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Problem)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// decodeJSON decodes the request body into v. When it cannot, the client
+// gets 400 naming every field that is wrong, or 413 for a body over the
+// limit of middleware.JSONBody, and false is returned.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := decodeBody(r.Body, v)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	} else {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	}
+	log.Printf("Error decoding request body of %s %s: %v", r.Method, r.URL.Path, err)
+	return false
+}
+
+func decodeBody(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &bodyError{Problem: "the body is empty"}
+	}
+
+	// All unknown fields are reported at once, the decoder stops at the first
+	if fields := unknownFields(data, reflect.TypeOf(v), ""); len(fields) > 0 {
+		return &bodyError{Fields: fields}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return describeDecodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return &bodyError{Problem: "unexpected data after the JSON value"}
+	}
+	return nil
+}
+
+// describeDecodeError turns an error of the decoder into one that tells the
+// client what to fix.
+func describeDecodeError(err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		return &bodyError{Problem: fmt.Sprintf("invalid JSON at byte %d: %v", syntaxError.Offset, syntaxError)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &bodyError{Problem: "the body ends in the middle of the JSON value"}
+	case errors.As(err, &typeError):
+		problem := fmt.Sprintf("want %s, got %s", jsonKind(typeError.Type), typeError.Value)
+		if typeError.Field == "" {
+			return &bodyError{Problem: "the body has to be a JSON " + jsonKind(typeError.Type)}
+		}
+		return &bodyError{Fields: []fieldError{{typeError.Field, problem}}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &bodyError{Fields: []fieldError{{name, "unknown field"}}}
+	}
+	return err
+}
+
+// jsonKind names the JSON type a Go type is decoded from.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return t.String()
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields walks the body along the type it is decoded into and returns
+// the object keys that are not exactly the name of a field. Values that do
+// not fit the type are left to the decoder to report.
+func unknownFields(data []byte, t reflect.Type, path string) []fieldError {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// A type that decodes itself decides which fields it takes
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	var problems []fieldError
+	switch t.Kind() {
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if json.Unmarshal(data, &object) != nil {
+			return nil
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedKeys(object) {
+			field, ok := fields[key]
+			if !ok {
+				problem := "unknown field"
+				for name := range fields {
+					if strings.EqualFold(name, key) {
+						problem = fmt.Sprintf("unknown field, did you mean %q", name)
+					}
+				}
+				problems = append(problems, fieldError{joinPath(path, key), problem})
+				continue
+			}
+			problems = append(problems, unknownFields(object[key], field, joinPath(path, key))...)
+		}
+	case reflect.Map:
+		var object map[string]json.RawMessage
+		if json.Unmarshal(data, &object) != nil {
+			return nil
+		}
+		for _, key := range sortedKeys(object) {
+			problems = append(problems, unknownFields(object[key], t.Elem(), joinPath(path, key))...)
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return nil
+		}
+		for i, item := range items {
+			problems = append(problems, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the type of every field of a struct by its JSON name,
+// including the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded, typ := range jsonFields(field.Type) {
+				if _, ok := fields[embedded]; !ok {
+					fields[embedded] = typ
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func sortedKeys(object map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeBody(t *testing.T) {
+	type answer struct {
+		PromptID int    `json:"prompt_id"`
+		Answer   string `json:"answer"`
+	}
+	type body struct {
+		Code    string          `json:"code"`
+		Remove  bool            `json:"isUnchecked"`
+		MinAge  *int            `json:"min_age"`
+		Answers []answer        `json:"answers"`
+		Prefs   map[string]bool `json:"prefs"`
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string // part of the error, empty when the body is valid
+	}{
+		{"valid", `{"code": "A1", "isUnchecked": true, "answers": [{"prompt_id": 1, "answer": "Yes"}]}`, ""},
+		{"null field", `{"min_age": null}`, ""},
+		{"trailing whitespace", "{\"code\": \"A1\"}\n", ""},
+		{"empty", "  ", "the body is empty"},
+		{"syntax", `{"code": }`, "invalid JSON at byte"},
+		{"cut off", `{"code": "A1"`, "ends in the middle"},
+		{"trailing data", `{"code": "A1"} {"code": "B1"}`, "unexpected data after the JSON value"},
+		{"unknown field", `{"code": "A1", "remove": true}`, "remove: unknown field"},
+		{"case", `{"code": "A1", "isunchecked": true}`, `isunchecked: unknown field, did you mean "isUnchecked"`},
+		{"nested", `{"answers": [{"prompt_id": 1}, {"promptId": 2}]}`, "answers[1].promptId: unknown field"},
+		{"every field", `{"Code": "A1", "extra": 1}`, `Code: unknown field, did you mean "code"; extra: unknown field`},
+		{"wrong type", `{"code": 1}`, "code: want string, got number"},
+		{"not an object", `["A1"]`, "the body has to be a JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v body
+			err := decodeBody(strings.NewReader(tt.body), &v)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("got no error, want %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("got error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"encoding/json"
 	"log"
+	databaseSetup "match_me_module/database"
 	middleware "match_me_module/middleware"
 	"net/http"
 
@@ -40,9 +41,7 @@ func EditUsername(w http.ResponseWriter, r *http.Request) {
 		Username string `json:"username"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -52,8 +51,11 @@ func EditUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the username in the database
-	query := `UPDATE user_info SET username = ? WHERE user_uuid = ?`
+	query := `UPDATE user_info SET username = $1 WHERE user_uuid = $2`
 	_, err = db.Exec(query, requestBody.Username, userID)
 	if err != nil {
 		http.Error(w, "Failed to update username", http.StatusInternalServerError)
@@ -62,6 +64,7 @@ func EditUsername(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Username updated successfully",
@@ -98,9 +101,7 @@ func EditEmail(w http.ResponseWriter, r *http.Request) {
 		Email string `json:"email"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -110,8 +111,11 @@ func EditEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the email in the database
-	query := `UPDATE user_info SET email = ? WHERE user_uuid = ?`
+	query := `UPDATE user_info SET email = $1 WHERE user_uuid = $2`
 	_, err = db.Exec(query, requestBody.Email, userID)
 	if err != nil {
 		http.Error(w, "Failed to update email", http.StatusInternalServerError)
@@ -120,6 +124,7 @@ func EditEmail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Email updated successfully",
@@ -156,9 +161,7 @@ func EditFirst(w http.ResponseWriter, r *http.Request) {
 		FirstName string `json:"first_name"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -168,8 +171,11 @@ func EditFirst(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the FirstName in the database
-	query := `UPDATE user_info SET first_name = ? WHERE user_uuid = ?`
+	query := `UPDATE user_info SET first_name = $1 WHERE user_uuid = $2`
 	_, err = db.Exec(query, requestBody.FirstName, userID)
 	if err != nil {
 		http.Error(w, "Failed to update first_name", http.StatusInternalServerError)
@@ -178,6 +184,7 @@ func EditFirst(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "FirstName updated successfully",
@@ -214,9 +221,7 @@ func EditMiddle(w http.ResponseWriter, r *http.Request) {
 		MiddleName string `json:"middle_name"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -226,8 +231,11 @@ func EditMiddle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the Middle Name in the database
-	query := `UPDATE user_info SET middle_name = ? WHERE user_uuid = ?`
+	query := `UPDATE user_info SET middle_name = $1 WHERE user_uuid = $2`
 	_, err = db.Exec(query, requestBody.MiddleName, userID)
 	if err != nil {
 		http.Error(w, "Failed to update middle_name", http.StatusInternalServerError)
@@ -236,6 +244,7 @@ func EditMiddle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Middle name updated successfully",
@@ -272,9 +281,7 @@ func EditLast(w http.ResponseWriter, r *http.Request) {
 		LastName string `json:"last_name"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -284,8 +291,11 @@ func EditLast(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the Last Name in the database
-	query := `UPDATE user_info SET last_name = ? WHERE user_uuid = ?`
+	query := `UPDATE user_info SET last_name = $1 WHERE user_uuid = $2`
 	_, err = db.Exec(query, requestBody.LastName, userID)
 	if err != nil {
 		http.Error(w, "Failed to update last_name", http.StatusInternalServerError)
@@ -294,6 +304,7 @@ func EditLast(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Last name updated successfully",
@@ -329,9 +340,7 @@ func EditPassword(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body for user_id %s: %v", userID, err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -343,8 +352,11 @@ func EditPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the password in the database
-	query := `UPDATE user_table SET password_hash = ? WHERE user_uuid = ?`
+	query := `UPDATE user_table SET password_hash = $1 WHERE user_uuid = $2`
 	_, err = db.Exec(query, hashedPassword, userID)
 	if err != nil {
 		http.Error(w, "Error updating password", http.StatusInternalServerError)
@@ -353,6 +365,7 @@ func EditPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Password updated successfully",
@@ -390,12 +403,24 @@ func EditCity(w http.ResponseWriter, r *http.Request) {
 		Longitude float64 `json:"longitude"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		log.Printf("Failed to decode request body for user_id %s: %v", userID, err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
+	if requestBody.City == "" {
+		http.Error(w, "City cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the city and its coordinates agree
+	city, latitude, longitude, ok := validateCity(w, requestBody.City, requestBody.Latitude, requestBody.Longitude)
+	if !ok {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Update the user's city and location in the database
 	query := `
 		UPDATE user_data 
@@ -403,14 +428,17 @@ func EditCity(w http.ResponseWriter, r *http.Request) {
 		    register_location = ST_SetSRID(ST_MakePoint($2, $3), 4326)
 		WHERE user_uuid = $4
 	`
-	_, err = db.Exec(query, requestBody.City, requestBody.Longitude, requestBody.Latitude, userID)
+	_, err = db.Exec(query, city, longitude, latitude, userID)
 	if err != nil {
 		http.Error(w, "Error updating user location", http.StatusInternalServerError)
 		log.Printf("Error updating user location for user_id %s: %v", userID, err)
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "City and location updated successfully",
@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEditFields(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	fields := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		field   string
+		value   string
+	}{
+		{"username", EditUsername, "/api/v1/me/username", "username", "alice2"},
+		{"email", EditEmail, "/api/v1/me/email", "email", "alice2@example.com"},
+		{"first name", EditFirst, "/api/v1/me/first-name", "first_name", "Alice"},
+		{"middle name", EditMiddle, "/api/v1/me/middle-name", "middle_name", "Marie"},
+		{"last name", EditLast, "/api/v1/me/last-name", "last_name", "Smith"},
+	}
+	for _, f := range fields {
+		t.Run(f.name, func(t *testing.T) {
+			runHandlerTests(t, f.handler, []handlerTest{
+				{"no token", "PUT", f.target, "", nil, map[string]string{f.field: f.value}, http.StatusUnauthorized},
+				{"invalid body", "PUT", f.target, alice.Token, nil, "{", http.StatusBadRequest},
+				{"empty", "PUT", f.target, alice.Token, nil, map[string]string{f.field: ""}, http.StatusBadRequest},
+				{"updated", "PUT", f.target, alice.Token, nil, map[string]string{f.field: f.value}, http.StatusOK},
+			})
+		})
+	}
+
+	var username string
+	if err := db.QueryRow("SELECT username FROM user_info WHERE user_uuid = $1", alice.ID).Scan(&username); err != nil {
+		t.Fatal(err)
+	}
+	if username != "alice2" {
+		t.Errorf("Username: got %q, want %q", username, "alice2")
+	}
+}
+
+func TestEditPassword(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, EditPassword, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/password", "", nil, map[string]string{"password": "new-password"}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/password", alice.Token, nil, "{", http.StatusBadRequest},
+		{"updated", "PUT", "/api/v1/me/password", alice.Token, nil, map[string]string{"password": "new-password"}, http.StatusOK},
+	})
+
+	login := map[string]string{"username": "alice", "password": "new-password"}
+	if recorder := serve(t, Login, "POST", "/api/v1/sessions", "", nil, login); recorder.Code != http.StatusOK {
+		t.Errorf("Login with the new password: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestEditCity(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, EditCity, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/city", "", nil, map[string]string{"city": "Tartu"}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/city", alice.Token, nil, "{", http.StatusBadRequest},
+		{"empty", "PUT", "/api/v1/me/city", alice.Token, nil, map[string]string{"city": ""}, http.StatusBadRequest},
+		{"unknown city", "PUT", "/api/v1/me/city", alice.Token, nil, map[string]string{"city": "Atlantis"}, http.StatusBadRequest},
+		{"far from the city", "PUT", "/api/v1/me/city", alice.Token, nil, map[string]interface{}{
+			"city": "Tartu", "latitude": 59.44, "longitude": 24.75,
+		}, http.StatusBadRequest},
+		{"city only", "PUT", "/api/v1/me/city", alice.Token, nil, map[string]string{"city": "Tartu"}, http.StatusOK},
+		{"city and position", "PUT", "/api/v1/me/city", alice.Token, nil, map[string]interface{}{
+			"city": "Narva", "latitude": 59.38, "longitude": 28.19,
+		}, http.StatusOK},
+	})
+
+	var city string
+	if err := db.QueryRow("SELECT user_city FROM user_data WHERE user_uuid = $1", alice.ID).Scan(&city); err != nil {
+		t.Fatal(err)
+	}
+	if city != "Narva" {
+		t.Errorf("City: got %q, want %q", city, "Narva")
+	}
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/events"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// A comment line is sent this often so proxies keep the stream open, the
+	// log is also polled then for events published by other instances
+	eventHeartbeat = 15 * time.Second
+
+	// Events sent per database read
+	eventBatch = 100
+
+	// How long a disconnected client waits before reconnecting, in milliseconds
+	eventRetry = 3000
+)
+
+// publishEvent adds an event to the user's stream, failures are logged and
+// do not fail the request that caused it.
+func publishEvent(userID, eventType string, data interface{}) {
+	if err := events.Publish(databaseSetup.GetDB(), userID, eventType, data); err != nil {
+		log.Printf("Error publishing %s event for user_id %s: %v", eventType, userID, err)
+	}
+}
+
+// Events streams live updates to the client as Server-Sent Events. A client
+// resuming after a disconnect gets everything after its Last-Event-ID that
+// is still in the log. EventSource cannot send headers, it sends the token
+// cookie or passes a stream ticket as ?ticket=.
+func Events(w http.ResponseWriter, r *http.Request) {
+	userID, tokenExpiresAt, err := streamUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Without a Last-Event-ID the stream starts with the next event
+	var lastID int64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("last_event_id")
+	}
+	if resume != "" {
+		lastID, err = strconv.ParseInt(resume, 10, 64)
+		if err != nil || lastID < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	} else {
+		lastID, err = events.LatestID(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to open event stream", http.StatusInternalServerError)
+			log.Println(err)
+			return
+		}
+	}
+
+	wake, cancel, err := events.Subscribe(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer cancel()
+
+	// The stream ends with the token, the client reconnects with a fresh one
+	expires := time.NewTimer(time.Hour)
+	if !tokenExpiresAt.IsZero() {
+		expires.Reset(time.Until(tokenExpiresAt))
+	}
+	defer expires.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		// Send everything that is new, in batches
+		for {
+			batch, err := events.Since(db, userID, lastID, eventBatch)
+			if err != nil {
+				log.Printf("Error reading events of user_id %s: %v", userID, err)
+				return
+			}
+			for _, e := range batch {
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data); err != nil {
+					return
+				}
+				lastID = e.ID
+			}
+			flusher.Flush()
+			if len(batch) < eventBatch {
+				break
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expires.C:
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
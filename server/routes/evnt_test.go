@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"match_me_module/events"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+
+	runHandlerTests(t, Events, []handlerTest{
+		{"no token", "GET", "/api/v1/events", "", nil, nil, http.StatusUnauthorized},
+		{"token in the query", "GET", "/api/v1/events?token=" + alice.Token, "", nil, nil, http.StatusUnauthorized},
+		{"invalid last event id", "GET", "/api/v1/events?last_event_id=abc", alice.Token, nil, nil, http.StatusBadRequest},
+		{"negative last event id", "GET", "/api/v1/events?last_event_id=-1", alice.Token, nil, nil, http.StatusBadRequest},
+	})
+
+	for _, eventType := range []string{events.TypeConnectionRequest, events.TypeConnectionAccepted} {
+		if err := events.Publish(db.DB, alice.ID, eventType, map[string]string{"user_id": bob.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := events.Publish(db.DB, bob.ID, events.TypeProfileViewed, map[string]string{"user_id": alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream only ends with the request, EventSource passes a ticket in the query
+	stream := func(target string) string {
+		var issued struct {
+			Ticket string `json:"ticket"`
+		}
+		decode(t, serve(t, StreamTicket, "POST", "/api/v1/me/stream-tickets", alice.Token, nil, nil), &issued)
+		if strings.Contains(target, "?") {
+			target += "&ticket=" + issued.Ticket
+		} else {
+			target += "?ticket=" + issued.Ticket
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		recorder := serveContext(ctx, t, Events, "GET", target, "", nil, nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d, want %d: %s", target, recorder.Code, http.StatusOK, recorder.Body.String())
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "text/event-stream" {
+			t.Errorf("Content-Type: got %q", contentType)
+		}
+		body := recorder.Body.String()
+		if !strings.HasPrefix(body, fmt.Sprintf("retry: %d\n\n", eventRetry)) {
+			t.Errorf("Stream does not start with the retry interval: %q", body)
+		}
+		return body
+	}
+
+	// A new stream starts after the events already in the log
+	if body := stream("/api/v1/events"); strings.Contains(body, "event:") {
+		t.Errorf("New stream replayed old events: %q", body)
+	}
+
+	// A resumed one gets everything after the last event seen, and only the user's own
+	var first int64
+	if err := db.QueryRow("SELECT min(id) FROM event_log WHERE user_uuid = $1", alice.ID).Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	body := stream(fmt.Sprintf("/api/v1/events?last_event_id=%d", first))
+	if strings.Contains(body, events.TypeConnectionRequest) || !strings.Contains(body, "event: "+events.TypeConnectionAccepted) {
+		t.Errorf("Resumed stream: got %q", body)
+	}
+	if strings.Contains(body, events.TypeProfileViewed) {
+		t.Errorf("Stream contains the events of another user: %q", body)
+	}
+}
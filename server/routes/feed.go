@@ -0,0 +1,380 @@
+package routes
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/events"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"match_me_module/notify"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Feed decisions
+const (
+	DecisionLike = "like"
+	DecisionPass = "pass"
+)
+
+const (
+	// Passed users come back into the feed after this long
+	passCooldown = 7 * 24 * time.Hour
+
+	// Feed sessions are forgotten after this long
+	feedSessionTTL = 24 * time.Hour
+
+	defaultFeedLimit = 10
+	maxFeedLimit     = 50
+)
+
+var feedSessionPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// newFeedSession returns a random identifier for a feed session.
+func newFeedSession() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func FeedGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	limit := defaultFeedLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxFeedLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit: must be between 1 and %d", maxFeedLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A session keeps the feed from repeating anyone, a new one is started when none is given
+	session := r.URL.Query().Get("session")
+	if session == "" {
+		session, err = newFeedSession()
+		if err != nil {
+			http.Error(w, "Failed to start feed session", http.StatusInternalServerError)
+			log.Printf("Error generating feed session: %v", err)
+			return
+		}
+	} else if !feedSessionPattern.MatchString(session) {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	query := fmt.Sprintf(`
+		SELECT r.user_uuid_with, i.username, i.first_name, r.compability, r.distance
+		FROM reccomendations r
+		JOIN user_info i ON i.user_uuid = r.user_uuid_with
+		WHERE r.user_uuid_of = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM decisions d
+			WHERE d.user_uuid_of = $1 AND d.user_uuid_with = r.user_uuid_with
+			  AND (d.decision = '%s' OR d.datetime_created > now() - $2 * interval '1 second')
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM real_connections c
+			WHERE c.user_uuid_of = $1 AND c.user_uuid_with = r.user_uuid_with
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM feed_impressions f
+			WHERE f.session_id = $3 AND f.user_uuid_of = $1 AND f.user_uuid_with = r.user_uuid_with
+		  )
+		  AND %s
+		  AND %s
+		ORDER BY r.compability DESC, r.user_uuid_with
+		LIMIT $4`, DecisionLike, matching.NotBlockedSQL("$1::uuid", "r.user_uuid_with"), matching.ActiveAccountSQL("r.user_uuid_with"))
+
+	rows, err := db.Query(query, userID, int(passCooldown.Seconds()), session, limit)
+	if err != nil {
+		http.Error(w, "Failed to query feed", http.StatusInternalServerError)
+		log.Printf("Error querying feed for user_id %s: %v", userID, err)
+		return
+	}
+	defer rows.Close()
+
+	type feedCandidate struct {
+		UserID      string  `json:"user_id"`
+		Username    string  `json:"username"`
+		FirstName   string  `json:"first_name"`
+		Compability float64 `json:"compability"`
+		Distance    float64 `json:"distance"`
+	}
+	candidates := []feedCandidate{}
+	for rows.Next() {
+		var c feedCandidate
+		if err := rows.Scan(&c.UserID, &c.Username, &c.FirstName, &c.Compability, &c.Distance); err != nil {
+			http.Error(w, "Failed to read feed", http.StatusInternalServerError)
+			log.Printf("Error scanning feed candidate: %v", err)
+			return
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read feed", http.StatusInternalServerError)
+		log.Printf("Error reading feed: %v", err)
+		return
+	}
+
+	// Remember who was shown in this session
+	shown := make([]string, len(candidates))
+	for i, c := range candidates {
+		shown[i] = c.UserID
+	}
+	if err := recordImpressions(db, session, userID, shown); err != nil {
+		http.Error(w, "Failed to record feed impressions", http.StatusInternalServerError)
+		log.Printf("Error recording feed impressions: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"session":    session,
+		"candidates": candidates,
+	})
+}
+
+// recordImpressions remembers the candidates of a feed page for the session,
+// all of them or none.
+func recordImpressions(db *sql.DB, session, userID string, shown []string) error {
+	if len(shown) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO feed_impressions (session_id, user_uuid_of, user_uuid_with, datetime_created)
+		SELECT $1, $2, shown, now()
+		FROM unnest($3::uuid[]) AS shown
+		ON CONFLICT DO NOTHING`, session, userID, pq.Array(shown))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PruneFeedImpressions forgets the impressions of sessions older than
+// feedSessionTTL. The job runner calls it periodically.
+func PruneFeedImpressions(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM feed_impressions WHERE datetime_created < now() - $1 * interval '1 second'", int(feedSessionTTL.Seconds()))
+	return err
+}
+
+func FeedDecide(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// The candidate comes from the path
+	candidateID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(candidateID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	if candidateID == userID {
+		http.Error(w, "Cannot decide on yourself", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body for the decision
+	var requestBody struct {
+		Decision string `json:"decision"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	if requestBody.Decision != DecisionLike && requestBody.Decision != DecisionPass {
+		http.Error(w, "Decision must be either like or pass", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Only active users that exist and have not blocked each other can be decided on
+	var visible bool
+	visibleQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM user_info WHERE user_uuid = $2 AND %s AND %s)",
+		matching.NotBlockedSQL("$1::uuid", "$2::uuid"), matching.ActiveAccountSQL("$2::uuid"))
+	if err := db.QueryRow(visibleQuery, userID, candidateID).Scan(&visible); err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error checking candidate %s: %v", candidateID, err)
+		return
+	}
+	if !visible {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	mutual, changed, err := RecordDecision(db, userID, candidateID, requestBody.Decision)
+	if err != nil {
+		http.Error(w, "Failed to record decision", http.StatusInternalServerError)
+		log.Printf("Error recording decision of user_id %s on %s: %v", userID, candidateID, err)
+		return
+	}
+
+	// A like the other user has not answered is a connection request, a like
+	// answering theirs accepts it. Repeating a decision announces nothing.
+	switch {
+	case !changed:
+	case mutual:
+		notifyUser(notify.KindConnectionAccepted, candidateID, userID, nil)
+		notifyUser(notify.KindMatch, userID, candidateID, nil)
+		publishEvent(candidateID, events.TypeConnectionAccepted, map[string]string{"user_id": userID})
+	case requestBody.Decision == DecisionLike:
+		notifyUser(notify.KindConnectionRequest, candidateID, userID, nil)
+		publishEvent(candidateID, events.TypeConnectionRequest, map[string]string{"user_id": userID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"decision": requestBody.Decision,
+		"mutual":   mutual,
+	})
+}
+
+// RecordDecision stores a like or pass. A like is also a connection request,
+// and when the other user already liked back both become connected. It
+// reports whether the decision completed a mutual match and whether it
+// differs from the decision stored before.
+func RecordDecision(db *sql.DB, userID, candidateID, decision string) (mutual, changed bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback()
+
+	// Decisions of a pair are made one at a time. Two simultaneous likes
+	// would otherwise each miss the other's uncommitted row.
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock(hashtext(least($1::text, $2::text) || greatest($1::text, $2::text)))",
+		userID, candidateID)
+	if err != nil {
+		return false, false, fmt.Errorf("error locking decisions: %v", err)
+	}
+
+	var previous string
+	err = tx.QueryRow("SELECT decision FROM decisions WHERE user_uuid_of = $1 AND user_uuid_with = $2", userID, candidateID).
+		Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, fmt.Errorf("error checking previous decision: %v", err)
+	}
+	changed = previous != decision
+
+	_, err = tx.Exec(`
+		INSERT INTO decisions (user_uuid_of, user_uuid_with, decision, datetime_created)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (user_uuid_of, user_uuid_with) DO UPDATE
+		SET decision = EXCLUDED.decision, datetime_created = EXCLUDED.datetime_created`,
+		userID, candidateID, decision)
+	if err != nil {
+		return false, false, fmt.Errorf("error saving decision: %v", err)
+	}
+
+	if decision == DecisionPass {
+		_, err = tx.Exec("DELETE FROM pending_connections WHERE user_uuid_of = $1 AND user_uuid_with = $2", userID, candidateID)
+		if err != nil {
+			return false, false, fmt.Errorf("error withdrawing connection request: %v", err)
+		}
+		return false, changed, tx.Commit()
+	}
+
+	var theirs string
+	err = tx.QueryRow("SELECT decision FROM decisions WHERE user_uuid_of = $1 AND user_uuid_with = $2",
+		candidateID, userID).Scan(&theirs)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, fmt.Errorf("error checking decision of %s: %v", candidateID, err)
+	}
+
+	if theirs != DecisionLike {
+		_, err = tx.Exec(`
+			INSERT INTO pending_connections (user_uuid_of, user_uuid_with)
+			SELECT $1, $2
+			WHERE NOT EXISTS (SELECT 1 FROM pending_connections WHERE user_uuid_of = $1 AND user_uuid_with = $2)`,
+			userID, candidateID)
+		if err != nil {
+			return false, false, fmt.Errorf("error saving connection request: %v", err)
+		}
+		return false, changed, tx.Commit()
+	}
+
+	// Mutual like, the pending requests turn into a connection in both directions
+	_, err = tx.Exec(`
+		DELETE FROM pending_connections
+		WHERE (user_uuid_of = $1 AND user_uuid_with = $2) OR (user_uuid_of = $2 AND user_uuid_with = $1)`,
+		userID, candidateID)
+	if err != nil {
+		return false, false, fmt.Errorf("error clearing connection requests: %v", err)
+	}
+	for _, pair := range [][2]string{{userID, candidateID}, {candidateID, userID}} {
+		_, err = tx.Exec(`
+			INSERT INTO real_connections (user_uuid_of, user_uuid_with)
+			SELECT $1, $2
+			WHERE NOT EXISTS (SELECT 1 FROM real_connections WHERE user_uuid_of = $1 AND user_uuid_with = $2)`,
+			pair[0], pair[1])
+		if err != nil {
+			return false, false, fmt.Errorf("error saving connection: %v", err)
+		}
+	}
+	return true, changed, tx.Commit()
+}
@@ -0,0 +1,172 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestFeedGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	carol := db.User(t, "carol")
+	for _, with := range []string{bob.ID, carol.ID} {
+		if _, err := db.Exec("INSERT INTO reccomendations (user_uuid_of, user_uuid_with, compability, distance) VALUES ($1, $2, 0.5, 10)", alice.ID, with); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A banned user is left out even before the recommendations are recomputed
+	if _, err := db.Exec("UPDATE user_table SET account_status = 'banned' WHERE user_uuid = $1", carol.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	const session = "0123456789abcdef0123456789abcdef"
+	runHandlerTests(t, FeedGet, []handlerTest{
+		{"no token", "GET", "/api/v1/feed", "", nil, nil, http.StatusUnauthorized},
+		{"limit too small", "GET", "/api/v1/feed?limit=0", alice.Token, nil, nil, http.StatusBadRequest},
+		{"limit too large", "GET", "/api/v1/feed?limit=51", alice.Token, nil, nil, http.StatusBadRequest},
+		{"invalid session", "GET", "/api/v1/feed?session=abc", alice.Token, nil, nil, http.StatusBadRequest},
+		{"new session", "GET", "/api/v1/feed", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	type feed struct {
+		Session    string `json:"session"`
+		Candidates []struct {
+			UserID string `json:"user_id"`
+		} `json:"candidates"`
+	}
+
+	// Nobody is shown twice in a session
+	var first, second feed
+	decode(t, serve(t, FeedGet, "GET", "/api/v1/feed?session="+session, alice.Token, nil, nil), &first)
+	if first.Session != session || len(first.Candidates) != 1 || first.Candidates[0].UserID != bob.ID {
+		t.Errorf("Feed: got %+v", first)
+	}
+	decode(t, serve(t, FeedGet, "GET", "/api/v1/feed?session="+session, alice.Token, nil, nil), &second)
+	if len(second.Candidates) != 0 {
+		t.Errorf("Feed repeated in the same session: got %+v", second)
+	}
+
+	// Old sessions are forgotten by the periodic sweep
+	if _, err := db.Exec("UPDATE feed_impressions SET datetime_created = now() - interval '2 days'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PruneFeedImpressions(db.DB); err != nil {
+		t.Fatal(err)
+	}
+	var third feed
+	decode(t, serve(t, FeedGet, "GET", "/api/v1/feed?session="+session, alice.Token, nil, nil), &third)
+	if len(third.Candidates) != 1 {
+		t.Errorf("Feed after the session expired: got %+v", third)
+	}
+
+	// Nor after they were liked
+	serve(t, FeedDecide, "PUT", "/api/v1/feed/"+bob.ID+"/decision", alice.Token, map[string]string{"uuid": bob.ID}, map[string]string{"decision": "like"})
+	var liked feed
+	decode(t, serve(t, FeedGet, "GET", "/api/v1/feed", alice.Token, nil, nil), &liked)
+	if len(liked.Candidates) != 0 {
+		t.Errorf("Feed after a like: got %+v", liked)
+	}
+}
+
+func TestFeedDecide(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	carol := db.User(t, "carol")
+	dave := db.User(t, "dave")
+	serve(t, BlockUser, "PUT", "/api/v1/me/blocks/"+alice.ID, carol.Token, map[string]string{"uuid": alice.ID}, nil)
+	if _, err := db.Exec("UPDATE user_table SET account_status = 'banned' WHERE user_uuid = $1", dave.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	decision := func(d string) map[string]string { return map[string]string{"decision": d} }
+	runHandlerTests(t, FeedDecide, []handlerTest{
+		{"no token", "PUT", "/api/v1/feed/" + bob.ID + "/decision", "", user(bob.ID), decision("like"), http.StatusUnauthorized},
+		{"invalid id", "PUT", "/api/v1/feed/bob/decision", alice.Token, user("bob"), decision("like"), http.StatusBadRequest},
+		{"yourself", "PUT", "/api/v1/feed/" + alice.ID + "/decision", alice.Token, user(alice.ID), decision("like"), http.StatusBadRequest},
+		{"invalid body", "PUT", "/api/v1/feed/" + bob.ID + "/decision", alice.Token, user(bob.ID), "{", http.StatusBadRequest},
+		{"unknown decision", "PUT", "/api/v1/feed/" + bob.ID + "/decision", alice.Token, user(bob.ID), decision("maybe"), http.StatusBadRequest},
+		{"unknown user", "PUT", "/api/v1/feed/" + unknownUser + "/decision", alice.Token, user(unknownUser), decision("like"), http.StatusNotFound},
+		{"blocked", "PUT", "/api/v1/feed/" + carol.ID + "/decision", alice.Token, user(carol.ID), decision("like"), http.StatusNotFound},
+		{"banned", "PUT", "/api/v1/feed/" + dave.ID + "/decision", alice.Token, user(dave.ID), decision("like"), http.StatusNotFound},
+		{"passed", "PUT", "/api/v1/feed/" + bob.ID + "/decision", alice.Token, user(bob.ID), decision("pass"), http.StatusOK},
+	})
+
+	var result struct {
+		Decision string `json:"decision"`
+		Mutual   bool   `json:"mutual"`
+	}
+	decode(t, serve(t, FeedDecide, "PUT", "/api/v1/feed/"+bob.ID+"/decision", alice.Token, user(bob.ID), decision("like")), &result)
+	if result.Decision != "like" || result.Mutual {
+		t.Errorf("First like: got %+v", result)
+	}
+
+	// Liking again does not send another connection request
+	serve(t, FeedDecide, "PUT", "/api/v1/feed/"+bob.ID+"/decision", alice.Token, user(bob.ID), decision("like"))
+	var requests int
+	if err := db.QueryRow("SELECT count(*) FROM event_log WHERE user_uuid = $1 AND type = 'connection_request'", bob.ID).Scan(&requests); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("Connection requests after liking twice: got %d, want 1", requests)
+	}
+
+	decode(t, serve(t, FeedDecide, "PUT", "/api/v1/feed/"+alice.ID+"/decision", bob.Token, user(alice.ID), decision("like")), &result)
+	if !result.Mutual {
+		t.Errorf("Liking back: got %+v, want a mutual match", result)
+	}
+
+	var connected int
+	if err := db.QueryRow("SELECT count(*) FROM real_connections WHERE user_uuid_of = $1 AND user_uuid_with = $2", alice.ID, bob.ID).Scan(&connected); err != nil {
+		t.Fatal(err)
+	}
+	if connected != 1 {
+		t.Error("A mutual like did not connect both users")
+	}
+}
+
+func TestRecordDecisionConcurrent(t *testing.T) {
+	db := newTestDB(t)
+
+	// Two users liking each other at the same moment still match, every time
+	for i := 0; i < 10; i++ {
+		alice := db.User(t, fmt.Sprintf("alice%d", i))
+		bob := db.User(t, fmt.Sprintf("bob%d", i))
+
+		var wg sync.WaitGroup
+		mutual := make([]bool, 2)
+		errs := make([]error, 2)
+		for j, pair := range [][2]string{{alice.ID, bob.ID}, {bob.ID, alice.ID}} {
+			wg.Add(1)
+			go func(j int, of, with string) {
+				defer wg.Done()
+				mutual[j], _, errs[j] = RecordDecision(db.DB, of, with, DecisionLike)
+			}(j, pair[0], pair[1])
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if mutual[0] == mutual[1] {
+			t.Errorf("Simultaneous likes %d: got mutual %v, want exactly one match", i, mutual)
+		}
+
+		var connected, pending int
+		err := db.QueryRow(`
+			SELECT (SELECT count(*) FROM real_connections WHERE user_uuid_of IN ($1, $2) AND user_uuid_with IN ($1, $2)),
+			       (SELECT count(*) FROM pending_connections WHERE user_uuid_of IN ($1, $2) AND user_uuid_with IN ($1, $2))`,
+			alice.ID, bob.ID).Scan(&connected, &pending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if connected != 2 || pending != 0 {
+			t.Errorf("Simultaneous likes %d: got %d connections and %d requests, want 2 and 0", i, connected, pending)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"match_me_module/profile"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Lowest and highest ages accepted by the age filter
+const (
+	filterMinAge = 18
+	filterMaxAge = 120
+)
+
+func FilterAge(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body, a missing bound removes that side of the filter
+	var requestBody struct {
+		MinAge *int `json:"min_age"`
+		MaxAge *int `json:"max_age"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	for _, age := range []*int{requestBody.MinAge, requestBody.MaxAge} {
+		if age != nil && (*age < filterMinAge || *age > filterMaxAge) {
+			http.Error(w, fmt.Sprintf("Invalid age: must be between %d and %d", filterMinAge, filterMaxAge), http.StatusBadRequest)
+			return
+		}
+	}
+	if requestBody.MinAge != nil && requestBody.MaxAge != nil && *requestBody.MinAge > *requestBody.MaxAge {
+		http.Error(w, "Invalid age range: min_age is greater than max_age", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	query := `
+		INSERT INTO match_filters (user_uuid, min_age, max_age)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET min_age = EXCLUDED.min_age, max_age = EXCLUDED.max_age
+	`
+	_, err = db.Exec(query, userID, requestBody.MinAge, requestBody.MaxAge)
+	if err != nil {
+		http.Error(w, "Failed to update age filter", http.StatusInternalServerError)
+		log.Printf("Error updating age filter for user_id %s: %v", userID, err)
+		return
+	}
+
+	profileChanged(userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Age filter updated successfully"))
+}
+
+func FilterDistance(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body, a missing distance removes the filter
+	var requestBody struct {
+		MaxDistance *float64 `json:"max_distance"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	if requestBody.MaxDistance != nil && *requestBody.MaxDistance <= 0 {
+		http.Error(w, "Invalid distance: must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	query := `
+		INSERT INTO match_filters (user_uuid, max_distance_km)
+		VALUES ($1, $2)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET max_distance_km = EXCLUDED.max_distance_km
+	`
+	_, err = db.Exec(query, userID, requestBody.MaxDistance)
+	if err != nil {
+		http.Error(w, "Failed to update distance filter", http.StatusInternalServerError)
+		log.Printf("Error updating distance filter for user_id %s: %v", userID, err)
+		return
+	}
+
+	profileChanged(userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Distance filter updated successfully"))
+}
+
+func FilterHeight(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body, a missing bound removes that side of the filter
+	var requestBody struct {
+		MinHeight *int `json:"min_height"`
+		MaxHeight *int `json:"max_height"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	for _, height := range []*int{requestBody.MinHeight, requestBody.MaxHeight} {
+		if height != nil {
+			if err := profile.ValidHeight(*height); err != nil {
+				http.Error(w, "Invalid height: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if requestBody.MinHeight != nil && requestBody.MaxHeight != nil && *requestBody.MinHeight > *requestBody.MaxHeight {
+		http.Error(w, "Invalid height range: min_height is greater than max_height", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	query := `
+		INSERT INTO match_filters (user_uuid, min_height, max_height)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET min_height = EXCLUDED.min_height, max_height = EXCLUDED.max_height
+	`
+	_, err = db.Exec(query, userID, requestBody.MinHeight, requestBody.MaxHeight)
+	if err != nil {
+		http.Error(w, "Failed to update height filter", http.StatusInternalServerError)
+		log.Printf("Error updating height filter for user_id %s: %v", userID, err)
+		return
+	}
+
+	profileChanged(userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Height filter updated successfully"))
+}
+
+// FilterLanguage sets the languages of which a match must speak at least
+// one, an empty list removes the filter.
+func FilterLanguage(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Languages []string `json:"languages"`
+	}
+	saveListFilter(w, r, "languages_required", &requestBody, func() ([]string, error) {
+		return profile.Languages(requestBody.Languages)
+	})
+}
+
+// FilterGoal sets the relationship goals a match must have one of, an empty
+// list removes the filter.
+func FilterGoal(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Goals []string `json:"goals"`
+	}
+	saveListFilter(w, r, "goals_required", &requestBody, func() ([]string, error) {
+		seen := map[string]bool{}
+		goals := []string{}
+		for _, goal := range requestBody.Goals {
+			if err := profile.ValidGoal(goal); err != nil {
+				return nil, err
+			}
+			if !seen[goal] {
+				seen[goal] = true
+				goals = append(goals, goal)
+			}
+		}
+		return goals, nil
+	})
+}
+
+// saveListFilter decodes the request into body, turns it into a list of
+// codes with validate and stores them in the given match_filters column.
+func saveListFilter(w http.ResponseWriter, r *http.Request, column string, body interface{}, validate func() ([]string, error)) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	if !decodeJSON(w, r, body) {
+		return
+	}
+	codes, err := validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	var stored *string
+	if len(codes) > 0 {
+		joined := strings.Join(codes, ",")
+		stored = &joined
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO match_filters (user_uuid, %[1]s)
+		VALUES ($1, $2)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET %[1]s = EXCLUDED.%[1]s
+	`, column)
+	if _, err := db.Exec(query, userID, stored); err != nil {
+		http.Error(w, "Failed to update filter", http.StatusInternalServerError)
+		log.Printf("Error updating %s for user_id %s: %v", column, userID, err)
+		return
+	}
+
+	profileChanged(userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Filter updated successfully"))
+}
+
+func FilterFood(w http.ResponseWriter, r *http.Request) {
+	toggleFilterCode(w, r, "food")
+}
+
+func FilterHobby(w http.ResponseWriter, r *http.Request) {
+	toggleFilterCode(w, r, "hobby")
+}
+
+func FilterMusic(w http.ResponseWriter, r *http.Request) {
+	toggleFilterCode(w, r, "music")
+}
+
+// toggleFilterCode adds or removes a required or excluded preference code of
+// the given category (food, hobby or music).
+func toggleFilterCode(w http.ResponseWriter, r *http.Request, category string) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body to get the code, the mode and the remove flag
+	var requestBody struct {
+		Code   string `json:"code"`
+		Mode   string `json:"mode"`
+		Remove bool   `json:"isUnchecked"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	code := requestBody.Code
+	if code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	var other string
+	switch requestBody.Mode {
+	case "required":
+		other = "excluded"
+	case "excluded":
+		other = "required"
+	default:
+		http.Error(w, "Mode must be either required or excluded", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Make sure the code exists in the mapping table of the category
+	var exists bool
+	existsQuery := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM pref_%s WHERE %s_code = $1)", category, category)
+	if err := db.QueryRow(existsQuery, code).Scan(&exists); err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error checking %s code: %v", category, err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Unknown code", http.StatusBadRequest)
+		return
+	}
+
+	column := category + "_" + requestBody.Mode
+	otherColumn := category + "_" + other
+
+	var current, opposite sql.NullString
+	query := fmt.Sprintf("SELECT %s, %s FROM match_filters WHERE user_uuid = $1", column, otherColumn)
+	err = db.QueryRow(query, userID).Scan(&current, &opposite)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error querying database: %v", err)
+		return
+	}
+
+	codes := matching.SplitCodes(current)
+	found := false
+	var updatedCodes []string
+	for _, existingCode := range codes {
+		if existingCode == code {
+			found = true
+			if requestBody.Remove {
+				continue // Skip the code to remove it
+			}
+		}
+		updatedCodes = append(updatedCodes, existingCode)
+	}
+
+	if requestBody.Remove && !found {
+		http.Error(w, "Code not found, nothing to remove", http.StatusNotFound)
+		return
+	}
+	if !requestBody.Remove {
+		if found {
+			http.Error(w, "Code already exists", http.StatusBadRequest)
+			return
+		}
+		for _, otherCode := range matching.SplitCodes(opposite) {
+			if otherCode == code {
+				http.Error(w, "Code cannot be both required and excluded", http.StatusBadRequest)
+				return
+			}
+		}
+		updatedCodes = append(updatedCodes, code)
+	}
+
+	updateQuery := fmt.Sprintf(`
+		INSERT INTO match_filters (user_uuid, %s)
+		VALUES ($1, $2)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET %s = EXCLUDED.%s
+	`, column, column, column)
+	_, err = db.Exec(updateQuery, userID, strings.Join(updatedCodes, ","))
+	if err != nil {
+		http.Error(w, "Failed to update database", http.StatusInternalServerError)
+		log.Printf("Error updating %s: %v", column, err)
+		return
+	}
+
+	profileChanged(userID)
+
+	// Respond with success
+	w.WriteHeader(http.StatusOK)
+	if requestBody.Remove {
+		w.Write([]byte("Code removed successfully"))
+	} else {
+		w.Write([]byte("Code added successfully"))
+	}
+}
+
+func FilterGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	filters, err := matching.LoadFilters(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to query filters", http.StatusInternalServerError)
+		log.Printf("Error querying filters: %v", err)
+		return
+	}
+
+	response := struct {
+		MinAge        *int     `json:"min_age"`
+		MaxAge        *int     `json:"max_age"`
+		MaxDistanceKm *float64 `json:"max_distance"`
+		FoodRequired  []string `json:"food_required"`
+		FoodExcluded  []string `json:"food_excluded"`
+		HobbyRequired []string `json:"hobby_required"`
+		HobbyExcluded []string `json:"hobby_excluded"`
+		MusicRequired []string `json:"music_required"`
+		MusicExcluded []string `json:"music_excluded"`
+		MinHeight     *int     `json:"min_height"`
+		MaxHeight     *int     `json:"max_height"`
+		Languages     []string `json:"languages_required"`
+		Goals         []string `json:"goals_required"`
+	}{
+		MinAge:        filters.MinAge,
+		MaxAge:        filters.MaxAge,
+		MaxDistanceKm: filters.MaxDistanceKm,
+		FoodRequired:  filters.Required["food"],
+		FoodExcluded:  filters.Excluded["food"],
+		HobbyRequired: filters.Required["hobby"],
+		HobbyExcluded: filters.Excluded["hobby"],
+		MusicRequired: filters.Required["music"],
+		MusicExcluded: filters.Excluded["music"],
+		MinHeight:     filters.MinHeight,
+		MaxHeight:     filters.MaxHeight,
+		Languages:     filters.Languages,
+		Goals:         filters.Goals,
+	}
+
+	// Send the filters as JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
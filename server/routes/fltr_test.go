@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFilterAge(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, FilterAge, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/filters/age", "", nil, map[string]int{"min_age": 20}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/filters/age", alice.Token, nil, "{", http.StatusBadRequest},
+		{"too young", "PUT", "/api/v1/me/filters/age", alice.Token, nil, map[string]int{"min_age": 17}, http.StatusBadRequest},
+		{"too old", "PUT", "/api/v1/me/filters/age", alice.Token, nil, map[string]int{"max_age": 121}, http.StatusBadRequest},
+		{"reversed", "PUT", "/api/v1/me/filters/age", alice.Token, nil, map[string]int{"min_age": 40, "max_age": 30}, http.StatusBadRequest},
+		{"range", "PUT", "/api/v1/me/filters/age", alice.Token, nil, map[string]int{"min_age": 20, "max_age": 60}, http.StatusOK},
+		{"cleared", "PUT", "/api/v1/me/filters/age", alice.Token, nil, map[string]interface{}{"min_age": nil, "max_age": nil}, http.StatusOK},
+	})
+}
+
+func TestFilterDistance(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, FilterDistance, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/filters/distance", "", nil, map[string]float64{"max_distance": 50}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/filters/distance", alice.Token, nil, "{", http.StatusBadRequest},
+		{"zero", "PUT", "/api/v1/me/filters/distance", alice.Token, nil, map[string]float64{"max_distance": 0}, http.StatusBadRequest},
+		{"distance", "PUT", "/api/v1/me/filters/distance", alice.Token, nil, map[string]float64{"max_distance": 50}, http.StatusOK},
+		{"cleared", "PUT", "/api/v1/me/filters/distance", alice.Token, nil, map[string]interface{}{"max_distance": nil}, http.StatusOK},
+	})
+}
+
+func TestFilterHeight(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, FilterHeight, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/filters/height", "", nil, map[string]int{"min_height": 160}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/filters/height", alice.Token, nil, "{", http.StatusBadRequest},
+		{"too short", "PUT", "/api/v1/me/filters/height", alice.Token, nil, map[string]int{"min_height": 50}, http.StatusBadRequest},
+		{"too tall", "PUT", "/api/v1/me/filters/height", alice.Token, nil, map[string]int{"max_height": 300}, http.StatusBadRequest},
+		{"reversed", "PUT", "/api/v1/me/filters/height", alice.Token, nil, map[string]int{"min_height": 190, "max_height": 160}, http.StatusBadRequest},
+		{"range", "PUT", "/api/v1/me/filters/height", alice.Token, nil, map[string]int{"min_height": 160, "max_height": 190}, http.StatusOK},
+	})
+}
+
+func TestFilterLanguage(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, FilterLanguage, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/filters/languages", "", nil, map[string][]string{"languages": {"en"}}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/filters/languages", alice.Token, nil, "{", http.StatusBadRequest},
+		{"unknown language", "PUT", "/api/v1/me/filters/languages", alice.Token, nil, map[string][]string{"languages": {"not-a-language"}}, http.StatusBadRequest},
+		{"too many", "PUT", "/api/v1/me/filters/languages", alice.Token, nil, map[string][]string{
+			"languages": {"en", "et", "fi", "ru", "de", "fr", "es", "it", "sv", "lv", "lt"},
+		}, http.StatusBadRequest},
+		{"languages", "PUT", "/api/v1/me/filters/languages", alice.Token, nil, map[string][]string{"languages": {"en", "eng", "et"}}, http.StatusOK},
+		{"cleared", "PUT", "/api/v1/me/filters/languages", alice.Token, nil, map[string]interface{}{"languages": nil}, http.StatusOK},
+	})
+}
+
+func TestFilterGoal(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, FilterGoal, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/filters/goals", "", nil, map[string][]string{"goals": {"long_term"}}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/filters/goals", alice.Token, nil, "{", http.StatusBadRequest},
+		{"unknown goal", "PUT", "/api/v1/me/filters/goals", alice.Token, nil, map[string][]string{"goals": {"forever"}}, http.StatusBadRequest},
+		{"goals", "PUT", "/api/v1/me/filters/goals", alice.Token, nil, map[string][]string{"goals": {"long_term", "friendship"}}, http.StatusOK},
+	})
+}
+
+func TestFilterCodes(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	categories := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"food", FilterFood},
+		{"hobby", FilterHobby},
+		{"music", FilterMusic},
+	}
+	for _, category := range categories {
+		t.Run(category.name, func(t *testing.T) {
+			target := "/api/v1/me/filters/" + category.name
+			code := func(code, mode string, remove bool) map[string]interface{} {
+				return map[string]interface{}{"code": code, "mode": mode, "isUnchecked": remove}
+			}
+			runHandlerTests(t, category.handler, []handlerTest{
+				{"no token", "POST", target, "", nil, code("A1", "required", false), http.StatusUnauthorized},
+				{"invalid body", "POST", target, alice.Token, nil, "{", http.StatusBadRequest},
+				{"missing code", "POST", target, alice.Token, nil, code("", "required", false), http.StatusBadRequest},
+				{"unknown mode", "POST", target, alice.Token, nil, code("A1", "preferred", false), http.StatusBadRequest},
+				{"unknown code", "POST", target, alice.Token, nil, code("Z9", "required", false), http.StatusBadRequest},
+				{"required", "POST", target, alice.Token, nil, code("A1", "required", false), http.StatusOK},
+				{"required twice", "POST", target, alice.Token, nil, code("A1", "required", false), http.StatusBadRequest},
+				{"also excluded", "POST", target, alice.Token, nil, code("A1", "excluded", false), http.StatusBadRequest},
+				{"excluded", "POST", target, alice.Token, nil, code("A2", "excluded", false), http.StatusOK},
+				{"removed", "POST", target, alice.Token, nil, code("A1", "required", true), http.StatusOK},
+				{"removed twice", "POST", target, alice.Token, nil, code("A1", "required", true), http.StatusNotFound},
+			})
+		})
+	}
+}
+
+func TestFilterGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	serve(t, FilterAge, "PUT", "/api/v1/me/filters/age", alice.Token, nil, map[string]int{"min_age": 25, "max_age": 35})
+	serve(t, FilterLanguage, "PUT", "/api/v1/me/filters/languages", alice.Token, nil, map[string][]string{"languages": {"eng", "et"}})
+	serve(t, FilterFood, "POST", "/api/v1/me/filters/food", alice.Token, nil, map[string]string{"code": "A3", "mode": "excluded"})
+
+	runHandlerTests(t, FilterGet, []handlerTest{
+		{"no token", "GET", "/api/v1/me/filters", "", nil, nil, http.StatusUnauthorized},
+		{"filters", "GET", "/api/v1/me/filters", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var filters struct {
+		MinAge       *int     `json:"min_age"`
+		MaxAge       *int     `json:"max_age"`
+		MaxDistance  *float64 `json:"max_distance"`
+		FoodExcluded []string `json:"food_excluded"`
+		Languages    []string `json:"languages_required"`
+	}
+	decode(t, serve(t, FilterGet, "GET", "/api/v1/me/filters", alice.Token, nil, nil), &filters)
+	if filters.MinAge == nil || *filters.MinAge != 25 || filters.MaxAge == nil || *filters.MaxAge != 35 || filters.MaxDistance != nil {
+		t.Errorf("Unexpected age and distance filters: %+v", filters)
+	}
+	if len(filters.FoodExcluded) != 1 || filters.FoodExcluded[0] != "A3" {
+		t.Errorf("Food excluded: got %v", filters.FoodExcluded)
+	}
+	if len(filters.Languages) != 2 || filters.Languages[0] != "en" || filters.Languages[1] != "et" {
+		t.Errorf("Languages: got %v", filters.Languages)
+	}
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/geocode"
+	"net/http"
+	"strconv"
+)
+
+// Number of suggestions returned by the autocomplete endpoint when no limit is given
+const defaultAutocompleteLimit = 10
+
+func GeoAutocomplete(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAutocompleteLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 50 {
+			http.Error(w, "Invalid limit: must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	cities, err := geocode.Autocomplete(db, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		http.Error(w, "Failed to query cities", http.StatusInternalServerError)
+		log.Printf("Error autocompleting cities: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cities)
+}
+
+func GeoResolve(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("city")
+	if name == "" {
+		http.Error(w, "City is required", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	city, err := geocode.Resolve(db, name)
+	if err == geocode.ErrUnknownCity {
+		http.Error(w, "City not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to resolve city", http.StatusInternalServerError)
+		log.Printf("Error resolving city: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(city)
+}
+
+func GeoReverse(w http.ResponseWriter, r *http.Request) {
+	latitude, errLat := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	longitude, errLon := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+	if errLat != nil || errLon != nil || !geocode.ValidCoordinates(latitude, longitude) {
+		http.Error(w, "Invalid coordinates", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	city, err := geocode.Reverse(db, latitude, longitude)
+	if err == geocode.ErrUnknownCity {
+		http.Error(w, "City not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reverse geocode", http.StatusInternalServerError)
+		log.Printf("Error reverse geocoding: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(city)
+}
+
+// cityErrors are the messages sent back for a city the gazetteer rejects.
+var cityErrors = map[error]string{
+	geocode.ErrUnknownCity:        "Unknown city",
+	geocode.ErrInvalidCoordinates: "Invalid coordinates",
+	geocode.ErrLocationMismatch:   "Coordinates do not match the city",
+}
+
+// resolveCity checks a submitted city against the gazetteer. It returns the
+// canonical city name and the coordinates to store, which come from the
+// gazetteer when none were sent.
+func resolveCity(db *sql.DB, name string, latitude, longitude float64) (string, float64, float64, error) {
+	city, err := geocode.Validate(db, name, latitude, longitude)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if latitude == 0 && longitude == 0 {
+		latitude, longitude = city.Latitude, city.Longitude
+	}
+	return city.Name, latitude, longitude, nil
+}
+
+// validateCity is resolveCity for handlers, it writes an error response when
+// the city is rejected.
+func validateCity(w http.ResponseWriter, name string, latitude, longitude float64) (string, float64, float64, bool) {
+	city, latitude, longitude, err := resolveCity(databaseSetup.GetDB(), name, latitude, longitude)
+	if message, rejected := cityErrors[err]; rejected {
+		http.Error(w, message, http.StatusBadRequest)
+		return "", 0, 0, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to validate city", http.StatusInternalServerError)
+		log.Printf("Error validating city: %v", err)
+		return "", 0, 0, false
+	}
+	return city, latitude, longitude, true
+}
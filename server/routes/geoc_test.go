@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGeoAutocomplete(t *testing.T) {
+	newTestDB(t)
+
+	runHandlerTests(t, GeoAutocomplete, []handlerTest{
+		{"prefix", "GET", "/api/v1/cities?q=Tal", "", nil, nil, http.StatusOK},
+		{"limit", "GET", "/api/v1/cities?q=T&limit=2", "", nil, nil, http.StatusOK},
+		{"no match", "GET", "/api/v1/cities?q=Xyz", "", nil, nil, http.StatusOK},
+		{"invalid limit", "GET", "/api/v1/cities?q=Tal&limit=0", "", nil, nil, http.StatusBadRequest},
+		{"limit too high", "GET", "/api/v1/cities?q=Tal&limit=51", "", nil, nil, http.StatusBadRequest},
+	})
+
+	var cities []struct {
+		Name string `json:"name"`
+	}
+	decode(t, serve(t, GeoAutocomplete, "GET", "/api/v1/cities?q=Tal", "", nil, nil), &cities)
+	if len(cities) == 0 || cities[0].Name != "Tallinn" {
+		t.Errorf("Autocomplete of Tal: got %v", cities)
+	}
+	decode(t, serve(t, GeoAutocomplete, "GET", "/api/v1/cities?q=T&limit=2", "", nil, nil), &cities)
+	if len(cities) > 2 {
+		t.Errorf("Autocomplete with limit 2: got %d cities", len(cities))
+	}
+}
+
+func TestGeoResolve(t *testing.T) {
+	newTestDB(t)
+
+	runHandlerTests(t, GeoResolve, []handlerTest{
+		{"missing city", "GET", "/api/v1/cities/by-name", "", nil, nil, http.StatusBadRequest},
+		{"city", "GET", "/api/v1/cities/by-name?city=Tartu", "", nil, nil, http.StatusOK},
+		{"any case", "GET", "/api/v1/cities/by-name?city=tartu", "", nil, nil, http.StatusOK},
+		{"unknown city", "GET", "/api/v1/cities/by-name?city=Atlantis", "", nil, nil, http.StatusNotFound},
+	})
+}
+
+func TestGeoReverse(t *testing.T) {
+	newTestDB(t)
+
+	runHandlerTests(t, GeoReverse, []handlerTest{
+		{"missing position", "GET", "/api/v1/cities/nearest", "", nil, nil, http.StatusBadRequest},
+		{"not a number", "GET", "/api/v1/cities/nearest?lat=north&lon=24.75", "", nil, nil, http.StatusBadRequest},
+		{"out of range", "GET", "/api/v1/cities/nearest?lat=95&lon=24.75", "", nil, nil, http.StatusBadRequest},
+		{"position", "GET", "/api/v1/cities/nearest?lat=58.37&lon=26.70", "", nil, nil, http.StatusOK},
+	})
+
+	var city struct {
+		Name string `json:"name"`
+	}
+	decode(t, serve(t, GeoReverse, "GET", "/api/v1/cities/nearest?lat=58.37&lon=26.70", "", nil, nil), &city)
+	if city.Name != "Tartu" {
+		t.Errorf("Nearest city: got %q, want %q", city.Name, "Tartu")
+	}
+}
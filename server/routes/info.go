@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	databaseSetup "match_me_module/database"
 	middleware "match_me_module/middleware"
 	"net/http"
 
@@ -49,6 +50,9 @@ func UserInfo(w http.ResponseWriter, r *http.Request) {
 func fetchUserInfo(userID string) (map[string]interface{}, error) {
 	var firstName, middleName, lastName, city string
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	// Query the database for the user's information
 	err := db.QueryRow(`
 		SELECT i.first_name, i.middle_name, i.last_name, d.user_city 
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUserInfo(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, UserInfo, []handlerTest{
+		{"no token", "GET", "/api/v1/me", "", nil, nil, http.StatusUnauthorized},
+		{"invalid token", "GET", "/api/v1/me", "not-a-token", nil, nil, http.StatusUnauthorized},
+		{"own info", "GET", "/api/v1/me", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var info map[string]interface{}
+	decode(t, serve(t, UserInfo, "GET", "/api/v1/me", alice.Token, nil, nil), &info)
+	if info["user_id"] != alice.ID || info["city"] != "Tallinn" {
+		t.Errorf("Unexpected user info: %v", info)
+	}
+}
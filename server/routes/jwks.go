@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"encoding/json"
+	middleware "match_me_module/middleware"
+	"net/http"
+)
+
+// JWKS serves the public keys tokens are verified with as a JWK Set, so
+// other services can check our tokens without sharing a secret. No token is
+// needed.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Verifiers refetch it within minutes of a key being added
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(middleware.GetKeys().JWKS())
+}
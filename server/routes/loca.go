@@ -0,0 +1,227 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Positions reported with a worse accuracy than this (in meters) are rejected
+const maxBrowserAccuracy = 10000
+
+func LocationUpdate(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body for the browser geolocation
+	var requestBody struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Accuracy  float64 `json:"accuracy"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	if requestBody.Latitude < -90 || requestBody.Latitude > 90 || requestBody.Longitude < -180 || requestBody.Longitude > 180 {
+		http.Error(w, "Invalid coordinates", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Latitude == 0 && requestBody.Longitude == 0 {
+		http.Error(w, "Invalid coordinates: position is missing", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Accuracy <= 0 || requestBody.Accuracy > maxBrowserAccuracy {
+		http.Error(w, "Invalid accuracy: position is too imprecise", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Store a coarsened position so the exact whereabouts of the user are never kept
+	query := `
+		UPDATE user_data
+		SET browser_location = ST_SetSRID(ST_MakePoint($1, $2), 4326),
+		    browser_location_at = now(),
+		    browser_accuracy = $3
+		WHERE user_uuid = $4
+		RETURNING browser_location_at
+	`
+	var updatedAt time.Time
+	err = db.QueryRow(query, matching.Coarsen(requestBody.Longitude), matching.Coarsen(requestBody.Latitude),
+		requestBody.Accuracy, userID).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating browser location", http.StatusInternalServerError)
+		log.Printf("Error updating browser location for user_id %s: %v", userID, err)
+		return
+	}
+
+	profileChanged(userID)
+	// Matching falls back to the home city once the position is stale, which
+	// nothing else would notice. Rounded up to the minute so positions
+	// reported in quick succession share one job.
+	profileChangesAt(userID, updatedAt.Add(matching.BrowserLocationMaxAge).Truncate(time.Minute).Add(time.Minute))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Browser location updated successfully",
+	})
+}
+
+func LocationMode(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body for the location mode
+	var requestBody struct {
+		Mode string `json:"mode"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	if requestBody.Mode != matching.LocationModeHome && requestBody.Mode != matching.LocationModeCurrent {
+		http.Error(w, "Mode must be either home or current", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	_, err = db.Exec("UPDATE user_data SET location_mode = $1 WHERE user_uuid = $2", requestBody.Mode, userID)
+	if err != nil {
+		http.Error(w, "Error updating location mode", http.StatusInternalServerError)
+		log.Printf("Error updating location mode for user_id %s: %v", userID, err)
+		return
+	}
+
+	profileChanged(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Location mode updated successfully",
+	})
+}
+
+func LocationGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	var mode sql.NullString
+	var updatedAt sql.NullTime
+	var accuracy sql.NullFloat64
+	query := "SELECT location_mode, browser_location_at, browser_accuracy FROM user_data WHERE user_uuid = $1"
+	err = db.QueryRow(query, userID).Scan(&mode, &updatedAt, &accuracy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to query location", http.StatusInternalServerError)
+			log.Printf("Error querying location for user_id %s: %v", userID, err)
+		}
+		return
+	}
+
+	if !mode.Valid {
+		mode.String = matching.LocationModeHome
+	}
+
+	response := struct {
+		Mode       string     `json:"mode"`
+		UpdatedAt  *time.Time `json:"browser_location_at"`
+		Accuracy   *float64   `json:"browser_accuracy"`
+		Stale      bool       `json:"stale"`
+		MatchingBy string     `json:"matching_by"`
+	}{Mode: mode.String, MatchingBy: matching.LocationModeHome, Stale: true}
+
+	if updatedAt.Valid {
+		response.UpdatedAt = &updatedAt.Time
+		response.Stale = time.Since(updatedAt.Time) > matching.BrowserLocationMaxAge
+	}
+	if accuracy.Valid {
+		response.Accuracy = &accuracy.Float64
+	}
+	if mode.String == matching.LocationModeCurrent && !response.Stale {
+		response.MatchingBy = matching.LocationModeCurrent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
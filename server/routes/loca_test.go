@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLocationUpdate(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	position := func(latitude, longitude, accuracy float64) map[string]float64 {
+		return map[string]float64{"latitude": latitude, "longitude": longitude, "accuracy": accuracy}
+	}
+
+	runHandlerTests(t, LocationUpdate, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/location", "", nil, position(58.38, 26.72, 50), http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/location", alice.Token, nil, "{", http.StatusBadRequest},
+		{"out of range", "PUT", "/api/v1/me/location", alice.Token, nil, position(91, 26.72, 50), http.StatusBadRequest},
+		{"missing position", "PUT", "/api/v1/me/location", alice.Token, nil, position(0, 0, 50), http.StatusBadRequest},
+		{"missing accuracy", "PUT", "/api/v1/me/location", alice.Token, nil, position(58.38, 26.72, 0), http.StatusBadRequest},
+		{"imprecise", "PUT", "/api/v1/me/location", alice.Token, nil, position(58.38, 26.72, 20000), http.StatusBadRequest},
+		{"updated", "PUT", "/api/v1/me/location", alice.Token, nil, position(58.3806, 26.7251, 50), http.StatusOK},
+	})
+
+	// Only a coarsened position is kept
+	var latitude, longitude float64
+	err := db.QueryRow("SELECT ST_Y(browser_location::geometry), ST_X(browser_location::geometry) FROM user_data WHERE user_uuid = $1", alice.ID).
+		Scan(&latitude, &longitude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latitude != 58.38 || longitude != 26.73 {
+		t.Errorf("Stored position: got %v, %v", latitude, longitude)
+	}
+
+	// Recommendations are updated now and again once the position is stale
+	var due, delayed int
+	err = db.QueryRow(`
+		SELECT count(*) FILTER (WHERE run_at <= now()),
+		       count(*) FILTER (WHERE run_at >= browser_location_at + interval '24 hours')
+		FROM jobs JOIN user_data d ON d.user_uuid = jobs.user_uuid
+		WHERE jobs.user_uuid = $1 AND kind = 'profile_changed' AND status = 'pending'`, alice.ID).Scan(&due, &delayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due != 1 || delayed != 1 {
+		t.Errorf("Queued recomputations: got %d due and %d delayed, want 1 and 1", due, delayed)
+	}
+}
+
+func TestLocationMode(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, LocationMode, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/location/mode", "", nil, map[string]string{"mode": "current"}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/location/mode", alice.Token, nil, "{", http.StatusBadRequest},
+		{"unknown mode", "PUT", "/api/v1/me/location/mode", alice.Token, nil, map[string]string{"mode": "work"}, http.StatusBadRequest},
+		{"current", "PUT", "/api/v1/me/location/mode", alice.Token, nil, map[string]string{"mode": "current"}, http.StatusOK},
+		{"home", "PUT", "/api/v1/me/location/mode", alice.Token, nil, map[string]string{"mode": "home"}, http.StatusOK},
+	})
+}
+
+func TestLocationGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	db.Location(t, bob, 58.38, 26.72)
+
+	runHandlerTests(t, LocationGet, []handlerTest{
+		{"no token", "GET", "/api/v1/me/location", "", nil, nil, http.StatusUnauthorized},
+		{"location", "GET", "/api/v1/me/location", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var location struct {
+		Mode       string `json:"mode"`
+		Stale      bool   `json:"stale"`
+		MatchingBy string `json:"matching_by"`
+	}
+	// Without a browser position the home is used
+	decode(t, serve(t, LocationGet, "GET", "/api/v1/me/location", alice.Token, nil, nil), &location)
+	if location.Mode != "home" || !location.Stale || location.MatchingBy != "home" {
+		t.Errorf("Location without a position: %+v", location)
+	}
+	decode(t, serve(t, LocationGet, "GET", "/api/v1/me/location", bob.Token, nil, nil), &location)
+	if location.Mode != "current" || location.Stale || location.MatchingBy != "current" {
+		t.Errorf("Location with a fresh position: %+v", location)
+	}
+}
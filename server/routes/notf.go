@@ -0,0 +1,300 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	middleware "match_me_module/middleware"
+	"match_me_module/notify"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Largest page of notifications returned at once
+const maxNotificationPage = 100
+
+// Where notifications are sent, set by main on startup
+var (
+	notifications *notify.Center
+	notifyHub     *notify.Hub
+)
+
+// SetNotifications sets the notification center and the hub holding the
+// WebSocket connections its push channel writes to.
+func SetNotifications(center *notify.Center, hub *notify.Hub) {
+	notifications, notifyHub = center, hub
+}
+
+// notifyUser sends a notification in the background, failures are logged
+// and do not fail the request that caused it.
+func notifyUser(kind, userID, actorID string, payload map[string]interface{}) {
+	if notifications == nil {
+		return
+	}
+	go func() {
+		n := notify.Notification{UserID: userID, Kind: kind, ActorID: actorID, Payload: payload}
+		if err := notifications.Send(databaseSetup.GetDB(), n); err != nil {
+			log.Printf("Error sending %s notification to user_id %s: %v", kind, userID, err)
+		}
+	}()
+}
+
+// Browsers cannot set headers on a WebSocket handshake, so the token comes
+// in the query string or the cookie and the origin is checked like CORS would.
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || middleware.OriginAllowed(origin)
+	},
+}
+
+func NotificationList(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Pages go backwards from the id in before, the newest come first
+	query := r.URL.Query()
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxNotificationPage {
+			http.Error(w, fmt.Sprintf("Invalid limit: must be between 1 and %d", maxNotificationPage), http.StatusBadRequest)
+			return
+		}
+	}
+	var before int64
+	if value := query.Get("before"); value != "" {
+		before, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || before < 1 {
+			http.Error(w, "Invalid before id", http.StatusBadRequest)
+			return
+		}
+	}
+	unreadOnly := query.Get("unread") == "true"
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	list, err := notify.List(db, userID, unreadOnly, before, limit)
+	if err != nil {
+		http.Error(w, "Failed to query notifications", http.StatusInternalServerError)
+		log.Printf("Error listing notifications of user_id %s: %v", userID, err)
+		return
+	}
+	unread, err := notify.UnreadCount(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to query notifications", http.StatusInternalServerError)
+		log.Printf("Error counting notifications of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": list,
+		"unread":        unread,
+	})
+}
+
+// NotificationRead marks the given notifications as read, or all of them
+// when no ids are sent.
+func NotificationRead(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	var requestBody struct {
+		IDs []int64 `json:"ids"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	if len(requestBody.IDs) > maxNotificationPage {
+		http.Error(w, fmt.Sprintf("At most %d ids can be marked at once", maxNotificationPage), http.StatusBadRequest)
+		return
+	}
+
+	marked, err := notify.MarkRead(databaseSetup.GetDB(), userID, requestBody.IDs, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to update notifications", http.StatusInternalServerError)
+		log.Printf("Error marking notifications of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"marked": marked,
+	})
+}
+
+func NotificationPrefsGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	prefs, err := notify.LoadPreferences(databaseSetup.GetDB(), userID)
+	if err != nil {
+		http.Error(w, "Failed to query notification preferences", http.StatusInternalServerError)
+		log.Printf("Error loading notification preferences of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// NotificationPrefs changes channels of one or more kinds, for example
+// {"match": {"email": false}}. Channels left out keep their setting.
+func NotificationPrefs(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	var changes notify.Preferences
+	if !decodeJSON(w, r, &changes) {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	prefs, err := notify.LoadPreferences(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to query notification preferences", http.StatusInternalServerError)
+		log.Printf("Error loading notification preferences of user_id %s: %v", userID, err)
+		return
+	}
+	for kind, channels := range changes {
+		if _, known := prefs[kind]; !known {
+			http.Error(w, "Unknown notification kind: "+kind, http.StatusBadRequest)
+			return
+		}
+		for channel, enabled := range channels {
+			if _, known := prefs[kind][channel]; !known {
+				http.Error(w, "Unknown notification channel: "+channel, http.StatusBadRequest)
+				return
+			}
+			prefs[kind][channel] = enabled
+		}
+	}
+
+	for kind := range changes {
+		if err := notify.SavePreferences(db, userID, kind, prefs[kind]); err != nil {
+			http.Error(w, "Failed to save notification preferences", http.StatusInternalServerError)
+			log.Printf("Error saving notification preferences of user_id %s: %v", userID, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// NotificationSocket upgrades to a WebSocket that receives every notification
+// with the push channel enabled as a JSON message. Browsers cannot send an
+// Authorization header here, they send the token cookie or pass a stream
+// ticket as ?ticket=.
+func NotificationSocket(w http.ResponseWriter, r *http.Request) {
+	if notifyHub == nil {
+		http.Error(w, "Push notifications are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, _, err := streamUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// The upgrader writes the error response itself
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading notification socket of user_id %s: %v", userID, err)
+		return
+	}
+	notifyHub.Serve(conn, userID)
+}
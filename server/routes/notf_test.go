@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"match_me_module/notify"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// notifyFixture stores in-app notifications for the user, the oldest first.
+func notifyFixture(t *testing.T, db *sql.DB, userID, actorID string, kinds ...string) []int64 {
+	t.Helper()
+	var ids []int64
+	for _, kind := range kinds {
+		n := notify.Notification{UserID: userID, Kind: kind, ActorID: actorID, CreatedAt: time.Now()}
+		if err := (notify.InApp{}).Notify(db, &n); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+type notificationPage struct {
+	Notifications []notify.Notification `json:"notifications"`
+	Unread        int                   `json:"unread"`
+}
+
+func TestNotificationList(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	ids := notifyFixture(t, db.DB, alice.ID, bob.ID, notify.KindConnectionRequest, notify.KindMatch, notify.KindMessage)
+
+	runHandlerTests(t, NotificationList, []handlerTest{
+		{"no token", "GET", "/api/v1/notifications", "", nil, nil, http.StatusUnauthorized},
+		{"limit too small", "GET", "/api/v1/notifications?limit=0", alice.Token, nil, nil, http.StatusBadRequest},
+		{"limit too large", "GET", "/api/v1/notifications?limit=101", alice.Token, nil, nil, http.StatusBadRequest},
+		{"invalid before", "GET", "/api/v1/notifications?before=0", alice.Token, nil, nil, http.StatusBadRequest},
+		{"notifications", "GET", "/api/v1/notifications", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	// The newest come first and before pages backwards
+	var page notificationPage
+	decode(t, serve(t, NotificationList, "GET", "/api/v1/notifications?limit=2", alice.Token, nil, nil), &page)
+	if len(page.Notifications) != 2 || page.Notifications[0].ID != ids[2] || page.Unread != 3 {
+		t.Errorf("First page: got %+v", page)
+	}
+	page = notificationPage{}
+	decode(t, serve(t, NotificationList, "GET", fmt.Sprintf("/api/v1/notifications?before=%d", ids[1]), alice.Token, nil, nil), &page)
+	if len(page.Notifications) != 1 || page.Notifications[0].ID != ids[0] {
+		t.Errorf("Page before %d: got %+v", ids[1], page)
+	}
+
+	// Nobody sees the notifications of others
+	page = notificationPage{}
+	decode(t, serve(t, NotificationList, "GET", "/api/v1/notifications", bob.Token, nil, nil), &page)
+	if len(page.Notifications) != 0 || page.Unread != 0 {
+		t.Errorf("Notifications of bob: got %+v", page)
+	}
+}
+
+func TestNotificationRead(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	ids := notifyFixture(t, db.DB, alice.ID, bob.ID, notify.KindConnectionRequest, notify.KindMatch, notify.KindMessage)
+
+	tooMany := make([]int64, 101)
+	runHandlerTests(t, NotificationRead, []handlerTest{
+		{"no token", "POST", "/api/v1/notifications/read", "", nil, map[string][]int64{"ids": ids[:1]}, http.StatusUnauthorized},
+		{"invalid body", "POST", "/api/v1/notifications/read", alice.Token, nil, "{", http.StatusBadRequest},
+		{"too many ids", "POST", "/api/v1/notifications/read", alice.Token, nil, map[string][]int64{"ids": tooMany}, http.StatusBadRequest},
+		{"someone else's", "POST", "/api/v1/notifications/read", bob.Token, nil, map[string][]int64{"ids": ids[:1]}, http.StatusOK},
+		{"one read", "POST", "/api/v1/notifications/read", alice.Token, nil, map[string][]int64{"ids": ids[:1]}, http.StatusOK},
+	})
+
+	var page notificationPage
+	decode(t, serve(t, NotificationList, "GET", "/api/v1/notifications?unread=true", alice.Token, nil, nil), &page)
+	if len(page.Notifications) != 2 || page.Unread != 2 {
+		t.Errorf("Unread after reading one: got %+v", page)
+	}
+
+	// No ids marks everything
+	var marked struct {
+		Marked int64 `json:"marked"`
+	}
+	decode(t, serve(t, NotificationRead, "POST", "/api/v1/notifications/read", alice.Token, nil, map[string][]int64{"ids": {}}), &marked)
+	if marked.Marked != 2 {
+		t.Errorf("Marked all: got %d, want 2", marked.Marked)
+	}
+}
+
+func TestNotificationPrefs(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, NotificationPrefs, []handlerTest{
+		{"no token", "PUT", "/api/v1/notifications/preferences", "", nil, notify.Preferences{notify.KindMatch: {notify.ChannelEmail: false}}, http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/notifications/preferences", alice.Token, nil, "{", http.StatusBadRequest},
+		{"unknown kind", "PUT", "/api/v1/notifications/preferences", alice.Token, nil, notify.Preferences{"wink": {notify.ChannelEmail: false}}, http.StatusBadRequest},
+		{"unknown channel", "PUT", "/api/v1/notifications/preferences", alice.Token, nil, notify.Preferences{notify.KindMatch: {"sms": false}}, http.StatusBadRequest},
+		{"saved", "PUT", "/api/v1/notifications/preferences", alice.Token, nil, notify.Preferences{notify.KindMatch: {notify.ChannelEmail: false}}, http.StatusOK},
+	})
+
+	// Channels left out keep their setting
+	var prefs notify.Preferences
+	decode(t, serve(t, NotificationPrefsGet, "GET", "/api/v1/notifications/preferences", alice.Token, nil, nil), &prefs)
+	if prefs[notify.KindMatch][notify.ChannelEmail] || !prefs[notify.KindMatch][notify.ChannelInApp] {
+		t.Errorf("Match preferences: got %v", prefs[notify.KindMatch])
+	}
+	if !prefs[notify.KindMessage][notify.ChannelEmail] {
+		t.Errorf("Message preferences changed: got %v", prefs[notify.KindMessage])
+	}
+}
+
+func TestNotificationSocket(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	// Without a hub there is nothing to push to
+	recorder := serve(t, NotificationSocket, "GET", "/api/v1/notifications/ws", alice.Token, nil, nil)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Socket without a hub: got status %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
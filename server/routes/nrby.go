@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Limits for the nearby search, radius in kilometres
+const (
+	defaultNearbyRadius = 50
+	maxNearbyRadius     = 500
+	defaultNearbyLimit  = 20
+	maxNearbyLimit      = 50
+)
+
+// nearbyCursor points just after the last user of a page in (distance_km,
+// user_uuid) order. It only holds the rounded distance the client was shown
+// anyway, never the exact one.
+type nearbyCursor struct {
+	DistanceKm int
+	UserID     string
+}
+
+func encodeNearbyCursor(c nearbyCursor) string {
+	raw := strconv.Itoa(c.DistanceKm) + "|" + c.UserID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeNearbyCursor(s string) (*nearbyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	distance, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return nil, err
+	}
+	return &nearbyCursor{DistanceKm: distance, UserID: parts[1]}, nil
+}
+
+func Nearby(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the query parameters
+	params := r.URL.Query()
+
+	radius := float64(defaultNearbyRadius)
+	if raw := params.Get("radius"); raw != "" {
+		radius, err = strconv.ParseFloat(raw, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			http.Error(w, fmt.Sprintf("Invalid radius: must be between 0 and %d km", maxNearbyRadius), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultNearbyLimit
+	if raw := params.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxNearbyLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit: must be between 1 and %d", maxNearbyLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var cursor *nearbyCursor
+	if raw := params.Get("cursor"); raw != "" {
+		cursor, err = decodeNearbyCursor(raw)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	filters, err := matching.LoadFilters(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to query filters", http.StatusInternalServerError)
+		log.Printf("Error querying filters for user_id %s: %v", userID, err)
+		return
+	}
+
+	// The caller's own distance filter narrows the search radius
+	if filters.MaxDistanceKm != nil && *filters.MaxDistanceKm < radius {
+		radius = *filters.MaxDistanceKm
+	}
+
+	var cursorDistance *int
+	var cursorUserID *string
+	if cursor != nil {
+		cursorDistance, cursorUserID = &cursor.DistanceKm, &cursor.UserID
+	}
+
+	args := []interface{}{userID, radius * 1000, filters.MinAge, filters.MaxAge, cursorDistance, cursorUserID, limit + 1}
+	prefClause, prefArgs := matching.PreferenceFilterSQL(filters, "p", len(args)+1)
+	args = append(args, prefArgs...)
+
+	// Candidates are placed where they are matched, by their browser position
+	// when they chose it. That CASE cannot be indexed, so the GiST indexes on
+	// both columns first narrow the rows to users with either position in the
+	// radius and the matched location is checked on those. The distance of
+	// every candidate in the radius is then computed and sorted on each page,
+	// the radius keeps that set small. Only whole kilometres are shown so
+	// exact positions cannot be triangulated, and pages are ordered by them
+	// so the cursor does not give them away either.
+	query := fmt.Sprintf(`
+		SELECT user_uuid, username, first_name, user_city, distance_km
+		FROM (
+			SELECT d.user_uuid, i.username, i.first_name, d.user_city,
+			       greatest(1, round(ST_Distance(%[2]s, me.location) / 1000))::int AS distance_km
+			FROM user_data d
+			JOIN user_info i ON i.user_uuid = d.user_uuid
+			JOIN profile_info p ON p.user_uuid = d.user_uuid
+			CROSS JOIN (SELECT %[1]s AS location FROM user_data m WHERE m.user_uuid = $1) me
+			WHERE d.user_uuid <> $1
+			  AND (ST_DWithin(d.register_location, me.location, $2) OR ST_DWithin(d.browser_location, me.location, $2))
+			  AND ST_DWithin(%[2]s, me.location, $2)
+			  AND ($3::int IS NULL OR %[3]s >= $3)
+			  AND ($4::int IS NULL OR %[3]s <= $4)
+			  AND coalesce(p.completeness, 0) >= %[4]d
+			  AND %[5]s
+			  AND %[6]s
+			  AND %[7]s
+		) nearby
+		WHERE $5::int IS NULL OR (distance_km, user_uuid) > ($5, $6::uuid)
+		ORDER BY distance_km, user_uuid
+		LIMIT $7`, matching.LocationSQL("m"), matching.LocationSQL("d"), matching.AgeSQL("i.birthdate"), matching.MatchableCompleteness,
+		matching.NotBlockedSQL("$1::uuid", "d.user_uuid"), matching.ActiveAccountSQL("d.user_uuid"), prefClause)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query nearby users", http.StatusInternalServerError)
+		log.Printf("Error querying nearby users for user_id %s: %v", userID, err)
+		return
+	}
+	defer rows.Close()
+
+	type nearbyUser struct {
+		UserID     string `json:"user_id"`
+		Username   string `json:"username"`
+		FirstName  string `json:"first_name"`
+		City       string `json:"city"`
+		DistanceKm int    `json:"distance_km"`
+	}
+	users := []nearbyUser{}
+	for rows.Next() {
+		var u nearbyUser
+		if err := rows.Scan(&u.UserID, &u.Username, &u.FirstName, &u.City, &u.DistanceKm); err != nil {
+			http.Error(w, "Failed to read nearby users", http.StatusInternalServerError)
+			log.Printf("Error scanning nearby user: %v", err)
+			return
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read nearby users", http.StatusInternalServerError)
+		log.Printf("Error reading nearby users: %v", err)
+		return
+	}
+
+	// One extra row was fetched to know whether another page exists
+	var nextCursor *string
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		encoded := encodeNearbyCursor(nearbyCursor{DistanceKm: last.DistanceKm, UserID: last.UserID})
+		nextCursor = &encoded
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":       users,
+		"radius_km":   radius,
+		"next_cursor": nextCursor,
+	})
+}
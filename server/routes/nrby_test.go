@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNearby(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	carol := db.User(t, "carol")
+	dave := db.User(t, "dave")
+	db.Home(t, dave, "Tartu")
+	// Only complete profiles are shown
+	if _, err := db.Exec("UPDATE profile_info SET completeness = 100 WHERE user_uuid <> $1", alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	runHandlerTests(t, Nearby, []handlerTest{
+		{"no token", "GET", "/api/v1/users/nearby", "", nil, nil, http.StatusUnauthorized},
+		{"radius zero", "GET", "/api/v1/users/nearby?radius=0", alice.Token, nil, nil, http.StatusBadRequest},
+		{"radius too large", "GET", "/api/v1/users/nearby?radius=501", alice.Token, nil, nil, http.StatusBadRequest},
+		{"limit too small", "GET", "/api/v1/users/nearby?limit=0", alice.Token, nil, nil, http.StatusBadRequest},
+		{"limit too large", "GET", "/api/v1/users/nearby?limit=51", alice.Token, nil, nil, http.StatusBadRequest},
+		{"invalid cursor", "GET", "/api/v1/users/nearby?cursor=abc", alice.Token, nil, nil, http.StatusBadRequest},
+		{"nearby", "GET", "/api/v1/users/nearby", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	type page struct {
+		Users []struct {
+			UserID string `json:"user_id"`
+		} `json:"users"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
+	// Tartu is out of the default radius of Tallinn
+	var nearby page
+	decode(t, serve(t, Nearby, "GET", "/api/v1/users/nearby", alice.Token, nil, nil), &nearby)
+	if len(nearby.Users) != 2 {
+		t.Errorf("Nearby users: got %+v, want bob and carol", nearby)
+	}
+
+	// Paging through a larger radius returns everybody exactly once
+	seen := map[string]bool{}
+	target := "/api/v1/users/nearby?radius=500&limit=1"
+	for pages := 0; pages < 5; pages++ {
+		var p page
+		decode(t, serve(t, Nearby, "GET", target, alice.Token, nil, nil), &p)
+		for _, u := range p.Users {
+			if seen[u.UserID] {
+				t.Errorf("User %s returned twice", u.UserID)
+			}
+			seen[u.UserID] = true
+		}
+		if p.NextCursor == nil {
+			break
+		}
+		// The cursor holds the rounded distance that was shown, not the exact one
+		raw, _ := base64.RawURLEncoding.DecodeString(*p.NextCursor)
+		if _, err := strconv.Atoi(strings.SplitN(string(raw), "|", 2)[0]); err != nil {
+			t.Errorf("Cursor %q holds more than whole kilometres: %s", *p.NextCursor, raw)
+		}
+		target = "/api/v1/users/nearby?radius=500&limit=1&cursor=" + *p.NextCursor
+	}
+	for _, u := range []string{bob.ID, carol.ID, dave.ID} {
+		if !seen[u] {
+			t.Errorf("User %s was not paged through", u)
+		}
+	}
+	if seen[alice.ID] {
+		t.Error("The caller is listed as nearby")
+	}
+
+	// A user matched by their browser position is found there, not at home
+	db.Location(t, dave, 59.437, 24.7536)
+	db.Location(t, carol, 58.378, 26.729)
+	decode(t, serve(t, Nearby, "GET", "/api/v1/users/nearby", alice.Token, nil, nil), &nearby)
+	found := map[string]bool{}
+	for _, u := range nearby.Users {
+		found[u.UserID] = true
+	}
+	if !found[dave.ID] || found[carol.ID] || !found[bob.ID] {
+		t.Errorf("Nearby by browser position: got %+v, want bob and dave", nearby)
+	}
+}
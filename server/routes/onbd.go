@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Onboarding tells the user how complete their profile is and which steps
+// are left before it is recommended to others.
+func Onboarding(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Computed live, the stored score may lag behind by a job
+	completeness, err := matching.LoadCompleteness(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		log.Printf("Error loading completeness: %v", err)
+		return
+	}
+
+	response := struct {
+		matching.Completeness
+		Threshold int  `json:"matchable_threshold"`
+		Matchable bool `json:"matchable"`
+	}{
+		Completeness: completeness,
+		Threshold:    matching.MatchableCompleteness,
+		Matchable:    completeness.Score >= matching.MatchableCompleteness,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"match_me_module/testdb"
+	"net/http"
+	"testing"
+)
+
+func TestOnboarding(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, Onboarding, []handlerTest{
+		{"no token", "GET", "/api/v1/me/onboarding", "", nil, nil, http.StatusUnauthorized},
+		{"progress", "GET", "/api/v1/me/onboarding", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var progress struct {
+		Completeness int  `json:"completeness"`
+		Matchable    bool `json:"matchable"`
+	}
+	// Registering sets the city and the birthdate
+	decode(t, serve(t, Onboarding, "GET", "/api/v1/me/onboarding", alice.Token, nil, nil), &progress)
+	if progress.Completeness != 30 || progress.Matchable {
+		t.Errorf("Fresh profile: got completeness %d, matchable %v", progress.Completeness, progress.Matchable)
+	}
+
+	db.Preferences(t, alice, "food", "A1")
+	db.Preferences(t, alice, "hobby", "A1", "B2")
+	db.Preferences(t, alice, "music", "C1")
+	db.Weights(t, alice, testdb.Weights{Distance: 2, Age: 1, Food: 1, Hobbies: 1, Music: 1})
+	decode(t, serve(t, Onboarding, "GET", "/api/v1/me/onboarding", alice.Token, nil, nil), &progress)
+	if progress.Completeness != 65 || progress.Matchable {
+		t.Errorf("Profile with preferences and weights: got completeness %d, matchable %v", progress.Completeness, progress.Matchable)
+	}
+}
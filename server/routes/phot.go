@@ -0,0 +1,641 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"match_me_module/photo"
+	"match_me_module/storage"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Most photos a user can have
+const maxPhotos = 6
+
+// blobStore holds the photo files, it is set on startup by SetBlobStore.
+var blobStore storage.BlobStore
+
+// SetBlobStore sets where uploaded photos are stored.
+func SetBlobStore(s storage.BlobStore) {
+	blobStore = s
+}
+
+// photoKey is the blob key of one size of a photo.
+func photoKey(userID, photoID, size, extension string) string {
+	return fmt.Sprintf("photos/%s/%s/%s.%s", userID, photoID, size, extension)
+}
+
+// deletePhotoBlobs removes every size of a photo, failures only leave unreachable files behind and are logged.
+func deletePhotoBlobs(userID, photoID, extension string) {
+	for size := range photo.Sizes {
+		if err := blobStore.Delete(photoKey(userID, photoID, size, extension)); err != nil {
+			log.Printf("Error deleting %s photo %s of user_id %s: %v", size, photoID, userID, err)
+		}
+	}
+}
+
+type photoInfo struct {
+	ID          string            `json:"id"`
+	Position    int               `json:"position"`
+	Primary     bool              `json:"primary"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	URLs        map[string]string `json:"urls"`
+}
+
+// listPhotos returns the photos of a user in display order.
+func listPhotos(db *sql.DB, userID string) ([]photoInfo, error) {
+	rows, err := db.Query(`
+		SELECT photo_uuid, position, is_primary, content_type, width, height
+		FROM photos WHERE user_uuid = $1
+		ORDER BY position, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []photoInfo{}
+	for rows.Next() {
+		var p photoInfo
+		if err := rows.Scan(&p.ID, &p.Position, &p.Primary, &p.ContentType, &p.Width, &p.Height); err != nil {
+			return nil, err
+		}
+		p.URLs = map[string]string{}
+		for size := range photo.Sizes {
+			p.URLs[size] = "/api/v1/photos/" + p.ID + "/" + size
+		}
+		photos = append(photos, p)
+	}
+	return photos, rows.Err()
+}
+
+// insertPhoto saves the row of an uploaded photo unless the user already has
+// maxPhotos. The user's row is locked so concurrent uploads are counted and
+// numbered one after the other. New photos go last, the first one becomes the
+// primary photo.
+func insertPhoto(db *sql.DB, userID, photoID string, processed photo.Processed) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT 1 FROM user_table WHERE user_uuid = $1 FOR UPDATE", userID); err != nil {
+		return false, fmt.Errorf("error locking user: %v", err)
+	}
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM photos WHERE user_uuid = $1", userID).Scan(&count); err != nil {
+		return false, fmt.Errorf("error counting photos: %v", err)
+	}
+	if count >= maxPhotos {
+		return false, nil
+	}
+
+	full := processed.Variants["full"]
+	_, err = tx.Exec(`
+		INSERT INTO photos (photo_uuid, user_uuid, position, is_primary, content_type, extension, width, height, datetime_created)
+		SELECT $1, $2, coalesce(max(position), 0) + 1, count(*) = 0, $3, $4, $5, $6, $7
+		FROM photos WHERE user_uuid = $2`,
+		photoID, userID, processed.ContentType, processed.Extension, full.Width, full.Height, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// canSeePhotos reports whether the viewer may see the owner's photos: their
+// own, or those of an active user neither of them blocked.
+func canSeePhotos(db *sql.DB, viewerID, ownerID string) (bool, error) {
+	if viewerID == ownerID {
+		return true, nil
+	}
+	var visible bool
+	query := fmt.Sprintf("SELECT %s AND %s", matching.NotBlockedSQL("$1::uuid", "$2::uuid"), matching.ActiveAccountSQL("$2::uuid"))
+	err := db.QueryRow(query, viewerID, ownerID).Scan(&visible)
+	return visible, err
+}
+
+func PhotoUpload(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Leave some room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, photo.MaxUploadBytes+64<<10)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Photo must be at most %d MB", photo.MaxUploadBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		http.Error(w, "Missing photo file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, photo.MaxUploadBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read photo", http.StatusBadRequest)
+		log.Printf("Error reading upload of user_id %s: %v", userID, err)
+		return
+	}
+	if len(data) > photo.MaxUploadBytes {
+		http.Error(w, fmt.Sprintf("Photo must be at most %d MB", photo.MaxUploadBytes>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Checked early to spare processing, and again when the row is saved
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM photos WHERE user_uuid = $1", userID).Scan(&count); err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error counting photos of user_id %s: %v", userID, err)
+		return
+	}
+	if count >= maxPhotos {
+		http.Error(w, fmt.Sprintf("A profile can have at most %d photos", maxPhotos), http.StatusConflict)
+		return
+	}
+
+	processed, err := photo.Process(data)
+	switch {
+	case errors.Is(err, photo.ErrUnsupportedType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, photo.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, photo.ErrTooSmall):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to process photo", http.StatusBadRequest)
+		log.Printf("Error processing upload of user_id %s: %v", userID, err)
+		return
+	}
+
+	// Files go first, a row never points at a missing file
+	photoID := uuid.New().String()
+	for size, variant := range processed.Variants {
+		if err := blobStore.Put(photoKey(userID, photoID, size, processed.Extension), processed.ContentType, variant.Data); err != nil {
+			deletePhotoBlobs(userID, photoID, processed.Extension)
+			http.Error(w, "Failed to store photo", http.StatusInternalServerError)
+			log.Printf("Error storing photo of user_id %s: %v", userID, err)
+			return
+		}
+	}
+
+	saved, err := insertPhoto(db, userID, photoID, processed)
+	if err != nil || !saved {
+		deletePhotoBlobs(userID, photoID, processed.Extension)
+	}
+	if err != nil {
+		http.Error(w, "Failed to save photo", http.StatusInternalServerError)
+		log.Printf("Error saving photo of user_id %s: %v", userID, err)
+		return
+	}
+	if !saved {
+		http.Error(w, fmt.Sprintf("A profile can have at most %d photos", maxPhotos), http.StatusConflict)
+		return
+	}
+
+	// Photos count towards profile completeness
+	profileChanged(userID)
+
+	photos, err := listPhotos(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to list photos", http.StatusInternalServerError)
+		log.Printf("Error listing photos of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     photoID,
+		"photos": photos,
+	})
+}
+
+func PhotoList(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Another user's photos when the path names one, otherwise the caller's own
+	ownerID := userID
+	if other, ok := mux.Vars(r)["uuid"]; ok {
+		if _, err := uuid.Parse(other); err != nil {
+			http.Error(w, "Invalid user id", http.StatusBadRequest)
+			return
+		}
+		ownerID = other
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	visible, err := canSeePhotos(db, userID, ownerID)
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error checking photo access of user_id %s to %s: %v", userID, ownerID, err)
+		return
+	}
+	if !visible {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	photos, err := listPhotos(db, ownerID)
+	if err != nil {
+		http.Error(w, "Failed to list photos", http.StatusInternalServerError)
+		log.Printf("Error listing photos of %s: %v", ownerID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(photos)
+}
+
+func PhotoGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	photoID, size := mux.Vars(r)["id"], mux.Vars(r)["size"]
+	if _, err := uuid.Parse(photoID); err != nil {
+		http.Error(w, "Invalid photo id", http.StatusBadRequest)
+		return
+	}
+	if _, ok := photo.Sizes[size]; !ok {
+		http.Error(w, "Size must be full or thumb", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	var ownerID, contentType, extension string
+	err = db.QueryRow("SELECT user_uuid, content_type, extension FROM photos WHERE photo_uuid = $1", photoID).
+		Scan(&ownerID, &contentType, &extension)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error reading photo %s: %v", photoID, err)
+		return
+	}
+
+	visible, err := canSeePhotos(db, userID, ownerID)
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error checking photo access of user_id %s to %s: %v", userID, ownerID, err)
+		return
+	}
+	if !visible {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+
+	blob, err := blobStore.Get(photoKey(ownerID, photoID, size, extension))
+	if err == storage.ErrNotFound {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read photo", http.StatusInternalServerError)
+		log.Printf("Error reading %s photo %s: %v", size, photoID, err)
+		return
+	}
+	defer blob.Close()
+
+	// Photo ids never change content, so clients may keep them
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("Error sending photo %s: %v", photoID, err)
+	}
+}
+
+func PhotoPrimary(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	photoID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(photoID); err != nil {
+		http.Error(w, "Invalid photo id", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Only one photo per user can be primary
+	if _, err := tx.Exec("UPDATE photos SET is_primary = false WHERE user_uuid = $1 AND is_primary", userID); err != nil {
+		http.Error(w, "Failed to update photos", http.StatusInternalServerError)
+		log.Printf("Error clearing primary photo of user_id %s: %v", userID, err)
+		return
+	}
+	result, err := tx.Exec("UPDATE photos SET is_primary = true WHERE photo_uuid = $1 AND user_uuid = $2", photoID, userID)
+	if err != nil {
+		http.Error(w, "Failed to update photos", http.StatusInternalServerError)
+		log.Printf("Error setting primary photo of user_id %s: %v", userID, err)
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update photos", http.StatusInternalServerError)
+		log.Printf("Error committing primary photo of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Write([]byte("Primary photo updated successfully"))
+}
+
+func PhotoOrder(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Parse the request body for the new order, it has to list every photo once
+	var requestBody struct {
+		PhotoIDs []string `json:"photo_ids"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT photo_uuid FROM photos WHERE user_uuid = $1 FOR UPDATE", userID)
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error reading photos of user_id %s: %v", userID, err)
+		return
+	}
+	owned := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			http.Error(w, "Database query error", http.StatusInternalServerError)
+			log.Printf("Error scanning photo of user_id %s: %v", userID, err)
+			return
+		}
+		owned[id] = true
+	}
+	rows.Close()
+
+	seen := map[string]bool{}
+	for _, id := range requestBody.PhotoIDs {
+		if !owned[id] || seen[id] {
+			http.Error(w, "photo_ids must list each of your photos exactly once", http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(owned) {
+		http.Error(w, "photo_ids must list each of your photos exactly once", http.StatusBadRequest)
+		return
+	}
+
+	for i, id := range requestBody.PhotoIDs {
+		if _, err := tx.Exec("UPDATE photos SET position = $1 WHERE photo_uuid = $2", i+1, id); err != nil {
+			http.Error(w, "Failed to reorder photos", http.StatusInternalServerError)
+			log.Printf("Error reordering photos of user_id %s: %v", userID, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to reorder photos", http.StatusInternalServerError)
+		log.Printf("Error committing photo order of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Write([]byte("Photos reordered successfully"))
+}
+
+func PhotoDelete(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	photoID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(photoID); err != nil {
+		http.Error(w, "Invalid photo id", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var wasPrimary bool
+	var extension string
+	err = tx.QueryRow("DELETE FROM photos WHERE photo_uuid = $1 AND user_uuid = $2 RETURNING is_primary, extension", photoID, userID).
+		Scan(&wasPrimary, &extension)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+		log.Printf("Error deleting photo %s of user_id %s: %v", photoID, userID, err)
+		return
+	}
+
+	// Close the gap in the order and hand the primary flag to the new first photo
+	queries := []string{`
+		UPDATE photos p SET position = o.position
+		FROM (SELECT id, row_number() OVER (ORDER BY position, id) AS position FROM photos WHERE user_uuid = $1) o
+		WHERE p.id = o.id`,
+	}
+	if wasPrimary {
+		queries = append(queries, `
+			UPDATE photos SET is_primary = true
+			WHERE id = (SELECT id FROM photos WHERE user_uuid = $1 ORDER BY position, id LIMIT 1)`)
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+			log.Printf("Error updating photos of user_id %s: %v", userID, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to delete photo", http.StatusInternalServerError)
+		log.Printf("Error committing photo deletion of user_id %s: %v", userID, err)
+		return
+	}
+
+	deletePhotoBlobs(userID, photoID, extension)
+	profileChanged(userID)
+
+	w.Write([]byte("Photo deleted successfully"))
+}
@@ -0,0 +1,260 @@
+package routes
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// pngImage encodes a plain image of the given size.
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uploadPhoto sends a file as the photo field of a multipart form.
+func uploadPhoto(t *testing.T, token string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("photo", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	request := httptest.NewRequest("POST", "/api/v1/me/photos", &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	PhotoUpload(recorder, request)
+	return recorder
+}
+
+type uploaded struct {
+	ID     string      `json:"id"`
+	Photos []photoInfo `json:"photos"`
+}
+
+func TestPhotoUpload(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	valid := pngImage(t, 300, 200)
+
+	tests := []struct {
+		name  string
+		token string
+		data  []byte
+		want  int
+	}{
+		{"no token", "", valid, http.StatusUnauthorized},
+		{"not an image", alice.Token, []byte("hello, this is text"), http.StatusUnsupportedMediaType},
+		{"too small", alice.Token, pngImage(t, 300, 199), http.StatusBadRequest},
+		{"uploaded", alice.Token, valid, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if recorder := uploadPhoto(t, tt.token, tt.data); recorder.Code != tt.want {
+				t.Errorf("Upload: got status %d, want %d: %s", recorder.Code, tt.want, recorder.Body.String())
+			}
+		})
+	}
+
+	// The first photo is the primary one, up to maxPhotos are kept
+	for i := 1; i < maxPhotos; i++ {
+		var result uploaded
+		decode(t, uploadPhoto(t, alice.Token, valid), &result)
+		if len(result.Photos) != i+1 || !result.Photos[0].Primary || result.Photos[i].Primary {
+			t.Errorf("Photos after upload %d: got %+v", i+1, result.Photos)
+		}
+		if want := "/api/v1/photos/" + result.ID + "/thumb"; result.Photos[i].URLs["thumb"] != want {
+			t.Errorf("Thumbnail URL: got %q, want %q", result.Photos[i].URLs["thumb"], want)
+		}
+	}
+	if recorder := uploadPhoto(t, alice.Token, valid); recorder.Code != http.StatusConflict {
+		t.Errorf("Upload over the limit: got status %d, want %d", recorder.Code, http.StatusConflict)
+	}
+}
+
+func TestPhotoUploadConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	valid := pngImage(t, 300, 200)
+
+	// Simultaneous uploads still stop at maxPhotos with a single primary photo
+	codes := make([]int, maxPhotos+2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = uploadPhoto(t, alice.Token, valid).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("Concurrent upload: got status %d", code)
+		}
+	}
+	var count, primary int
+	if err := db.QueryRow("SELECT count(*), count(*) FILTER (WHERE is_primary) FROM photos WHERE user_uuid = $1", alice.ID).Scan(&count, &primary); err != nil {
+		t.Fatal(err)
+	}
+	if created != maxPhotos || count != maxPhotos || primary != 1 {
+		t.Errorf("Concurrent uploads: got %d created, %d saved and %d primary, want %d, %d and 1", created, count, primary, maxPhotos, maxPhotos)
+	}
+}
+
+func TestPhotoList(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	carol := db.User(t, "carol")
+	uploadPhoto(t, alice.Token, pngImage(t, 200, 200))
+	serve(t, BlockUser, "PUT", "/api/v1/me/blocks/"+carol.ID, alice.Token, map[string]string{"uuid": carol.ID}, nil)
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	runHandlerTests(t, PhotoList, []handlerTest{
+		{"no token", "GET", "/api/v1/me/photos", "", nil, nil, http.StatusUnauthorized},
+		{"own photos", "GET", "/api/v1/me/photos", alice.Token, nil, nil, http.StatusOK},
+		{"invalid id", "GET", "/api/v1/users/alice/photos", bob.Token, user("alice"), nil, http.StatusBadRequest},
+		{"someone else's", "GET", "/api/v1/users/" + alice.ID + "/photos", bob.Token, user(alice.ID), nil, http.StatusOK},
+		{"blocked", "GET", "/api/v1/users/" + alice.ID + "/photos", carol.Token, user(alice.ID), nil, http.StatusNotFound},
+	})
+
+	var photos []photoInfo
+	decode(t, serve(t, PhotoList, "GET", "/api/v1/users/"+alice.ID+"/photos", bob.Token, user(alice.ID), nil), &photos)
+	if len(photos) != 1 {
+		t.Errorf("Photos of alice: got %+v", photos)
+	}
+}
+
+func TestPhotoGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	var result uploaded
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &result)
+
+	get := func(id, size string) map[string]string { return map[string]string{"id": id, "size": size} }
+	runHandlerTests(t, PhotoGet, []handlerTest{
+		{"no token", "GET", "/api/v1/photos/" + result.ID + "/full", "", get(result.ID, "full"), nil, http.StatusUnauthorized},
+		{"invalid id", "GET", "/api/v1/photos/photo/full", bob.Token, get("photo", "full"), nil, http.StatusBadRequest},
+		{"unknown size", "GET", "/api/v1/photos/" + result.ID + "/huge", bob.Token, get(result.ID, "huge"), nil, http.StatusBadRequest},
+		{"unknown photo", "GET", "/api/v1/photos/" + unknownUser + "/full", bob.Token, get(unknownUser, "full"), nil, http.StatusNotFound},
+		{"full", "GET", "/api/v1/photos/" + result.ID + "/full", bob.Token, get(result.ID, "full"), nil, http.StatusOK},
+		{"thumb", "GET", "/api/v1/photos/" + result.ID + "/thumb", alice.Token, get(result.ID, "thumb"), nil, http.StatusOK},
+	})
+
+	recorder := serve(t, PhotoGet, "GET", "/api/v1/photos/"+result.ID+"/full", bob.Token, get(result.ID, "full"), nil)
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("Content-Type: got %q, want image/png", contentType)
+	}
+	if _, err := png.Decode(recorder.Body); err != nil {
+		t.Errorf("Error decoding the stored photo: %v", err)
+	}
+}
+
+func TestPhotoOrder(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	var first, second uploaded
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &first)
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &second)
+
+	order := func(ids ...string) map[string][]string { return map[string][]string{"photo_ids": ids} }
+	runHandlerTests(t, PhotoOrder, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/photos/order", "", nil, order(second.ID, first.ID), http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/photos/order", alice.Token, nil, "{", http.StatusBadRequest},
+		{"missing photo", "PUT", "/api/v1/me/photos/order", alice.Token, nil, order(second.ID), http.StatusBadRequest},
+		{"repeated photo", "PUT", "/api/v1/me/photos/order", alice.Token, nil, order(second.ID, second.ID), http.StatusBadRequest},
+		{"unknown photo", "PUT", "/api/v1/me/photos/order", alice.Token, nil, order(second.ID, unknownUser), http.StatusBadRequest},
+		{"reordered", "PUT", "/api/v1/me/photos/order", alice.Token, nil, order(second.ID, first.ID), http.StatusOK},
+	})
+
+	var photos []photoInfo
+	decode(t, serve(t, PhotoList, "GET", "/api/v1/me/photos", alice.Token, nil, nil), &photos)
+	if len(photos) != 2 || photos[0].ID != second.ID {
+		t.Errorf("Photos after reordering: got %+v", photos)
+	}
+}
+
+func TestPhotoPrimary(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	var first, second uploaded
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &first)
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &second)
+
+	photo := func(id string) map[string]string { return map[string]string{"id": id} }
+	runHandlerTests(t, PhotoPrimary, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/photos/" + second.ID + "/primary", "", photo(second.ID), nil, http.StatusUnauthorized},
+		{"invalid id", "PUT", "/api/v1/me/photos/photo/primary", alice.Token, photo("photo"), nil, http.StatusBadRequest},
+		{"someone else's", "PUT", "/api/v1/me/photos/" + second.ID + "/primary", bob.Token, photo(second.ID), nil, http.StatusNotFound},
+		{"primary", "PUT", "/api/v1/me/photos/" + second.ID + "/primary", alice.Token, photo(second.ID), nil, http.StatusOK},
+	})
+
+	var photos []photoInfo
+	decode(t, serve(t, PhotoList, "GET", "/api/v1/me/photos", alice.Token, nil, nil), &photos)
+	for _, p := range photos {
+		if p.Primary != (p.ID == second.ID) {
+			t.Errorf("Photo %s primary: got %v", p.ID, p.Primary)
+		}
+	}
+}
+
+func TestPhotoDelete(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	var first, second uploaded
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &first)
+	decode(t, uploadPhoto(t, alice.Token, pngImage(t, 200, 200)), &second)
+
+	photo := func(id string) map[string]string { return map[string]string{"id": id} }
+	runHandlerTests(t, PhotoDelete, []handlerTest{
+		{"no token", "DELETE", "/api/v1/me/photos/" + first.ID, "", photo(first.ID), nil, http.StatusUnauthorized},
+		{"invalid id", "DELETE", "/api/v1/me/photos/photo", alice.Token, photo("photo"), nil, http.StatusBadRequest},
+		{"someone else's", "DELETE", "/api/v1/me/photos/" + first.ID, bob.Token, photo(first.ID), nil, http.StatusNotFound},
+		{"deleted", "DELETE", "/api/v1/me/photos/" + first.ID, alice.Token, photo(first.ID), nil, http.StatusOK},
+		{"deleted again", "DELETE", "/api/v1/me/photos/" + first.ID, alice.Token, photo(first.ID), nil, http.StatusNotFound},
+	})
+
+	// The next photo becomes the primary one and the files are gone
+	var photos []photoInfo
+	decode(t, serve(t, PhotoList, "GET", "/api/v1/me/photos", alice.Token, nil, nil), &photos)
+	if len(photos) != 1 || !photos[0].Primary {
+		t.Errorf("Photos after deleting the primary one: got %+v", photos)
+	}
+	get := map[string]string{"id": first.ID, "size": "full"}
+	if recorder := serve(t, PhotoGet, "GET", "/api/v1/photos/"+first.ID+"/full", alice.Token, get, nil); recorder.Code != http.StatusNotFound {
+		t.Errorf("Deleted photo: got status %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
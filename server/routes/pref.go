@@ -42,9 +42,7 @@ func FoodPref(w http.ResponseWriter, r *http.Request) {
 		Code   string `json:"code"`
 		Remove bool   `json:"isUnchecked"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -122,6 +120,8 @@ func FoodPref(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond with success
 	if requestBody.Remove {
 		w.WriteHeader(http.StatusOK)
@@ -161,9 +161,7 @@ func HobbyPref(w http.ResponseWriter, r *http.Request) {
 		Code   string `json:"code"`
 		Remove bool   `json:"isUnchecked"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -238,6 +236,8 @@ func HobbyPref(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	if requestBody.Remove {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Code removed successfully"))
@@ -276,9 +276,7 @@ func MusicPref(w http.ResponseWriter, r *http.Request) {
 		Code   string `json:"code"`
 		Remove bool   `json:"isUnchecked"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -353,6 +351,8 @@ func MusicPref(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	if requestBody.Remove {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Code removed successfully"))
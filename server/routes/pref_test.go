@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPreferences(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	categories := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"food", FoodPref},
+		{"hobby", HobbyPref},
+		{"music", MusicPref},
+	}
+	for _, category := range categories {
+		t.Run(category.name, func(t *testing.T) {
+			target := "/api/v1/me/preferences/" + category.name
+			add := map[string]interface{}{"code": "A1"}
+			remove := map[string]interface{}{"code": "A1", "isUnchecked": true}
+			runHandlerTests(t, category.handler, []handlerTest{
+				{"no token", "POST", target, "", nil, add, http.StatusUnauthorized},
+				{"invalid body", "POST", target, alice.Token, nil, "{", http.StatusBadRequest},
+				{"missing code", "POST", target, alice.Token, nil, map[string]string{}, http.StatusBadRequest},
+				{"added", "POST", target, alice.Token, nil, add, http.StatusOK},
+				{"added twice", "POST", target, alice.Token, nil, add, http.StatusBadRequest},
+				{"removed", "POST", target, alice.Token, nil, remove, http.StatusOK},
+				{"removed twice", "POST", target, alice.Token, nil, remove, http.StatusNotFound},
+			})
+		})
+	}
+}
+
+func TestPrefGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	db.Preferences(t, alice, "food", "A1", "B1")
+	db.Preferences(t, alice, "music", "C1")
+
+	runHandlerTests(t, PrefGet, []handlerTest{
+		{"no token", "GET", "/api/v1/me/preferences", "", nil, nil, http.StatusUnauthorized},
+		{"preferences", "GET", "/api/v1/me/preferences", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var prefs map[string]string
+	decode(t, serve(t, PrefGet, "GET", "/api/v1/me/preferences", alice.Token, nil, nil), &prefs)
+	if prefs["food_myvariabledata"] != "A1,B1" || prefs["music_myvariabledata"] != "C1" || prefs["hobbies_myvariabledata"] != "" {
+		t.Errorf("Unexpected preferences: %v", prefs)
+	}
+}
+
+func TestPrefMappingGet(t *testing.T) {
+	newTestDB(t)
+
+	runHandlerTests(t, PrefMappingGet, []handlerTest{
+		{"mappings", "GET", "/api/v1/preferences", "", nil, nil, http.StatusOK},
+	})
+
+	var mappings map[string][]struct {
+		Code string `json:"code"`
+	}
+	decode(t, serve(t, PrefMappingGet, "GET", "/api/v1/preferences", "", nil, nil), &mappings)
+	for _, category := range []string{"food", "hobby", "music"} {
+		if len(mappings[category]) == 0 {
+			t.Errorf("No %s codes were seeded", category)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"match_me_module/profile"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// prompt is a question users can answer on their profile.
+type prompt struct {
+	ID       int    `json:"id"`
+	Question string `json:"question"`
+	Active   bool   `json:"active"`
+}
+
+// promptAnswer is the answer of a user to a prompt.
+type promptAnswer struct {
+	PromptID int    `json:"prompt_id"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// profileFields are the structured fields of a profile, nil means not filled in.
+type profileFields struct {
+	HeightCm         *int     `json:"height_cm"`
+	Occupation       *string  `json:"occupation"`
+	Languages        []string `json:"languages"`
+	RelationshipGoal *string  `json:"relationship_goal"`
+}
+
+func loadPrompts(db *sql.DB, activeOnly bool) ([]prompt, error) {
+	rows, err := db.Query("SELECT id, question, active FROM prompts WHERE active OR NOT $1 ORDER BY id", activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prompts := []prompt{}
+	for rows.Next() {
+		var p prompt
+		if err := rows.Scan(&p.ID, &p.Question, &p.Active); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, rows.Err()
+}
+
+func loadAnswers(db *sql.DB, userID string) ([]promptAnswer, error) {
+	rows, err := db.Query(`
+		SELECT a.prompt_id, p.question, a.answer
+		FROM profile_prompts a
+		JOIN prompts p ON p.id = a.prompt_id
+		WHERE a.user_uuid = $1
+		ORDER BY a.position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	answers := []promptAnswer{}
+	for rows.Next() {
+		var a promptAnswer
+		if err := rows.Scan(&a.PromptID, &a.Question, &a.Answer); err != nil {
+			return nil, err
+		}
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
+
+func loadFields(db *sql.DB, userID string) (profileFields, error) {
+	var fields profileFields
+	var languages sql.NullString
+	err := db.QueryRow(`
+		SELECT height_cm, occupation, languages, relationship_goal
+		FROM profile_info WHERE user_uuid = $1`, userID).
+		Scan(&fields.HeightCm, &fields.Occupation, &languages, &fields.RelationshipGoal)
+	if err != nil && err != sql.ErrNoRows {
+		return fields, err
+	}
+	fields.Languages = matching.SplitCodes(languages)
+	if fields.Languages == nil {
+		fields.Languages = []string{}
+	}
+	return fields, nil
+}
+
+// ProfileFields replaces the structured fields of the caller's profile, a
+// field left out of the request is cleared.
+func ProfileFields(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	var fields profileFields
+	if !decodeJSON(w, r, &fields) {
+		return
+	}
+
+	if fields.HeightCm != nil {
+		if err := profile.ValidHeight(*fields.HeightCm); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if fields.Occupation != nil {
+		occupation, err := profile.Clean(*fields.Occupation, profile.MaxOccupation)
+		if err != nil {
+			http.Error(w, "Invalid occupation: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields.Occupation = &occupation
+		if occupation == "" {
+			fields.Occupation = nil
+		}
+	}
+	languages, err := profile.Languages(fields.Languages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fields.RelationshipGoal != nil && *fields.RelationshipGoal == "" {
+		fields.RelationshipGoal = nil
+	}
+	if fields.RelationshipGoal != nil {
+		if err := profile.ValidGoal(*fields.RelationshipGoal); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	var storedLanguages *string
+	if len(languages) > 0 {
+		joined := strings.Join(languages, ",")
+		storedLanguages = &joined
+	}
+	_, err = db.Exec(`
+		UPDATE profile_info
+		SET height_cm = $1, occupation = $2, languages = $3, relationship_goal = $4
+		WHERE user_uuid = $5`,
+		fields.HeightCm, fields.Occupation, storedLanguages, fields.RelationshipGoal, userID)
+	if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		log.Printf("Error updating profile fields for user_id %s: %v", userID, err)
+		return
+	}
+
+	// Height, languages and goal can be filtered on
+	profileChanged(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Profile updated successfully",
+	})
+}
+
+func ProfileFieldsGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	fields, err := loadFields(db, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch profile", http.StatusInternalServerError)
+		log.Printf("Error fetching profile fields for user_id %s: %v", userID, err)
+		return
+	}
+
+	// The accepted goals are sent along so clients don't hard-code them
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		profileFields
+		Goals []string `json:"relationship_goals"`
+	}{fields, profile.RelationshipGoals})
+}
+
+// PromptList returns the prompts users can currently answer.
+func PromptList(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	_, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	prompts, err := loadPrompts(databaseSetup.GetDB(), true)
+	if err != nil {
+		http.Error(w, "Failed to query prompts", http.StatusInternalServerError)
+		log.Printf("Error querying prompts: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prompts)
+}
+
+// PromptAnswers replaces the prompt answers of the caller, in the order they
+// are shown on the profile.
+func PromptAnswers(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	var requestBody struct {
+		Answers []promptAnswer `json:"answers"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	if len(requestBody.Answers) > profile.MaxAnswers {
+		http.Error(w, profile.ErrTooManyAnswers.Error(), http.StatusBadRequest)
+		return
+	}
+
+	seen := map[int]bool{}
+	for i, a := range requestBody.Answers {
+		if seen[a.PromptID] {
+			http.Error(w, "Each prompt can only be answered once", http.StatusBadRequest)
+			return
+		}
+		seen[a.PromptID] = true
+		answer, err := profile.CleanRequired(a.Answer, profile.MaxAnswer)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid answer to prompt %d: %v", a.PromptID, err), http.StatusBadRequest)
+			return
+		}
+		requestBody.Answers[i].Answer = answer
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error starting transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Answers to retired prompts may be kept, but not given anew
+	for _, a := range requestBody.Answers {
+		var allowed bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM prompts WHERE id = $1 AND active)
+			    OR EXISTS (SELECT 1 FROM profile_prompts WHERE prompt_id = $1 AND user_uuid = $2)`,
+			a.PromptID, userID).Scan(&allowed)
+		if err != nil {
+			http.Error(w, "Database query error", http.StatusInternalServerError)
+			log.Printf("Error checking prompt %d: %v", a.PromptID, err)
+			return
+		}
+		if !allowed {
+			http.Error(w, fmt.Sprintf("Unknown prompt %d", a.PromptID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM profile_prompts WHERE user_uuid = $1", userID); err != nil {
+		http.Error(w, "Failed to update answers", http.StatusInternalServerError)
+		log.Printf("Error deleting answers of user_id %s: %v", userID, err)
+		return
+	}
+	for position, a := range requestBody.Answers {
+		_, err := tx.Exec("INSERT INTO profile_prompts (user_uuid, prompt_id, answer, position) VALUES ($1, $2, $3, $4)",
+			userID, a.PromptID, a.Answer, position)
+		if err != nil {
+			http.Error(w, "Failed to update answers", http.StatusInternalServerError)
+			log.Printf("Error saving answer to prompt %d of user_id %s: %v", a.PromptID, userID, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update answers", http.StatusInternalServerError)
+		log.Printf("Error committing answers of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Answers updated successfully",
+	})
+}
+
+func PromptAnswersGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	answers, err := loadAnswers(databaseSetup.GetDB(), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch answers", http.StatusInternalServerError)
+		log.Printf("Error fetching answers of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answers)
+}
@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProfileFields(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	fields := func(height int, occupation string, languages []string, goal string) map[string]interface{} {
+		return map[string]interface{}{"height_cm": height, "occupation": occupation, "languages": languages, "relationship_goal": goal}
+	}
+	runHandlerTests(t, ProfileFields, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/fields", "", nil, fields(170, "Baker", nil, "casual"), http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/fields", alice.Token, nil, "{", http.StatusBadRequest},
+		{"too short", "PUT", "/api/v1/me/fields", alice.Token, nil, fields(99, "Baker", nil, "casual"), http.StatusBadRequest},
+		{"too tall", "PUT", "/api/v1/me/fields", alice.Token, nil, fields(251, "Baker", nil, "casual"), http.StatusBadRequest},
+		{"occupation too long", "PUT", "/api/v1/me/fields", alice.Token, nil, fields(170, strings.Repeat("a", 101), nil, "casual"), http.StatusBadRequest},
+		{"unknown language", "PUT", "/api/v1/me/fields", alice.Token, nil, fields(170, "Baker", []string{"zz1"}, "casual"), http.StatusBadRequest},
+		{"unknown goal", "PUT", "/api/v1/me/fields", alice.Token, nil, fields(170, "Baker", nil, "marriage"), http.StatusBadRequest},
+		{"updated", "PUT", "/api/v1/me/fields", alice.Token, nil, fields(170, "<b>Baker</b>", []string{"ET", "est", "en"}, "casual"), http.StatusOK},
+	})
+
+	var got struct {
+		HeightCm   *int     `json:"height_cm"`
+		Occupation *string  `json:"occupation"`
+		Languages  []string `json:"languages"`
+		Goal       *string  `json:"relationship_goal"`
+		Goals      []string `json:"relationship_goals"`
+	}
+	decode(t, serve(t, ProfileFieldsGet, "GET", "/api/v1/me/fields", alice.Token, nil, nil), &got)
+	if got.HeightCm == nil || *got.HeightCm != 170 || got.Goal == nil || *got.Goal != "casual" || len(got.Goals) == 0 {
+		t.Errorf("Profile fields: got %+v", got)
+	}
+	// Markup is stripped and languages are normalized without duplicates
+	if got.Occupation == nil || *got.Occupation != "Baker" {
+		t.Errorf("Occupation: got %v, want Baker", got.Occupation)
+	}
+	if strings.Join(got.Languages, ",") != "et,en" {
+		t.Errorf("Languages: got %v, want [et en]", got.Languages)
+	}
+}
+
+func TestPromptList(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	if _, err := db.Exec("UPDATE prompts SET active = false WHERE question = 'My most irrational fear'"); err != nil {
+		t.Fatal(err)
+	}
+
+	runHandlerTests(t, PromptList, []handlerTest{
+		{"no token", "GET", "/api/v1/prompts", "", nil, nil, http.StatusUnauthorized},
+		{"prompts", "GET", "/api/v1/prompts", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var prompts []prompt
+	decode(t, serve(t, PromptList, "GET", "/api/v1/prompts", alice.Token, nil, nil), &prompts)
+	if len(prompts) == 0 {
+		t.Fatal("No prompts listed")
+	}
+	for _, p := range prompts {
+		if !p.Active {
+			t.Errorf("Inactive prompt %q listed", p.Question)
+		}
+	}
+}
+
+func TestPromptAnswers(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	var ids []int
+	rows, err := db.Query("SELECT id FROM prompts ORDER BY id LIMIT 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) != 4 {
+		t.Fatalf("Got %d prompts, want 4", len(ids))
+	}
+
+	answers := func(answers ...promptAnswer) map[string][]promptAnswer {
+		return map[string][]promptAnswer{"answers": answers}
+	}
+	answer := func(id int, text string) promptAnswer { return promptAnswer{PromptID: id, Answer: text} }
+	runHandlerTests(t, PromptAnswers, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/answers", "", nil, answers(answer(ids[0], "Hiking")), http.StatusUnauthorized},
+		{"invalid body", "PUT", "/api/v1/me/answers", alice.Token, nil, "{", http.StatusBadRequest},
+		{"too many", "PUT", "/api/v1/me/answers", alice.Token, nil, answers(answer(ids[0], "a"), answer(ids[1], "b"), answer(ids[2], "c"), answer(ids[3], "d")), http.StatusBadRequest},
+		{"same prompt twice", "PUT", "/api/v1/me/answers", alice.Token, nil, answers(answer(ids[0], "a"), answer(ids[0], "b")), http.StatusBadRequest},
+		{"empty answer", "PUT", "/api/v1/me/answers", alice.Token, nil, answers(answer(ids[0], " ")), http.StatusBadRequest},
+		{"answer too long", "PUT", "/api/v1/me/answers", alice.Token, nil, answers(answer(ids[0], strings.Repeat("a", 301))), http.StatusBadRequest},
+		{"unknown prompt", "PUT", "/api/v1/me/answers", alice.Token, nil, answers(answer(99999, "a")), http.StatusBadRequest},
+		{"answered", "PUT", "/api/v1/me/answers", alice.Token, nil, answers(answer(ids[1], "Hiking"), answer(ids[0], "Chess")), http.StatusOK},
+	})
+
+	// Answers keep the order they were sent in
+	var got []promptAnswer
+	decode(t, serve(t, PromptAnswersGet, "GET", "/api/v1/me/answers", alice.Token, nil, nil), &got)
+	if len(got) != 2 || got[0].PromptID != ids[1] || got[1].Answer != "Chess" {
+		t.Errorf("Answers: got %+v", got)
+	}
+}
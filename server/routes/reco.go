@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	"match_me_module/jobs"
+	"match_me_module/matching"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// profileChanged queues a recomputation of the recommendations affected by a
+// change to the user's profile, failures are logged and do not fail the request.
+func profileChanged(userID string) {
+	if err := jobs.Enqueue(databaseSetup.GetDB(), jobs.KindProfileChanged, userID); err != nil {
+		log.Printf("Error queueing recommendation update for user_id %s: %v", userID, err)
+	}
+}
+
+// profileChangesAt queues a recomputation for when something about the user's
+// profile changes by itself, like a browser position going stale.
+func profileChangesAt(userID string, at time.Time) {
+	if err := jobs.EnqueueAt(databaseSetup.GetDB(), jobs.KindProfileChanged, userID, at); err != nil {
+		log.Printf("Error scheduling recommendation update for user_id %s: %v", userID, err)
+	}
+}
+
+func RecommendationGet(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Recommendations are kept up to date by the job workers, see
+	// profileChanged. Blocks and account status are checked again so nobody
+	// shows up while that update is still queued.
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT r.user_uuid_with, i.username, i.first_name, r.compability, r.distance
+		FROM reccomendations r
+		JOIN user_info i ON i.user_uuid = r.user_uuid_with
+		WHERE r.user_uuid_of = $1
+		  AND %s
+		  AND %s
+		ORDER BY r.compability DESC`, matching.NotBlockedSQL("$1::uuid", "r.user_uuid_with"), matching.ActiveAccountSQL("r.user_uuid_with")), userID)
+	if err != nil {
+		http.Error(w, "Failed to query recommendations", http.StatusInternalServerError)
+		log.Printf("Error querying recommendations: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type recommendation struct {
+		UserID      string  `json:"user_id"`
+		Username    string  `json:"username"`
+		FirstName   string  `json:"first_name"`
+		Compability float64 `json:"compability"`
+		Distance    float64 `json:"distance"`
+	}
+	recommendations := []recommendation{}
+	for rows.Next() {
+		var rec recommendation
+		if err := rows.Scan(&rec.UserID, &rec.Username, &rec.FirstName, &rec.Compability, &rec.Distance); err != nil {
+			http.Error(w, "Failed to read recommendations", http.StatusInternalServerError)
+			log.Printf("Error scanning recommendation: %v", err)
+			return
+		}
+		recommendations = append(recommendations, rec)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read recommendations", http.StatusInternalServerError)
+		log.Printf("Error reading recommendations: %v", err)
+		return
+	}
+
+	// Send the recommendations as JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recommendations)
+}
+
+func RecommendationExplain(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// The candidate to explain comes from the path
+	candidateID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(candidateID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	explanation, err := matching.Explain(db, userID, candidateID)
+	if err == matching.ErrUnknownCandidate {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to explain recommendation", http.StatusInternalServerError)
+		log.Printf("Error explaining recommendation of %s for user_id %s: %v", candidateID, userID, err)
+		return
+	}
+
+	// Send the score breakdown as JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
+}
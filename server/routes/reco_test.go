@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRecommendationGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	carol := db.User(t, "carol")
+	for _, with := range []string{bob.ID, carol.ID} {
+		if _, err := db.Exec("INSERT INTO reccomendations (user_uuid_of, user_uuid_with, compability, distance) VALUES ($1, $2, 0.5, 10)", alice.ID, with); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A suspended user is left out even before the recommendations are recomputed
+	if _, err := db.Exec("UPDATE user_table SET account_status = 'suspended', suspended_until = now() + interval '1 day' WHERE user_uuid = $1", carol.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	runHandlerTests(t, RecommendationGet, []handlerTest{
+		{"no token", "GET", "/api/v1/recommendations", "", nil, nil, http.StatusUnauthorized},
+		{"recommendations", "GET", "/api/v1/recommendations", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var recommendations []struct {
+		UserID string `json:"user_id"`
+	}
+	decode(t, serve(t, RecommendationGet, "GET", "/api/v1/recommendations", alice.Token, nil, nil), &recommendations)
+	if len(recommendations) != 1 || recommendations[0].UserID != bob.ID {
+		t.Errorf("Recommendations: got %v", recommendations)
+	}
+
+	// A blocked user is left out even before the recommendations are recomputed
+	serve(t, BlockUser, "PUT", "/api/v1/me/blocks/"+alice.ID, bob.Token, map[string]string{"uuid": alice.ID}, nil)
+	recommendations = nil
+	decode(t, serve(t, RecommendationGet, "GET", "/api/v1/recommendations", alice.Token, nil, nil), &recommendations)
+	if len(recommendations) != 0 {
+		t.Errorf("Recommendations after being blocked: got %v", recommendations)
+	}
+}
+
+func TestRecommendationExplain(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	db.Preferences(t, alice, "food", "A1", "A2")
+	db.Preferences(t, bob, "food", "A2", "B1")
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	runHandlerTests(t, RecommendationExplain, []handlerTest{
+		{"no token", "GET", "/api/v1/recommendations/" + bob.ID + "/explanation", "", user(bob.ID), nil, http.StatusUnauthorized},
+		{"invalid id", "GET", "/api/v1/recommendations/bob/explanation", alice.Token, user("bob"), nil, http.StatusBadRequest},
+		{"unknown user", "GET", "/api/v1/recommendations/" + unknownUser + "/explanation", alice.Token, user(unknownUser), nil, http.StatusNotFound},
+		{"yourself", "GET", "/api/v1/recommendations/" + alice.ID + "/explanation", alice.Token, user(alice.ID), nil, http.StatusNotFound},
+		{"explained", "GET", "/api/v1/recommendations/" + bob.ID + "/explanation", alice.Token, user(bob.ID), nil, http.StatusOK},
+	})
+
+	var explanation struct {
+		UserID     string              `json:"user_id"`
+		Shared     map[string][]string `json:"shared"`
+		ExcludedBy *string             `json:"excluded_by"`
+	}
+	decode(t, serve(t, RecommendationExplain, "GET", "/api/v1/recommendations/"+bob.ID+"/explanation", alice.Token, user(bob.ID), nil), &explanation)
+	if explanation.UserID != bob.ID || len(explanation.Shared["food"]) != 1 {
+		t.Errorf("Explanation: got %+v", explanation)
+	}
+	// Fresh profiles are not complete enough to be recommended
+	if explanation.ExcludedBy == nil || *explanation.ExcludedBy != "incomplete_profile" {
+		t.Errorf("Explanation excluded by: got %v, want incomplete_profile", explanation.ExcludedBy)
+	}
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"match_me_module/storage"
+	"match_me_module/testdb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// The handlers are called directly, so the path variables the router would
+// extract are set by the tests and the admin handlers get their role check
+// from middleware.RequireRole like in the router.
+
+// handlerTest is one request to a handler and the status it has to answer
+// with. The tests of a table run in order against the same database, so a
+// test can rely on the ones before it.
+type handlerTest struct {
+	name   string
+	method string
+	target string
+	token  string
+	vars   map[string]string
+	body   interface{} // encoded as JSON, a string is sent as it is
+	want   int
+}
+
+func runHandlerTests(t *testing.T, handler http.HandlerFunc, tests []handlerTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serve(t, handler, tt.method, tt.target, tt.token, tt.vars, tt.body)
+			if recorder.Code != tt.want {
+				t.Errorf("%s %s: got status %d, want %d: %s", tt.method, tt.target, recorder.Code, tt.want, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// serve sends one request to a handler and returns the recorded response.
+func serve(t *testing.T, handler http.HandlerFunc, method, target, token string, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveContext(context.Background(), t, handler, method, target, token, vars, body)
+}
+
+func serveContext(ctx context.Context, t *testing.T, handler http.HandlerFunc, method, target, token string, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var encoded []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		encoded = []byte(b)
+	default:
+		var err error
+		if encoded, err = json.Marshal(b); err != nil {
+			t.Fatalf("Error encoding request body: %v", err)
+		}
+	}
+
+	request := httptest.NewRequest(method, target, bytes.NewReader(encoded)).WithContext(ctx)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	if vars != nil {
+		request = mux.SetURLVars(request, vars)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	return recorder
+}
+
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("Error decoding response %q: %v", recorder.Body.String(), err)
+	}
+}
+
+// newTestDB creates the database of a test, with photos kept in a temporary
+// folder.
+func newTestDB(t *testing.T) *testdb.DB {
+	t.Helper()
+	db := testdb.New(t)
+	store, err := storage.NewFSStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating the photo store: %v", err)
+	}
+	SetBlobStore(store)
+	return db
+}
+
+// The user ID of nobody
+const unknownUser = "00000000-0000-4000-8000-000000000000"
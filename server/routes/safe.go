@@ -0,0 +1,316 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Categories a user can be reported for
+var reportCategories = map[string]bool{
+	"spam":          true,
+	"harassment":    true,
+	"fake_profile":  true,
+	"inappropriate": true,
+	"underage":      true,
+	"other":         true,
+}
+
+const maxReportDetails = 2000
+
+// targetUser reads the user the request is about from the path and checks
+// that it exists and is not the caller. It writes the error response itself.
+func targetUser(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	targetID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(targetID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return "", false
+	}
+	if targetID == userID {
+		http.Error(w, "Cannot do that to yourself", http.StatusBadRequest)
+		return "", false
+	}
+
+	var exists bool
+	err := databaseSetup.GetDB().QueryRow("SELECT EXISTS (SELECT 1 FROM user_info WHERE user_uuid = $1)", targetID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		log.Printf("Error checking user %s: %v", targetID, err)
+		return "", false
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return "", false
+	}
+	return targetID, true
+}
+
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	blockedID, ok := targetUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	if err := block(db, userID, blockedID); err != nil {
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		log.Printf("Error blocking %s for user_id %s: %v", blockedID, userID, err)
+		return
+	}
+
+	w.Write([]byte("User blocked successfully"))
+}
+
+// block records the block and removes everything that connects the two users.
+func block(db *sql.DB, userID, blockedID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO blocks (blocker_uuid, blocked_uuid, datetime_created)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (blocker_uuid, blocked_uuid) DO NOTHING`, userID, blockedID, time.Now())
+	if err != nil {
+		return fmt.Errorf("error saving block: %v", err)
+	}
+
+	// Both directions of every table linking the two users
+	for _, table := range []string{"pending_connections", "real_connections", "reccomendations"} {
+		query := fmt.Sprintf(`
+			DELETE FROM %s
+			WHERE (user_uuid_of = $1 AND user_uuid_with = $2) OR (user_uuid_of = $2 AND user_uuid_with = $1)`, table)
+		if _, err := tx.Exec(query, userID, blockedID); err != nil {
+			return fmt.Errorf("error clearing %s: %v", table, err)
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM notifications
+		WHERE (user_uuid = $1 AND actor_uuid = $2) OR (user_uuid = $2 AND actor_uuid = $1)`, userID, blockedID)
+	if err != nil {
+		return fmt.Errorf("error clearing notifications: %v", err)
+	}
+	_, err = tx.Exec(`
+		DELETE FROM event_log
+		WHERE (user_uuid = $1 AND data->>'user_id' = $2::text) OR (user_uuid = $2 AND data->>'user_id' = $1::text)`,
+		userID, blockedID)
+	if err != nil {
+		return fmt.Errorf("error clearing events: %v", err)
+	}
+	return tx.Commit()
+}
+
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	blockedID := mux.Vars(r)["uuid"]
+	if _, err := uuid.Parse(blockedID); err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	result, err := db.Exec("DELETE FROM blocks WHERE blocker_uuid = $1 AND blocked_uuid = $2", userID, blockedID)
+	if err != nil {
+		http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+		log.Printf("Error unblocking %s for user_id %s: %v", blockedID, userID, err)
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		http.Error(w, "User is not blocked", http.StatusNotFound)
+		return
+	}
+
+	// The two users can be recommended to each other again
+	profileChanged(userID)
+
+	w.Write([]byte("User unblocked successfully"))
+}
+
+func BlockList(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	// Only the users the caller blocked, not the ones who blocked the caller
+	rows, err := db.Query(`
+		SELECT b.blocked_uuid, i.username, b.datetime_created
+		FROM blocks b
+		JOIN user_info i ON i.user_uuid = b.blocked_uuid
+		WHERE b.blocker_uuid = $1
+		ORDER BY b.datetime_created DESC`, userID)
+	if err != nil {
+		http.Error(w, "Failed to query blocked users", http.StatusInternalServerError)
+		log.Printf("Error querying blocks of user_id %s: %v", userID, err)
+		return
+	}
+	defer rows.Close()
+
+	type blockedUser struct {
+		UserID    string    `json:"user_id"`
+		Username  string    `json:"username"`
+		BlockedAt time.Time `json:"blocked_at"`
+	}
+	blocked := []blockedUser{}
+	for rows.Next() {
+		var b blockedUser
+		if err := rows.Scan(&b.UserID, &b.Username, &b.BlockedAt); err != nil {
+			http.Error(w, "Failed to read blocked users", http.StatusInternalServerError)
+			log.Printf("Error scanning blocked user: %v", err)
+			return
+		}
+		blocked = append(blocked, b)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read blocked users", http.StatusInternalServerError)
+		log.Printf("Error reading blocked users: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocked)
+}
+
+func ReportUser(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	reportedID, ok := targetUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body for the report
+	var requestBody struct {
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	}
+	if !decodeJSON(w, r, &requestBody) {
+		return
+	}
+	if !reportCategories[requestBody.Category] {
+		http.Error(w, "Invalid report category", http.StatusBadRequest)
+		return
+	}
+	details := strings.TrimSpace(requestBody.Details)
+	if len([]rune(details)) > maxReportDetails {
+		http.Error(w, fmt.Sprintf("Details can be at most %d characters", maxReportDetails), http.StatusBadRequest)
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	_, err = db.Exec(`
+		INSERT INTO reports (reporter_uuid, reported_uuid, category, details, datetime_created)
+		VALUES ($1, $2, $3, $4, $5)`, userID, reportedID, requestBody.Category, details, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		log.Printf("Error saving report of %s by user_id %s: %v", reportedID, userID, err)
+		return
+	}
+
+	w.Write([]byte("User reported successfully"))
+}
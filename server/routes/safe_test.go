@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBlockUser(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	if _, err := db.Exec("INSERT INTO reccomendations (user_uuid_of, user_uuid_with, compability, distance) VALUES ($1, $2, 0.5, 10)", alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	runHandlerTests(t, BlockUser, []handlerTest{
+		{"no token", "PUT", "/api/v1/me/blocks/" + bob.ID, "", user(bob.ID), nil, http.StatusUnauthorized},
+		{"invalid id", "PUT", "/api/v1/me/blocks/bob", alice.Token, user("bob"), nil, http.StatusBadRequest},
+		{"yourself", "PUT", "/api/v1/me/blocks/" + alice.ID, alice.Token, user(alice.ID), nil, http.StatusBadRequest},
+		{"unknown user", "PUT", "/api/v1/me/blocks/" + unknownUser, alice.Token, user(unknownUser), nil, http.StatusNotFound},
+		{"blocked", "PUT", "/api/v1/me/blocks/" + bob.ID, alice.Token, user(bob.ID), nil, http.StatusOK},
+		{"blocked again", "PUT", "/api/v1/me/blocks/" + bob.ID, alice.Token, user(bob.ID), nil, http.StatusOK},
+	})
+
+	// Blocking removes the recommendation between both
+	var recommendations int
+	if err := db.QueryRow("SELECT count(*) FROM reccomendations WHERE user_uuid_of = $1", alice.ID).Scan(&recommendations); err != nil {
+		t.Fatal(err)
+	}
+	if recommendations != 0 {
+		t.Error("The recommendation of a blocked user was kept")
+	}
+}
+
+func TestUnblockUser(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	serve(t, BlockUser, "PUT", "/api/v1/me/blocks/"+bob.ID, alice.Token, map[string]string{"uuid": bob.ID}, nil)
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	runHandlerTests(t, UnblockUser, []handlerTest{
+		{"no token", "DELETE", "/api/v1/me/blocks/" + bob.ID, "", user(bob.ID), nil, http.StatusUnauthorized},
+		{"invalid id", "DELETE", "/api/v1/me/blocks/bob", alice.Token, user("bob"), nil, http.StatusBadRequest},
+		{"not blocked by them", "DELETE", "/api/v1/me/blocks/" + alice.ID, bob.Token, user(alice.ID), nil, http.StatusNotFound},
+		{"unblocked", "DELETE", "/api/v1/me/blocks/" + bob.ID, alice.Token, user(bob.ID), nil, http.StatusOK},
+		{"unblocked again", "DELETE", "/api/v1/me/blocks/" + bob.ID, alice.Token, user(bob.ID), nil, http.StatusNotFound},
+	})
+}
+
+func TestBlockList(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+	serve(t, BlockUser, "PUT", "/api/v1/me/blocks/"+bob.ID, alice.Token, map[string]string{"uuid": bob.ID}, nil)
+
+	runHandlerTests(t, BlockList, []handlerTest{
+		{"no token", "GET", "/api/v1/me/blocks", "", nil, nil, http.StatusUnauthorized},
+		{"blocked users", "GET", "/api/v1/me/blocks", alice.Token, nil, nil, http.StatusOK},
+		{"nobody blocked", "GET", "/api/v1/me/blocks", bob.Token, nil, nil, http.StatusOK},
+	})
+
+	var blocked []struct {
+		UserID string `json:"user_id"`
+	}
+	decode(t, serve(t, BlockList, "GET", "/api/v1/me/blocks", alice.Token, nil, nil), &blocked)
+	if len(blocked) != 1 || blocked[0].UserID != bob.ID {
+		t.Errorf("Blocked users: got %v", blocked)
+	}
+}
+
+func TestReportUser(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	bob := db.User(t, "bob")
+
+	user := func(id string) map[string]string { return map[string]string{"uuid": id} }
+	report := func(category, details string) map[string]string {
+		return map[string]string{"category": category, "details": details}
+	}
+	runHandlerTests(t, ReportUser, []handlerTest{
+		{"no token", "POST", "/api/v1/users/" + bob.ID + "/reports", "", user(bob.ID), report("spam", ""), http.StatusUnauthorized},
+		{"invalid id", "POST", "/api/v1/users/bob/reports", alice.Token, user("bob"), report("spam", ""), http.StatusBadRequest},
+		{"yourself", "POST", "/api/v1/users/" + alice.ID + "/reports", alice.Token, user(alice.ID), report("spam", ""), http.StatusBadRequest},
+		{"unknown user", "POST", "/api/v1/users/" + unknownUser + "/reports", alice.Token, user(unknownUser), report("spam", ""), http.StatusNotFound},
+		{"invalid body", "POST", "/api/v1/users/" + bob.ID + "/reports", alice.Token, user(bob.ID), "{", http.StatusBadRequest},
+		{"unknown category", "POST", "/api/v1/users/" + bob.ID + "/reports", alice.Token, user(bob.ID), report("rude", ""), http.StatusBadRequest},
+		{"details too long", "POST", "/api/v1/users/" + bob.ID + "/reports", alice.Token, user(bob.ID), report("other", strings.Repeat("a", 2001)), http.StatusBadRequest},
+		{"reported", "POST", "/api/v1/users/" + bob.ID + "/reports", alice.Token, user(bob.ID), report("spam", "Sends links"), http.StatusOK},
+	})
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"match_me_module/api"
+	"net/http"
+)
+
+// OpenAPI serves the OpenAPI document of the API, no token is needed.
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.Spec)
+}
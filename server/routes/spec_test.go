@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// The document is embedded, no database is needed
+func TestOpenAPI(t *testing.T) {
+	runHandlerTests(t, OpenAPI, []handlerTest{
+		{"document", "GET", "/api/v1/openapi.json", "", nil, nil, http.StatusOK},
+	})
+
+	recorder := serve(t, OpenAPI, "GET", "/api/v1/openapi.json", "", nil, nil)
+	if !json.Valid(recorder.Body.Bytes()) {
+		t.Error("The document is not valid JSON")
+	}
+}
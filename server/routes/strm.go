@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	databaseSetup "match_me_module/database"
+	middleware "match_me_module/middleware"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EventSource and browser WebSockets cannot send an Authorization header.
+// They send the token cookie by themselves, a client that keeps its token
+// elsewhere exchanges it for a stream ticket first and passes that as
+// ?ticket=. A ticket only opens one stream and expires quickly, unlike the
+// access token it does no harm in a URL that ends up in logs and history.
+const streamTicketTTL = 30 * time.Second
+
+// StreamTicket issues a single use ticket for opening the events stream or
+// the notification socket.
+func StreamTicket(w http.ResponseWriter, r *http.Request) {
+	// Validate the JWT token from the Authorization header
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		log.Printf("Error in authorizing: %v", err)
+		return
+	}
+
+	// Extract the user ID from the token claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Println("Invalid token")
+		return
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		log.Println("Missing or invalid user_id in token")
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "Failed to issue stream ticket", http.StatusInternalServerError)
+		log.Printf("Error generating stream ticket: %v", err)
+		return
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	// Only the hash is stored, like a password. A stream opened with the
+	// ticket ends with the token it was issued for.
+	expiresAt := time.Now().Add(streamTicketTTL)
+	var tokenExpiresAt *time.Time
+	if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+		tokenExpiresAt = &exp.Time
+	}
+	_, err = databaseSetup.GetDB().Exec("INSERT INTO stream_tickets (ticket_hash, user_uuid, expires_at, token_expires_at) VALUES ($1, $2, $3, $4)",
+		hashTicket(ticket), userID, expiresAt, tokenExpiresAt)
+	if err != nil {
+		http.Error(w, "Failed to issue stream ticket", http.StatusInternalServerError)
+		log.Printf("Error storing stream ticket of user_id %s: %v", userID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":     ticket,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// streamUser returns the user a stream is opened for, by the ?ticket= of the
+// request or else by its token, and when the token behind it expires (zero
+// if it does not say). Access tokens in the query are refused so clients
+// that still send them notice.
+func streamUser(r *http.Request) (string, time.Time, error) {
+	query := r.URL.Query()
+	if query.Has("token") {
+		return "", time.Time{}, fmt.Errorf("access tokens are not accepted in the URL, use a stream ticket")
+	}
+	if ticket := query.Get("ticket"); ticket != "" {
+		return redeemStreamTicket(databaseSetup.GetDB(), ticket)
+	}
+
+	token, err := middleware.ValidateToken(r)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", time.Time{}, fmt.Errorf("invalid token")
+	}
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("invalid user_id in token")
+	}
+	var expiresAt time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+	return userID, expiresAt, nil
+}
+
+// redeemStreamTicket uses up a ticket and returns its user, whose account
+// has to be usable still, and the expiry of the token it was issued for.
+func redeemStreamTicket(db *sql.DB, ticket string) (string, time.Time, error) {
+	var userID string
+	var valid bool
+	var tokenExpiresAt sql.NullTime
+	err := db.QueryRow("DELETE FROM stream_tickets WHERE ticket_hash = $1 RETURNING user_uuid, expires_at > now(), token_expires_at",
+		hashTicket(ticket)).Scan(&userID, &valid, &tokenExpiresAt)
+	if err == sql.ErrNoRows || (err == nil && !valid) {
+		return "", time.Time{}, fmt.Errorf("invalid or expired stream ticket")
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	account, err := middleware.LoadAccount(userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := account.Usable(); err != nil {
+		return "", time.Time{}, err
+	}
+	return userID, tokenExpiresAt.Time, nil
+}
+
+func hashTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
+
+// PruneStreamTickets removes the tickets that expired unused. The job runner
+// calls it periodically.
+func PruneStreamTickets(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM stream_tickets WHERE expires_at < now()")
+	return err
+}
@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamTicket(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	runHandlerTests(t, StreamTicket, []handlerTest{
+		{"no token", "POST", "/api/v1/me/stream-tickets", "", nil, nil, http.StatusUnauthorized},
+	})
+
+	issue := func() string {
+		var issued struct {
+			Ticket string `json:"ticket"`
+		}
+		recorder := serve(t, StreamTicket, "POST", "/api/v1/me/stream-tickets", alice.Token, nil, nil)
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("Issuing a ticket: got status %d, want %d: %s", recorder.Code, http.StatusCreated, recorder.Body.String())
+		}
+		decode(t, recorder, &issued)
+		return issued.Ticket
+	}
+	open := func(target string) (string, error) {
+		userID, expiresAt, err := streamUser(httptest.NewRequest("GET", target, nil))
+		if err == nil && expiresAt.IsZero() {
+			t.Errorf("%s: the stream does not end with the token", target)
+		}
+		return userID, err
+	}
+
+	// A ticket opens one stream
+	ticket := issue()
+	if userID, err := open("/api/v1/events?ticket=" + ticket); err != nil || userID != alice.ID {
+		t.Errorf("First use: got %q, %v", userID, err)
+	}
+	if _, err := open("/api/v1/events?ticket=" + ticket); err == nil {
+		t.Error("A ticket was accepted twice")
+	}
+
+	// An expired one opens none
+	ticket = issue()
+	if _, err := db.Exec("UPDATE stream_tickets SET expires_at = now() - interval '1 second'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open("/api/v1/events?ticket=" + ticket); err == nil {
+		t.Error("An expired ticket was accepted")
+	}
+
+	// Neither does a made up one or the access token itself
+	if _, err := open("/api/v1/events?ticket=abc"); err == nil {
+		t.Error("An unknown ticket was accepted")
+	}
+	if _, err := open("/api/v1/events?token=" + alice.Token); err == nil {
+		t.Error("An access token in the URL was accepted")
+	}
+
+	// Unused tickets are removed once they expire
+	issue()
+	if _, err := db.Exec("UPDATE stream_tickets SET expires_at = now() - interval '1 second'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PruneStreamTickets(db.DB); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	if err := db.QueryRow("SELECT count(*) FROM stream_tickets").Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("Tickets left after pruning: got %d, want 0", left)
+	}
+}
@@ -3,8 +3,11 @@ package routes
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	databaseSetup "match_me_module/database"
+	"match_me_module/matching"
 	middleware "match_me_module/middleware"
 	"match_me_module/structures"
 	"net/http"
@@ -15,13 +18,11 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var db = databaseSetup.GetDB()
-
-// Define your JWT secret key (store securely, e.g., in environment variables)
-var jwtSecretKey = middleware.GetJWTSecretKey()
-
 // Retrieves users from the database and sends them as JSON.
 func GetUsers(w http.ResponseWriter, r *http.Request) {
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	rows, err := db.Query("SELECT id, user_uuid, password_hash, datetime_created FROM user_table")
 
 	if err != nil {
@@ -56,9 +57,7 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 // Login function in the API.
 func Login(w http.ResponseWriter, r *http.Request) {
 	var loginReq structures.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		log.Printf("Error in decoding: %v", err)
+	if !decodeJSON(w, r, &loginReq) {
 		return
 	}
 
@@ -67,6 +66,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
 	var storedHash string
 
 	// First, check if the user exists
@@ -119,45 +121,152 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := GenerateJWT(user_id)
+	// Banned and suspended users cannot log in
+	account, err := middleware.LoadAccount(user_id)
+	if err != nil {
+		log.Printf("Error loading account of %s: %v", user_id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := account.Usable(); err != nil {
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// After a forced reset the new password has to come with the login
+	if account.MustResetPassword {
+		if loginReq.NewPassword == "" {
+			http.Error(w, "Password reset required: send new_password", http.StatusForbidden)
+			return
+		}
+		if loginReq.NewPassword == loginReq.Password {
+			http.Error(w, "New password must differ from the old one", http.StatusBadRequest)
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(loginReq.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Error hashing password", http.StatusInternalServerError)
+			log.Printf("Error hashing password: %v", err)
+			return
+		}
+		_, err = db.Exec("UPDATE user_table SET password_hash = $1, must_reset_password = false WHERE user_uuid = $2", hashedPassword, user_id)
+		if err != nil {
+			http.Error(w, "Error updating password", http.StatusInternalServerError)
+			log.Printf("Error resetting password for user_id %s: %v", user_id, err)
+			return
+		}
+		middleware.ForgetAccount(user_id)
+	}
+
+	// In the cookie auth mode the token goes into a cookie, bound to a CSRF token
+	var csrf string
+	if middleware.CookieAuth() {
+		if csrf, err = middleware.NewCSRFToken(); err != nil {
+			log.Printf("Failed to generate CSRF token: %v", err)
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	expires := time.Now().Add(tokenLifetime)
+	token, err := GenerateJWT(user_id, account.Role, csrf, expires)
 	if err != nil {
 		log.Printf("Failed to generate token: %v", err)
 		http.Error(w, "Could not generate token", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(structures.LoginResponse{
+	response := structures.LoginResponse{
 		Status:  "success",
 		Message: "Login successful",
 		Token:   token,
-	})
+	}
+	if csrf != "" {
+		middleware.SetSessionCookies(w, token, csrf, expires)
+		response.Token = ""
+		response.CSRFToken = csrf
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Logout drops the cookies of the cookie auth mode. A token the client keeps
+// itself stays valid until it expires, the client forgets it.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	middleware.ClearSessionCookies(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Logged out"}`))
 }
 
 func Register(w http.ResponseWriter, r *http.Request) {
 	var registerReq structures.RegisterRequest
 
 	// Decode the request body
-	if err := json.NewDecoder(r.Body).Decode(&registerReq); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		log.Printf("Error in decoding: %v", err)
+	if !decodeJSON(w, r, &registerReq) {
+		return
+	}
+
+	// Connect to the database
+	db := databaseSetup.GetDB()
+
+	if _, err := RegisterUser(db, registerReq); err != nil {
+		var invalid RegistrationError
+		if errors.As(err, &invalid) {
+			http.Error(w, invalid.Message, http.StatusBadRequest)
+			log.Printf("Invalid registration request: %v", err)
+			return
+		}
+		http.Error(w, "Error saving user data", http.StatusInternalServerError)
+		log.Printf("Error registering user: %v", err)
 		return
 	}
 
+	// Respond with success message
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "User registered successfully"}`))
+}
+
+// RegistrationError is a registration request the client has to correct,
+// its message is sent back as it is.
+type RegistrationError struct {
+	Message string
+}
+
+func (e RegistrationError) Error() string {
+	return e.Message
+}
+
+// RegisterUser creates an account with default weights, an empty profile and
+// no filters, and returns its user ID. Every account is created here, the
+// seed command registers its users the same way.
+func RegisterUser(db *sql.DB, registerReq structures.RegisterRequest) (string, error) {
 	// Check if required fields are not empty
 	if registerReq.Username == "" || registerReq.Email == "" || registerReq.FirstName == "" || registerReq.MiddleName == "" ||
-		registerReq.LastName == "" || registerReq.Password == "" || registerReq.City == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
-		log.Printf("Missing required fields in registration request")
-		return
+		registerReq.LastName == "" || registerReq.Birthdate == "" || registerReq.Password == "" || registerReq.City == "" {
+		return "", RegistrationError{"Missing required fields"}
+	}
+
+	// Only adults can register
+	birthdate, err := matching.ParseBirthdate(registerReq.Birthdate, time.Now())
+	if err != nil {
+		return "", RegistrationError{err.Error()}
+	}
+
+	// Make sure the city and its coordinates agree before anything is stored
+	city, latitude, longitude, err := resolveCity(db, registerReq.City, registerReq.Latitude, registerReq.Longitude)
+	if message, rejected := cityErrors[err]; rejected {
+		return "", RegistrationError{message}
+	}
+	if err != nil {
+		return "", fmt.Errorf("error validating city: %v", err)
 	}
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(registerReq.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
-		log.Printf("Error hashing password: %v", err)
-		return
+		return "", fmt.Errorf("error hashing password: %v", err)
 	}
 
 	// Generate UUID for the new user
@@ -169,54 +278,61 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	// Insert data into the `user_table`
 	_, err = db.Exec("INSERT INTO user_table (user_uuid, password_hash, datetime_created) VALUES ($1, $2, $3)", userUUID, hashedPassword, datetimeCreated)
 	if err != nil {
-		http.Error(w, "Error saving user data", http.StatusInternalServerError)
-		log.Printf("Error saving user data: %v", err)
-		return
+		return "", fmt.Errorf("error saving user data: %v", err)
 	}
 
 	// Insert data into the `user_info` table
-	_, err = db.Exec("INSERT INTO user_info (user_uuid, username, email, first_name, middle_name, last_name) VALUES ($1, $2, $3, $4, $5, $6)", userUUID, registerReq.Username, registerReq.Email, registerReq.FirstName, registerReq.MiddleName, registerReq.LastName)
+	_, err = db.Exec("INSERT INTO user_info (user_uuid, username, email, first_name, middle_name, last_name, birthdate) VALUES ($1, $2, $3, $4, $5, $6, $7)", userUUID, registerReq.Username, registerReq.Email, registerReq.FirstName, registerReq.MiddleName, registerReq.LastName, birthdate)
 	if err != nil {
-		http.Error(w, "Error saving user info", http.StatusInternalServerError)
-		log.Printf("Error saving user info: %v", err)
-		return
+		return "", fmt.Errorf("error saving user info: %v", err)
 	}
 
 	// Insert data into the `user_data` table with latitude and longitude (home city)
-	_, err = db.Exec("INSERT INTO user_data (user_uuid, user_city, register_location) VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326))", userUUID, registerReq.City, registerReq.Longitude, registerReq.Latitude)
+	_, err = db.Exec("INSERT INTO user_data (user_uuid, user_city, register_location) VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326))", userUUID, city, longitude, latitude)
 	if err != nil {
-		http.Error(w, "Error saving user data location", http.StatusInternalServerError)
-		log.Printf("Error saving user data location: %v", err)
-		return
+		return "", fmt.Errorf("error saving user data location: %v", err)
 	}
 
 	// Insert default weights into the `weights` table
 	_, err = db.Exec("INSERT INTO weights (user_uuid, weigh_distance, weigh_age, weigh_food, weigh_hobbies, weigh_music) VALUES ($1, $2, $3, $4, $5, $6)",
 		userUUID, 1, 1, 1, 1, 1)
 	if err != nil {
-		http.Error(w, "Error saving user weights", http.StatusInternalServerError)
-		log.Printf("Error saving user weights: %v", err)
-		return
+		return "", fmt.Errorf("error saving user weights: %v", err)
 	}
 
 	_, err = db.Exec("INSERT INTO profile_info (user_uuid) VALUES ($1)",
 		userUUID)
 	if err != nil {
-		http.Error(w, "Error saving user weights", http.StatusInternalServerError)
-		log.Printf("Error saving user weights: %v", err)
-		return
+		return "", fmt.Errorf("error saving user profile: %v", err)
 	}
 
-	// Respond with success message
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "User registered successfully"}`))
+	// Insert an empty row into the `match_filters` table, no filters are active by default
+	_, err = db.Exec("INSERT INTO match_filters (user_uuid) VALUES ($1)", userUUID)
+	if err != nil {
+		return "", fmt.Errorf("error saving user filters: %v", err)
+	}
+
+	// Compute recommendations for the new user and add them to everybody else's
+	profileChanged(userUUID.String())
+
+	return userUUID.String(), nil
 }
 
-func GenerateJWT(userID string) (string, error) {
+// How long a token is valid after logging in
+const tokenLifetime = 24 * time.Hour
+
+// GenerateJWT signs a token that expires at expires, the keyset adds the
+// issuer, audience and time of issue. A CSRF token is stored as the csrf
+// claim, requests authorized by the token cookie have to repeat it.
+func GenerateJWT(userID, role, csrf string, expires time.Time) (string, error) {
 	claims := jwt.MapClaims{
+		"sub":     userID,
 		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
+		"role":    role,
+		"exp":     expires.Unix(),
+	}
+	if csrf != "" {
+		claims["csrf"] = csrf
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecretKey)
+	return middleware.SignToken(claims)
 }
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	middleware "match_me_module/middleware"
+	"match_me_module/structures"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	newTestDB(t)
+	register := func(username, birthdate, city string) map[string]interface{} {
+		return map[string]interface{}{
+			"username":    username,
+			"email":       username + "@example.com",
+			"first_name":  "Carol",
+			"middle_name": "Ann",
+			"last_name":   "Jones",
+			"birthdate":   birthdate,
+			"password":    "carol-password",
+			"user_city":   city,
+		}
+	}
+
+	runHandlerTests(t, Register, []handlerTest{
+		{"invalid body", "POST", "/api/v1/users", "", nil, "{", http.StatusBadRequest},
+		{"missing fields", "POST", "/api/v1/users", "", nil, map[string]string{"username": "carol"}, http.StatusBadRequest},
+		{"too young", "POST", "/api/v1/users", "", nil, register("carol", "2015-01-01", "Tartu"), http.StatusBadRequest},
+		{"invalid birthdate", "POST", "/api/v1/users", "", nil, register("carol", "1990-02-30", "Tartu"), http.StatusBadRequest},
+		{"unknown city", "POST", "/api/v1/users", "", nil, register("carol", "1990-05-17", "Atlantis"), http.StatusBadRequest},
+		{"registered", "POST", "/api/v1/users", "", nil, register("carol", "1990-05-17", "Tartu"), http.StatusOK},
+	})
+}
+
+func TestLogin(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	banned := db.User(t, "banned")
+	reset := db.User(t, "reset")
+	if _, err := db.Exec("UPDATE user_table SET account_status = 'banned' WHERE user_uuid = $1", banned.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE user_table SET must_reset_password = true WHERE user_uuid = $1", reset.ID); err != nil {
+		t.Fatal(err)
+	}
+	login := func(user, password string) map[string]string {
+		return map[string]string{"username": user, "password": password}
+	}
+
+	runHandlerTests(t, Login, []handlerTest{
+		{"invalid body", "POST", "/api/v1/sessions", "", nil, "{", http.StatusBadRequest},
+		{"missing password", "POST", "/api/v1/sessions", "", nil, login("alice", ""), http.StatusBadRequest},
+		{"unknown user", "POST", "/api/v1/sessions", "", nil, login("nobody", "password"), http.StatusUnauthorized},
+		{"wrong password", "POST", "/api/v1/sessions", "", nil, login("alice", "wrong"), http.StatusUnauthorized},
+		{"logged in", "POST", "/api/v1/sessions", "", nil, login("alice", alice.Password), http.StatusOK},
+		{"banned", "POST", "/api/v1/sessions", "", nil, login("banned", banned.Password), http.StatusForbidden},
+		{"reset required", "POST", "/api/v1/sessions", "", nil, login("reset", reset.Password), http.StatusForbidden},
+		{"same new password", "POST", "/api/v1/sessions", "", nil, map[string]string{
+			"username": "reset", "password": reset.Password, "new_password": reset.Password,
+		}, http.StatusBadRequest},
+		{"new password", "POST", "/api/v1/sessions", "", nil, map[string]string{
+			"username": "reset", "password": reset.Password, "new_password": "reset-password2",
+		}, http.StatusOK},
+		{"old password after reset", "POST", "/api/v1/sessions", "", nil, login("reset", reset.Password), http.StatusUnauthorized},
+	})
+
+	// The token of a login works on the other handlers
+	var response struct {
+		Token string `json:"token"`
+	}
+	decode(t, serve(t, Login, "POST", "/api/v1/sessions", "", nil, login("alice", alice.Password)), &response)
+	if recorder := serve(t, UserInfo, "GET", "/api/v1/me", response.Token, nil, nil); recorder.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/me with the new token: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestCookieLogin(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	t.Setenv("AUTH_MODE", "cookie")
+
+	recorder := serve(t, Login, "POST", "/api/v1/sessions", "", nil, map[string]string{"username": "alice", "password": alice.Password})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Login: got status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response structures.LoginResponse
+	decode(t, recorder, &response)
+	if response.Token != "" || response.CSRFToken == "" {
+		t.Fatalf("Login response: got token %q and CSRF token %q, want only a CSRF token", response.Token, response.CSRFToken)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range recorder.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session, csrf := cookies[middleware.TokenCookie], cookies[middleware.CSRFCookie]
+	if session == nil || !session.HttpOnly || csrf == nil || csrf.HttpOnly || csrf.Value != response.CSRFToken {
+		t.Fatalf("Login cookies: got %v", recorder.Result().Cookies())
+	}
+
+	call := func(method, target, csrfHeader string, body string, handler http.HandlerFunc) int {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		request.AddCookie(session)
+		request.AddCookie(csrf)
+		if csrfHeader != "" {
+			request.Header.Set(middleware.CSRFHeader, csrfHeader)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		csrfHeader string
+		handler    http.HandlerFunc
+		want       int
+	}{
+		{"read without CSRF header", "GET", "", UserInfo, http.StatusOK},
+		{"change without CSRF header", "PUT", "", WeightAge, http.StatusUnauthorized},
+		{"change with wrong CSRF header", "PUT", "forged", WeightAge, http.StatusUnauthorized},
+		{"change with CSRF header", "PUT", response.CSRFToken, WeightAge, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(tt.method, "/api/v1/me/weights/age", tt.csrfHeader, `{"number": 2}`, tt.handler); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	recorder := serve(t, Logout, "DELETE", "/api/v1/sessions", "", nil, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d", recorder.Code)
+	}
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Value != "" || cookie.MaxAge >= 0 {
+			t.Errorf("Cookie %s is not cleared: %v", cookie.Name, cookie)
+		}
+	}
+	if len(recorder.Result().Cookies()) != 2 {
+		t.Errorf("Cleared cookies: got %v", recorder.Result().Cookies())
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	db := newTestDB(t)
+	db.User(t, "alice")
+
+	runHandlerTests(t, GetUsers, []handlerTest{
+		{"listed", "GET", "/api/users", "", nil, nil, http.StatusOK},
+	})
+}
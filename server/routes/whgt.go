@@ -39,9 +39,7 @@ func WeightDistance(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
 		Number float64 `json:"number"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -56,7 +54,7 @@ func WeightDistance(w http.ResponseWriter, r *http.Request) {
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
 	// Update the weigh_distance column for the given user
-	updateQuery := "UPDATE weights SET weigh_distance = $1 WHERE user_uuid = $2"
+	updateQuery := "UPDATE weights SET weigh_distance = $1, datetime_updated = now() WHERE user_uuid = $2"
 	_, err = db.Exec(updateQuery, requestBody.Number, userID)
 	if err != nil {
 		http.Error(w, "Failed to update weigh_distance", http.StatusInternalServerError)
@@ -64,6 +62,8 @@ func WeightDistance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond to the client
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("weigh_distance updated successfully"))
@@ -97,9 +97,7 @@ func WeightAge(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
 		Number float64 `json:"number"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -114,7 +112,7 @@ func WeightAge(w http.ResponseWriter, r *http.Request) {
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
 	// Update the weigh_age column for the given user
-	updateQuery := "UPDATE weights SET weigh_age = $1 WHERE user_uuid = $2"
+	updateQuery := "UPDATE weights SET weigh_age = $1, datetime_updated = now() WHERE user_uuid = $2"
 	_, err = db.Exec(updateQuery, requestBody.Number, userID)
 	if err != nil {
 		http.Error(w, "Failed to update weigh_age", http.StatusInternalServerError)
@@ -122,6 +120,8 @@ func WeightAge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond to the client
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("weigh_ange updated successfully"))
@@ -155,9 +155,7 @@ func WeightFood(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
 		Number float64 `json:"number"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -172,7 +170,7 @@ func WeightFood(w http.ResponseWriter, r *http.Request) {
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
 	// Update the weigh_food column for the given user
-	updateQuery := "UPDATE weights SET weigh_food = $1 WHERE user_uuid = $2"
+	updateQuery := "UPDATE weights SET weigh_food = $1, datetime_updated = now() WHERE user_uuid = $2"
 	_, err = db.Exec(updateQuery, requestBody.Number, userID)
 	if err != nil {
 		http.Error(w, "Failed to update weigh_food", http.StatusInternalServerError)
@@ -180,6 +178,8 @@ func WeightFood(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond to the client
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("weigh_food updated successfully"))
@@ -213,9 +213,7 @@ func WeightHobbies(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
 		Number float64 `json:"number"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -230,7 +228,7 @@ func WeightHobbies(w http.ResponseWriter, r *http.Request) {
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
 	// Update the weigh_hobbies column for the given user
-	updateQuery := "UPDATE weights SET weigh_hobbies = $1 WHERE user_uuid = $2"
+	updateQuery := "UPDATE weights SET weigh_hobbies = $1, datetime_updated = now() WHERE user_uuid = $2"
 	_, err = db.Exec(updateQuery, requestBody.Number, userID)
 	if err != nil {
 		http.Error(w, "Failed to update weigh_hobbies", http.StatusInternalServerError)
@@ -238,6 +236,8 @@ func WeightHobbies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond to the client
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("weigh_hobbies updated successfully"))
@@ -271,9 +271,7 @@ func WeightMusic(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
 		Number float64 `json:"number"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		log.Printf("Error decoding request body: %v", err)
+	if !decodeJSON(w, r, &requestBody) {
 		return
 	}
 
@@ -288,7 +286,7 @@ func WeightMusic(w http.ResponseWriter, r *http.Request) {
 	db := databaseSetup.GetDB() // Assume GetDB() returns *sql.DB
 
 	// Update the weigh_music column for the given user
-	updateQuery := "UPDATE weights SET weigh_music = $1 WHERE user_uuid = $2"
+	updateQuery := "UPDATE weights SET weigh_music = $1, datetime_updated = now() WHERE user_uuid = $2"
 	_, err = db.Exec(updateQuery, requestBody.Number, userID)
 	if err != nil {
 		http.Error(w, "Failed to update weigh_music", http.StatusInternalServerError)
@@ -296,6 +294,8 @@ func WeightMusic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profileChanged(userID)
+
 	// Respond to the client
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("weigh_music updated successfully"))
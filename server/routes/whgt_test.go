@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"match_me_module/testdb"
+	"net/http"
+	"testing"
+)
+
+func TestWeights(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+
+	weights := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"distance", WeightDistance},
+		{"age", WeightAge},
+		{"food", WeightFood},
+		{"hobby", WeightHobbies},
+		{"music", WeightMusic},
+	}
+	for _, weight := range weights {
+		t.Run(weight.name, func(t *testing.T) {
+			target := "/api/v1/me/weights/" + weight.name
+			runHandlerTests(t, weight.handler, []handlerTest{
+				{"no token", "PUT", target, "", nil, map[string]float64{"number": 2}, http.StatusUnauthorized},
+				{"invalid body", "PUT", target, alice.Token, nil, "{", http.StatusBadRequest},
+				{"zero", "PUT", target, alice.Token, nil, map[string]float64{"number": 0}, http.StatusBadRequest},
+				{"negative", "PUT", target, alice.Token, nil, map[string]float64{"number": -1}, http.StatusBadRequest},
+				{"updated", "PUT", target, alice.Token, nil, map[string]float64{"number": 2.5}, http.StatusOK},
+			})
+		})
+	}
+}
+
+func TestWeightGet(t *testing.T) {
+	db := newTestDB(t)
+	alice := db.User(t, "alice")
+	db.Weights(t, alice, testdb.Weights{Distance: 3, Age: 2, Food: 1, Hobbies: 0.5, Music: 4})
+
+	runHandlerTests(t, WeightGet, []handlerTest{
+		{"no token", "GET", "/api/v1/me/weights", "", nil, nil, http.StatusUnauthorized},
+		{"weights", "GET", "/api/v1/me/weights", alice.Token, nil, nil, http.StatusOK},
+	})
+
+	var got struct {
+		Distance float64 `json:"weigh_distance"`
+		Age      float64 `json:"weigh_age"`
+		Food     float64 `json:"weigh_food"`
+		Hobbies  float64 `json:"weigh_hobbies"`
+		Music    float64 `json:"weigh_music"`
+	}
+	decode(t, serve(t, WeightGet, "GET", "/api/v1/me/weights", alice.Token, nil, nil), &got)
+	if got.Distance != 3 || got.Age != 2 || got.Food != 1 || got.Hobbies != 0.5 || got.Music != 4 {
+		t.Errorf("Unexpected weights: %+v", got)
+	}
+}
@@ -0,0 +1,62 @@
+// Package storage keeps uploaded files out of the database. Files are stored
+// under keys such as "photos/<user>/<photo>/full.jpg" in a BlobStore, which
+// is either a directory on disk or an S3 compatible bucket.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for keys that were never stored or were deleted.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores binary objects by key.
+type BlobStore interface {
+	Put(key, contentType string, data []byte) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// Default directory of the filesystem store, relative like the other paths in config.env
+const defaultBlobDir = "../server/uploads"
+
+// FromEnv builds the store selected by BLOB_STORE in config.env: "fs" (the
+// default) stores files under BLOB_DIR, "s3" uses the S3_* settings.
+func FromEnv() (BlobStore, error) {
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "fs":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = defaultBlobDir
+		}
+		return NewFSStore(dir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", kind)
+	}
+}
+
+// validKey rejects keys that could escape the store's root or bucket prefix.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
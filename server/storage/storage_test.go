@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"photos/user/photo/full.jpg", true},
+		{"file", true},
+		{"", false},
+		{"/photos/full.jpg", false},
+		{"photos//full.jpg", false},
+		{"photos/full.jpg/", false},
+		{"photos/./full.jpg", false},
+		{"photos/../../etc/passwd", false},
+		{"..", false},
+		{`photos\..\full.jpg`, false},
+	}
+	for _, tt := range tests {
+		if err := validKey(tt.key); (err == nil) != tt.valid {
+			t.Errorf("validKey(%q): got %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFSStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	// Emptied directories are removed, the root stays
+	if entries, err := os.ReadDir(root); err != nil || len(entries) != 0 {
+		t.Errorf("Root after deleting everything: got %v, %v", entries, err)
+	}
+	if err := store.Put("../outside", "text/plain", []byte("x")); err == nil {
+		t.Error("Put outside the root succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "outside")); !os.IsNotExist(err) {
+		t.Error("A file was written outside the root")
+	}
+}
+
+// testStore runs the same round trip against any BlobStore.
+func testStore(t *testing.T, store BlobStore) {
+	t.Helper()
+	const key = "photos/user/photo/full.jpg"
+
+	if _, err := store.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get before Put: got %v, want ErrNotFound", err)
+	}
+	if err := store.Put(key, "image/jpeg", []byte("first")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Putting again replaces the blob
+	if err := store.Put(key, "image/jpeg", []byte("second")); err != nil {
+		t.Fatalf("Put again: %v", err)
+	}
+
+	blob, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil || string(data) != "second" {
+		t.Errorf("Get: got %q, %v, want %q", data, err, "second")
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	// Deleting a missing blob is not an error
+	if err := store.Delete(key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+	if err := store.Put("../escape", "text/plain", nil); err == nil {
+		t.Error("Put with an invalid key succeeded")
+	}
+}
@@ -19,14 +19,16 @@ type UserPage struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password,omitempty"` // required when an admin forced a password reset
 }
 
 type LoginResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	Token   string `json:"token"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Token     string `json:"token,omitempty"`      // left out in the cookie auth mode, the token is in a cookie then
+	CSRFToken string `json:"csrf_token,omitempty"` // only in the cookie auth mode, to send back in the X-CSRF-Token header
 }
 
 type RegisterRequest struct {
@@ -35,6 +37,7 @@ type RegisterRequest struct {
 	FirstName  string  `json:"first_name"`
 	MiddleName string  `json:"middle_name"`
 	LastName   string  `json:"last_name"`
+	Birthdate  string  `json:"birthdate"`
 	Password   string  `json:"password"`
 	City       string  `json:"user_city"`
 	Latitude   float64 `json:"latitude"`